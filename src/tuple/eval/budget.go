@@ -0,0 +1,152 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "tuple"
+import gocontext "context"
+import "fmt"
+import "errors"
+import "time"
+
+/////////////////////////////////////////////////////////////////////////////
+// Evaluation budget
+/////////////////////////////////////////////////////////////////////////////
+
+// Limits on evaluating untrusted scripts, a zero limit is unlimited.
+type Limits struct {
+	Steps int64  // Expressions evaluated
+	Depth int64  // Nesting of expressions being evaluated, which includes recursion
+	Elements int64  // Values allocated in tuples and maps
+	Bytes int64  // Allocated in strings
+	Deadline time.Time
+	Recursion int64  // Nesting of function calls, zero is DefaultRecursion as it cannot be unlimited
+}
+
+// Deeper recursion could overflow the golang stack which cannot be recovered from.
+const DefaultRecursion = 10000
+
+// What has been used of the limits, it is shared by all the scopes of an evaluator.
+type Budget struct {
+	limits Limits
+	steps int64
+	depth int64
+	elements int64
+	bytes int64
+	calls int64
+}
+
+func NewBudget(limits Limits) Budget {
+	return Budget{limits: limits}
+}
+
+func (budget * Budget) Limits() Limits {
+	return budget.limits
+}
+
+// Returned when a limit is exceeded, it cannot be caught by 'try'.
+type BudgetError struct {
+	resource string
+	limit int64
+}
+
+func (err *BudgetError) Error() string {
+	switch err.resource {
+	case "deadline": return "Evaluation budget exceeded: deadline passed"
+	case "recursion": return fmt.Sprintf("Recursion too deep: more than %d nested function calls", err.limit)
+	}
+	return fmt.Sprintf("Evaluation budget exceeded: more than %d %s", err.limit, err.resource)
+}
+
+// One of "steps", "depth", "elements", "bytes", "deadline" or "recursion".
+func (err *BudgetError) Resource() string {
+	return err.resource
+}
+
+// Running out of budget or being cancelled stops evaluation, 'try' does not catch them.
+func uncatchable(err error) bool {
+	var budgetError *BudgetError
+	return errors.As(err, &budgetError) || errors.Is(err, gocontext.Canceled) || errors.Is(err, gocontext.DeadlineExceeded)
+}
+
+func exceeded(used int64, limit int64) bool {
+	return limit > 0 && used > limit
+}
+
+// Called before evaluating each expression, Leave must be called after.
+func (budget * Budget) Enter() error {
+	budget.steps += 1
+	budget.depth += 1
+	switch {
+	case exceeded(budget.steps, budget.limits.Steps):
+		return &BudgetError{"steps", budget.limits.Steps}
+	case exceeded(budget.depth, budget.limits.Depth):
+		return &BudgetError{"depth", budget.limits.Depth}
+	case ! budget.limits.Deadline.IsZero() && time.Now().After(budget.limits.Deadline):
+		return &BudgetError{"deadline", 0}
+	}
+	return nil
+}
+
+func (budget * Budget) Leave() {
+	budget.depth -= 1
+}
+
+// Called before applying a script function, Return must be called after. Tail calls are not counted.
+func (budget * Budget) Call() error {
+	budget.calls += 1
+	limit := budget.limits.Recursion
+	if limit == 0 {
+		limit = DefaultRecursion
+	}
+	if exceeded(budget.calls, limit) {
+		return &BudgetError{"recursion", limit}
+	}
+	return nil
+}
+
+func (budget * Budget) Return() {
+	budget.calls -= 1
+}
+
+func (budget * Budget) Allocate(elements int64, bytes int64) error {
+	budget.elements += elements
+	budget.bytes += bytes
+	switch {
+	case exceeded(budget.elements, budget.limits.Elements):
+		return &BudgetError{"elements", budget.limits.Elements}
+	case exceeded(budget.bytes, budget.limits.Bytes):
+		return &BudgetError{"bytes", budget.limits.Bytes}
+	}
+	return nil
+}
+
+// Checks values can be allocated without counting them, for builtins that know how much they will make.
+func (budget * Budget) Afford(elements int64) error {
+	if exceeded(budget.elements + elements, budget.limits.Elements) {
+		return &BudgetError{"elements", budget.limits.Elements}
+	}
+	return nil
+}
+
+// Counts the values or characters of a result, nested values are counted when they are made.
+func (budget * Budget) AllocateValue(value Value) error {
+	switch value := value.(type) {
+	case String: return budget.Allocate(0, int64(len(value)))
+	case Tuple, tuple.TagValueMap, tuple.Vector, tuple.HashMap: return budget.Allocate(int64(value.Arity()), 0)
+	}
+	return nil
+}
@@ -0,0 +1,474 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "tuple"
+import "fmt"
+import "errors"
+import "reflect"
+import "sort"
+import "strings"
+import "math"
+
+/////////////////////////////////////////////////////////////////////////////
+// Collection functions
+/////////////////////////////////////////////////////////////////////////////
+
+// Functions that transform any tuple, map or stream, the function argument may be a lambda or
+// the name of a function with arguments. A map is treated as its values except by 'map' and 'filter'
+// which return a map with the same keys. The lists and maps returned are persistent so are never
+// changed by later calls, such as a vector given to 'push'.
+func AddCollectionFunctions(table LocalScope) {
+
+	// A field of a map such as a module, a function there is called as it would be by name: member m f(x)
+	table.Add("member", func(context EvalContext, value tuple.Map, member Quoted) (Value, error) {
+		name, args := member.Value(), []Value{}
+		if call, ok := name.(Tuple); ok && call.Arity() > 0 {
+			name, args = call.Get(0), call.List[1:]
+		}
+		key, ok := name.(Tag)
+		if ! ok {
+			return nil, errors.New(fmt.Sprintf("Expected a field name not '%v'", name))
+		}
+		field, err := fieldOf(key, value)
+		if err != nil {
+			return nil, err
+		}
+		switch function := field.(type) {
+		case Function: return function.Call(context, args)
+		case Macro: return function.Call(context, args)
+		}
+		if len(args) > 0 {
+			return nil, errors.New(fmt.Sprintf("The field '%s' is not a function", key.Name))
+		}
+		return field, nil
+	})
+
+	table.Add("map", func(context EvalContext, function Function, values Value) (Value, error) {
+		if mapp, ok := values.(tuple.Map); ok {
+			return mapEntries(mapp, func (key Tag, value Value) (Value, bool, error) {
+				result, err := function.Apply([]Value{value})
+				return result, true, err
+			})
+		}
+		return collect(values, func (value Value, next func(value Value)) error {
+			result, err := function.Apply([]Value{value})
+			if err == nil {
+				next(result)
+			}
+			return err
+		})
+	})
+	table.Add("filter", func(context EvalContext, function Function, values Value) (Value, error) {
+		if mapp, ok := values.(tuple.Map); ok {
+			return mapEntries(mapp, func (key Tag, value Value) (Value, bool, error) {
+				keep, err := applyPredicate(function, value)
+				return value, keep, err
+			})
+		}
+		return collect(values, func (value Value, next func(value Value)) error {
+			keep, err := applyPredicate(function, value)
+			if keep {
+				next(value)
+			}
+			return err
+		})
+	})
+	table.Add("reduce", func(context EvalContext, function Function, initial Value, values Value) (Value, error) {
+		return reduce(function, initial, true, values)
+	})
+	table.Add("reduce", func(context EvalContext, function Function, values Value) (Value, error) {
+		return reduce(function, nil, false, values)
+	})
+	table.Add("any", func(context EvalContext, function Function, values Value) (bool, error) {
+		found := false
+		err := values.ForallValues(func (value Value) error {
+			ok, err := applyPredicate(function, value)
+			if ok {
+				found = true
+				return errStop
+			}
+			return err
+		})
+		return found, ignoreStop(err)
+	})
+	table.Add("all", func(context EvalContext, function Function, values Value) (bool, error) {
+		all := true
+		err := values.ForallValues(func (value Value) error {
+			ok, err := applyPredicate(function, value)
+			if err == nil && ! ok {
+				all = false
+				return errStop
+			}
+			return err
+		})
+		return all, ignoreStop(err)
+	})
+
+	table.Add("sort", func(context EvalContext, values Value) (Value, error) {
+		return sortBy(values, func (value Value) (Value, error) { return value, nil })
+	})
+	table.Add("sortby", func(context EvalContext, function Function, values Value) (Value, error) {
+		return sortBy(values, func (value Value) (Value, error) { return function.Apply([]Value{value}) })
+	})
+	table.Add("groupby", func(context EvalContext, function Function, values Value) (Value, error) {
+		groups := tuple.NewHashMap()
+		err := values.ForallValues(func (value Value) error {
+			key, err := function.Apply([]Value{value})
+			if err != nil {
+				return err
+			}
+			tag := Tag{toString(context, key)}
+			group, ok := groups.Get(tag)
+			if ! ok {
+				group = tuple.NewVector()
+			}
+			groups = groups.Put(tag, group.(tuple.Vector).Push(value))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return groups, nil
+	})
+	table.Add("uniq", func(context EvalContext, values Value) (Value, error) {
+		seen := map[Value]bool{}
+		others := []Value{}
+		return collect(values, func (value Value, next func(value Value)) error {
+			if isComparable(value) {
+				if ! seen[value] {
+					seen[value] = true
+					next(value)
+				}
+				return nil
+			}
+			for _, other := range others {
+				if reflect.DeepEqual(value, other) {
+					return nil
+				}
+			}
+			others = append(others, value)
+			next(value)
+			return nil
+		})
+	})
+	table.Add("flatten", func(context EvalContext, values Value) (Value, error) {
+		result := []Value{}
+		err := flatten(values, &result)
+		return tuple.NewVector(result...), err
+	})
+
+	// Pairs up the elements of each argument, stopping at the end of the shortest.
+	table.Add("zip", func(context EvalContext, args... Value) (Value, error) {
+		lists := [][]Value{}
+		shortest := -1
+		for _, arg := range args {
+			evaluated, err := Eval(context, arg)
+			if err != nil {
+				return nil, err
+			}
+			list, err := collect(evaluated, func (value Value, next func(value Value)) error {
+				next(value)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			lists = append(lists, list.Values())
+			if shortest < 0 || list.Arity() < shortest {
+				shortest = list.Arity()
+			}
+		}
+		result := tuple.NewVector()
+		for k := 0; k < shortest; k += 1 {
+			row := tuple.NewVector()
+			for _, list := range lists {
+				row = row.Push(list[k])
+			}
+			result = result.Push(row)
+		}
+		return result, nil
+	})
+	table.Add("take", func(context EvalContext, count int64, values Value) (Value, error) {
+		k := int64(0)
+		result, err := collect(values, func (value Value, next func(value Value)) error {
+			if k >= count {
+				return errStop
+			}
+			k += 1
+			next(value)
+			return nil
+		})
+		return result, ignoreStop(err)
+	})
+	table.Add("drop", func(context EvalContext, count int64, values Value) (Value, error) {
+		k := int64(0)
+		return collect(values, func (value Value, next func(value Value)) error {
+			if k >= count {
+				next(value)
+			}
+			k += 1
+			return nil
+		})
+	})
+
+	// range 3 is (0 1 2), range 1 3 is (1 2) and range 0 10 5 is (0 5)
+	table.Add("range", func(context EvalContext, end int64) (Value, error) {
+		return integerRange(context, 0, end, 1)
+	})
+	table.Add("range", func(context EvalContext, start int64, end int64) (Value, error) {
+		return integerRange(context, start, end, 1)
+	})
+	table.Add("range", integerRange)
+
+	// A new list or map with a value added, the one given is unchanged: push l 1, assoc m key 1 and dissoc m key
+	table.Add("push", func(context EvalContext, values Value, value Value) (Value, error) {
+		if vector, ok := values.(tuple.Vector); ok {
+			return vector.Push(value), nil
+		}
+		list, err := collect(values, func (value Value, next func(value Value)) error {
+			next(value)
+			return nil
+		})
+		return list.Push(value), err
+	})
+	table.Add("assoc", func(context EvalContext, mapp tuple.Map, key Tag, value Value) Value {
+		return toHashMap(mapp).Put(key, value)
+	})
+	table.Add("dissoc", func(context EvalContext, mapp tuple.Map, key Tag) Value {
+		return toHashMap(mapp).Remove(key)
+	})
+}
+
+func toHashMap(mapp tuple.Map) tuple.HashMap {
+	if hashMap, ok := mapp.(tuple.HashMap); ok {
+		return hashMap
+	}
+	result := tuple.NewHashMap()
+	mapp.ForallKeyValue(func (key Tag, value Value) {
+		result = result.Put(key, value)
+	})
+	return result
+}
+
+// Returned to stop iterating early.
+var errStop = errors.New("stop")
+
+func ignoreStop(err error) error {
+	if err == errStop {
+		return nil
+	}
+	return err
+}
+
+// Collects the values passed to next for each element into a vector.
+func collect(values Value, each func(value Value, next func(value Value)) error) (tuple.Vector, error) {
+	result := []Value{}
+	err := values.ForallValues(func (value Value) error {
+		return each(value, func (value Value) {
+			result = append(result, value)
+		})
+	})
+	return tuple.NewVector(result...), err
+}
+
+// Builds a map from the entries of another, leaving out those that are not kept.
+func mapEntries(mapp tuple.Map, each func(key Tag, value Value) (Value, bool, error)) (Value, error) {
+	result := tuple.NewHashMap()
+	var err error
+	mapp.ForallKeyValue(func (key Tag, value Value) {
+		if err != nil {
+			return
+		}
+		var keep bool
+		value, keep, err = each(key, value)
+		if keep && err == nil {
+			result = result.Put(key, value)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func applyPredicate(function Function, value Value) (bool, error) {
+	result, err := function.Apply([]Value{value})
+	if err != nil {
+		return false, err
+	}
+	ok, isBool := result.(Bool)
+	if ! isBool {
+		message := fmt.Sprintf("Expected true or false not '%s'", result)
+		return false, errors.New(message)
+	}
+	return bool(ok), nil
+}
+
+func reduce(function Function, accumulator Value, started bool, values Value) (Value, error) {
+	err := values.ForallValues(func (value Value) error {
+		if ! started {
+			accumulator = value
+			started = true
+			return nil
+		}
+		result, err := function.Apply([]Value{accumulator, value})
+		accumulator = result
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if ! started {
+		return nil, errors.New("Cannot reduce an empty list without an initial value")
+	}
+	return accumulator, nil
+}
+
+func sortBy(values Value, key func(value Value) (Value, error)) (Value, error) {
+	result, err := collect(values, func (value Value, next func(value Value)) error {
+		next(value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := result.Values()
+	keys := make([]Value, len(list))
+	for k, value := range list {
+		keys[k], err = key(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	indices := make([]int, len(list))
+	for k := range indices {
+		indices[k] = k
+	}
+	sort.SliceStable(indices, func (i, j int) bool {
+		return compareValues(keys[indices[i]], keys[indices[j]]) < 0
+	})
+	sorted := make([]Value, len(list))
+	for j, k := range indices {
+		sorted[j] = list[k]
+	}
+	return tuple.NewVector(sorted...), nil
+}
+
+// Orders booleans before numbers, then strings and tags, then tuples and maps by their elements.
+func compareValues(a Value, b Value) int {
+	rankA, rankB := rankOf(a), rankOf(b)
+	if rankA != rankB {
+		return rankA - rankB
+	}
+	switch rankA {
+	case 0:
+		return compareNumbers(boolToFloat(a.(Bool)), boolToFloat(b.(Bool)))
+	case 1:
+		if less, _ := lessThan(a, b); less {
+			return -1
+		}
+		if greater, _ := lessThan(b, a); greater {
+			return 1
+		}
+		return 0
+	case 2:
+		return strings.Compare(textOf(a), textOf(b))
+	}
+	listA, _ := collect(a, func (value Value, next func(value Value)) error { next(value); return nil })
+	listB, _ := collect(b, func (value Value, next func(value Value)) error { next(value); return nil })
+	for k := 0; k < listA.Arity() && k < listB.Arity(); k += 1 {
+		if compared := compareValues(listA.Get(k), listB.Get(k)); compared != 0 {
+			return compared
+		}
+	}
+	return listA.Arity() - listB.Arity()
+}
+
+func rankOf(value Value) int {
+	switch value.(type) {
+	case Bool: return 0
+	case Int64, Float64, BigInt, Decimal: return 1
+	case String, Tag: return 2
+	}
+	return 3
+}
+
+func compareNumbers(a float64, b float64) int {
+	switch {
+	case a < b: return -1
+	case a > b: return 1
+	}
+	return 0
+}
+
+func boolToFloat(value Bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// Numbers compare exactly across the numeric tower.
+var lessThan = comparison(func (a int64, b int64) bool { return a<b }, func (a float64, b float64) bool { return a<b })
+
+func textOf(value Value) string {
+	if tag, ok := value.(Tag); ok {
+		return tag.Name
+	}
+	return string(value.(String))
+}
+
+func isComparable(value Value) bool {
+	switch value.(type) {
+	case Bool, Int64, Float64, String, Tag: return true
+	}
+	return false
+}
+
+// Appends the scalars and functions within nested tuples and maps.
+func flatten(values Value, result *[]Value) error {
+	return values.ForallValues(func (value Value) error {
+		switch value.(type) {
+		case Function, BigInt, Decimal, tuple.Null:
+			*result = append(*result, value)
+			return nil
+		}
+		if isComparable(value) {
+			*result = append(*result, value)
+			return nil
+		}
+		return flatten(value, result)
+	})
+}
+
+// The size of the range is checked before it is made.
+func integerRange(context EvalContext, start int64, end int64, step int64) (Value, error) {
+	if step == 0 {
+		return nil, errors.New("The step of a range cannot be zero")
+	}
+	if length := (float64(end) - float64(start)) / float64(step); length > 0 {
+		if err := context.GlobalScope().Budget().Afford(int64(math.Ceil(length))); err != nil {
+			return nil, err
+		}
+	}
+	result := []Value{}
+	for k := start; (step > 0 && k < end) || (step < 0 && k > end); k += step {
+		result = append(result, Int64(k))
+	}
+	return tuple.NewVector(result...), nil
+}
@@ -0,0 +1,616 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "tuple"
+import "reflect"
+import "errors"
+import "runtime"
+import "sync"
+import "unsafe"
+import "weak"
+
+/////////////////////////////////////////////////////////////////////////////
+// Compiling
+/////////////////////////////////////////////////////////////////////////////
+
+// Rather than walking the parsed values each time they are evaluated they can be compiled once
+// into a tree of closures. The structure of each expression and the way arguments are passed to
+// each type of function are decided when compiling, the function called is still looked up by name
+// when evaluating as it depends on the scope. The result is the same as walking the tree.
+
+// How expressions are evaluated, it is set for each evaluator.
+type Mode int
+
+const (
+	INTERPRET Mode = iota  // Walk the parsed values
+	COMPILE  // Compile each expression once, then call the compiled code
+	BYTECODE  // Assemble each expression once, then run the bytecode
+)
+
+var modeNames = map[string]Mode{"interpret": INTERPRET, "compile": COMPILE, "bytecode": BYTECODE}
+
+// The mode with the name given on the command line: interpret, compile or bytecode.
+func ModeOf(name string) (Mode, bool) {
+	mode, ok := modeNames[name]
+	return mode, ok
+}
+
+type Compiled func(context EvalContext) (Value, error)
+
+// The compiled code of each tuple evaluated, the tuples are identified by their underlying storage
+// as for locations. It is safe to use from several goroutines.
+type CodeCache struct {
+	code codeTable
+	bodies codeTable  // Of functions, compiled for tail calls
+}
+
+func NewCodeCache() CodeCache {
+	return CodeCache{newCodeTable(), newCodeTable()}
+}
+
+// The number of expressions compiled.
+func (cache * CodeCache) Size() int {
+	return cache.code.size()
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// Code kept for each tuple, as for tuple.Locations the tuple is referred to weakly so the code is
+// forgotten once the tuple has been garbage collected and a new tuple at the same address is not
+// mistaken for it. A copy of the elements compiled, and of the tuples within them, is kept so the
+// code is not used once an element has been replaced, however deep.
+type codeTable struct {
+	entries map[codeKey]*codeEntry
+	mutex *sync.Mutex
+}
+
+type codeKey struct {
+	address uintptr
+	arity int
+}
+
+type codeEntry struct {
+	first weak.Pointer[Value]
+	elements []Value
+	code interface{}  // Compiled or *Program
+}
+
+type codeCleanup struct {
+	key codeKey
+	entry *codeEntry
+}
+
+func newCodeTable() codeTable {
+	return codeTable{map[codeKey]*codeEntry{}, &sync.Mutex{}}
+}
+
+func codeKeyOf(expression Tuple) codeKey {
+	return codeKey{uintptr(unsafe.Pointer(&expression.List[0])), len(expression.List)}
+}
+
+func (table codeTable) find(expression Tuple) (interface{}, bool) {
+	table.mutex.Lock()
+	entry, ok := table.entries[codeKeyOf(expression)]
+	table.mutex.Unlock()
+	if ! ok || entry.first.Value() != &expression.List[0] || ! identicalElements(entry.elements, expression.List) {
+		return nil, false
+	}
+	return entry.code, true
+}
+
+// The code is compiled without holding the lock, so the same tuple may be compiled twice.
+func (table codeTable) add(expression Tuple, code interface{}) {
+	first := &expression.List[0]
+	key := codeKeyOf(expression)
+	entry := &codeEntry{weak.Make(first), copyElements(expression.List), code}
+	table.mutex.Lock()
+	table.entries[key] = entry
+	table.mutex.Unlock()
+	runtime.AddCleanup(first, table.forget, codeCleanup{key, entry})
+}
+
+// Called once a tuple has been garbage collected, unless it has been compiled again since.
+func (table codeTable) forget(cleanup codeCleanup) {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	if table.entries[cleanup.key] == cleanup.entry {
+		delete(table.entries, cleanup.key)
+	}
+}
+
+func (table codeTable) size() int {
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	return len(table.entries)
+}
+
+// A copy of the elements and of the elements of the tuples within them.
+func copyElements(list []Value) []Value {
+	result := make([]Value, len(list))
+	for k, element := range list {
+		if nested, ok := element.(Tuple); ok {
+			element = tuple.NewTuple(copyElements(nested.List)...)
+		}
+		result[k] = element
+	}
+	return result
+}
+
+// Whether each element is the same value, nested tuples are compared element by element as
+// two tuples sharing storage may still differ if it has been changed.
+func identicalElements(elements []Value, list []Value) bool {
+	for k, element := range elements {
+		if ! identical(element, list[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+func identical(a Value, b Value) bool {
+	switch aa := a.(type) {
+	case Tag, String, Int64, Float64, Bool, tuple.Null:
+		return a == b
+	case Tuple:
+		bb, ok := b.(Tuple)
+		return ok && len(aa.List) == len(bb.List) && identicalElements(aa.List, bb.List)
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	if reflect.ValueOf(a).Comparable() {
+		return a == b
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// Compiles the expression unless it has already been, tuples within it are also compiled
+// since they are evaluated when passed to functions such as 'if' and 'while'.
+func (cache * CodeCache) Compile(global GlobalScope, expression Value) Compiled {
+	return cache.compile(global.Locations(), expression)
+}
+
+func (cache * CodeCache) compile(locations tuple.Locations, expression Value) Compiled {
+	list, ok := expression.(Tuple)
+	if ! ok || list.Arity() == 0 {
+		return compileExpression(cache, locations, expression)
+	}
+	if code, ok := cache.code.find(list); ok {
+		return code.(Compiled)
+	}
+	code := compileExpression(cache, locations, list)
+	cache.code.add(list, code)
+	return code
+}
+
+func compileExpression(cache * CodeCache, locations tuple.Locations, expression Value) Compiled {
+	var code Compiled
+	switch val := expression.(type) {
+	case Tuple:
+		if val.Arity() == 0 {
+			return evaluated(constant(val))
+		}
+		code = compileTuple(cache, locations, val)
+		if location, ok := locations.Find(val); ok {
+			code = located(code, location)
+		}
+	case Tag:
+		code = compileCall(val, []Value{}, []Compiled{})
+	default:
+		return evaluated(constant(val))
+	}
+	return evaluated(code)
+}
+
+func compileTuple(cache * CodeCache, locations tuple.Locations, expression Tuple) Compiled {
+	head := expression.Get(0)
+	if expression.Arity() == 1 {
+		return cache.compile(locations, head)
+	}
+	args := arguments(expression)
+	compiled := make([]Compiled, len(args))
+	for k, arg := range args {
+		compiled[k] = cache.compile(locations, arg)
+	}
+	tag, ok := head.(Tag)
+	if ok {
+		return compileCall(tag, args, compiled)
+	}
+	compiledHead := cache.compile(locations, head)
+	// As for evalTuple
+	return func (context EvalContext) (Value, error) {
+		head, err := compiledHead(context)
+		if err != nil {
+			return tuple.EMPTY, err
+		}
+		if function, ok := head.(Function); ok {
+			return function.Call(context, args)
+		}
+		newTuple := tuple.NewTuple(head)
+		for _, arg := range compiled {
+			evaluated, err := arg(context)
+			if err != nil {
+				return tuple.EMPTY, err
+			}
+			newTuple.Append(evaluated)
+		}
+		return newTuple, context.GlobalScope().Budget().AllocateValue(newTuple)
+	}
+}
+
+// A copy of the arguments, the code must not refer to the tuple's storage or it would never be forgotten.
+func arguments(expression Tuple) []Value {
+	return append([]Value{}, expression.List[1:]...)
+}
+
+func constant(value Value) Compiled {
+	return func (context EvalContext) (Value, error) {
+		return value, nil
+	}
+}
+
+// Evaluating is checked against the cancellation and budget as for Eval.
+func evaluated(code Compiled) Compiled {
+	return func (context EvalContext) (Value, error) {
+		global := context.GlobalScope()
+		if err := global.Cancellation().Err(); err != nil {
+			return nil, err
+		}
+		budget := global.Budget()
+		if err := budget.Enter(); err != nil {
+			return nil, err
+		}
+		result, err := code(context)
+		budget.Leave()
+		return result, err
+	}
+}
+
+func located(code Compiled, location Location) Compiled {
+	return func (context EvalContext) (Value, error) {
+		global := context.GlobalScope()
+		previous := global.Location()
+		global.SetLocation(location)
+		result, err := code(context)
+		global.SetLocation(previous)
+		return result, withLocation(err, location)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Tail calls
+/////////////////////////////////////////////////////////////////////////////
+
+// The body of a function is compiled so that a call of a script function whose result would be
+// returned is not made but returned as a tailCall, which Function.Apply makes in place of the call
+// it is in. Then recursion in a tail position, including within 'if' and 'progn' unless they have
+// been redefined, does not nest in golang.
+
+// The function still to be applied, it is only ever returned to Function.Apply.
+type tailCall struct {
+	function Function
+	values []Value
+}
+
+func (call tailCall) Arity() int { return 0 }
+func (call tailCall) ForallValues(next func(value Value) error) error { return nil }
+
+// Compiles the body of a function unless it has already been.
+func (cache * CodeCache) CompileBody(global GlobalScope, expression Value) Compiled {
+	return cache.compileBody(global.Locations(), expression)
+}
+
+func (cache * CodeCache) compileBody(locations tuple.Locations, expression Value) Compiled {
+	list, ok := expression.(Tuple)
+	if ! ok || list.Arity() == 0 {
+		return compileTail(cache, locations, expression)
+	}
+	if code, ok := cache.bodies.find(list); ok {
+		return code.(Compiled)
+	}
+	code := compileTail(cache, locations, list)
+	cache.bodies.add(list, code)
+	return code
+}
+
+func compileTail(cache * CodeCache, locations tuple.Locations, expression Value) Compiled {
+	var code Compiled
+	switch val := expression.(type) {
+	case Tuple:
+		if val.Arity() == 0 {
+			return compileExpression(cache, locations, val)
+		}
+		code = compileTailTuple(cache, locations, val)
+		if location, ok := locations.Find(val); ok {
+			code = located(code, location)
+		}
+	case Tag:
+		code = compileTailCall(cache, locations, val, []Value{}, []Compiled{})
+	default:
+		return compileExpression(cache, locations, expression)
+	}
+	return evaluated(code)
+}
+
+// As for compileTuple.
+func compileTailTuple(cache * CodeCache, locations tuple.Locations, expression Tuple) Compiled {
+	head := expression.Get(0)
+	if expression.Arity() == 1 {
+		return cache.compileBody(locations, head)
+	}
+	args := arguments(expression)
+	compiled := make([]Compiled, len(args))
+	for k, arg := range args {
+		compiled[k] = cache.compile(locations, arg)
+	}
+	if tag, ok := head.(Tag); ok {
+		return compileTailCall(cache, locations, tag, args, compiled)
+	}
+	return compileTailApply(cache.compile(locations, head), compiled)
+}
+
+func compileTailCall(cache * CodeCache, locations tuple.Locations, head Tag, args []Value, compiled []Compiled) Compiled {
+	var inline Compiled
+	switch {
+	case head.Name == "if" && len(args) == 3:
+		condition := compiled[0]
+		then := cache.compileBody(locations, args[1])
+		otherwise := cache.compileBody(locations, args[2])
+		inline = func (context EvalContext) (Value, error) {
+			value, err := condition(context)
+			if err != nil {
+				return tuple.EMPTY, err
+			}
+			converted, err := Convert(context, value, BoolType)
+			if err != nil {
+				return tuple.EMPTY, err
+			}
+			if converted.(bool) {
+				return then(context)
+			}
+			return otherwise(context)
+		}
+	case head.Name == "progn" && len(args) > 0:
+		last := cache.compileBody(locations, args[len(args) - 1])
+		inline = func (context EvalContext) (Value, error) {
+			for _, arg := range compiled[:len(compiled) - 1] {
+				if _, err := arg(context); err != nil {
+					return nil, err
+				}
+			}
+			return last(context)
+		}
+	}
+	return func (context EvalContext) (Value, error) {
+		_, f := context.Find(context, head, args)
+		switch {
+		case f.Type() == FunctionType:
+			values, err := evaluateAll(context, compiled)
+			if err != nil {
+				return nil, err
+			}
+			return tailCall{f.Interface().(Function), values}, nil
+		case inline != nil && f.Kind() == reflect.Func && f.Pointer() == inlined[head.Name]:
+			return inline(context)
+		}
+		return invoke(context, f, head, args, compiled)
+	}
+}
+
+// As for evalTuple.
+func compileTailApply(compiledHead Compiled, compiled []Compiled) Compiled {
+	return func (context EvalContext) (Value, error) {
+		head, err := compiledHead(context)
+		if err != nil {
+			return tuple.EMPTY, err
+		}
+		values, err := evaluateAll(context, compiled)
+		if err != nil {
+			return tuple.EMPTY, err
+		}
+		if function, ok := head.(Function); ok {
+			return tailCall{function, values}, nil
+		}
+		newTuple := tuple.NewTuple(head)
+		newTuple.List = append(newTuple.List, values...)
+		return newTuple, context.GlobalScope().Budget().AllocateValue(newTuple)
+	}
+}
+
+func evaluateAll(context EvalContext, compiled []Compiled) ([]Value, error) {
+	values := make([]Value, len(compiled))
+	for k, arg := range compiled {
+		value, err := arg(context)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = value
+	}
+	return values, nil
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// A call of a named function, as for Call.
+func compileCall(head Tag, args []Value, compiled []Compiled) Compiled {
+	return func (context EvalContext) (Value, error) {
+		_, f := context.Find(context, head, args)
+		return invoke(context, f, head, args, compiled)
+	}
+}
+
+func invoke(context EvalContext, f reflect.Value, head Tag, args []Value, compiled []Compiled) (Value, error) {
+	var result Value
+	var err error
+	if f.Type() == MacroType {
+		return f.Interface().(Macro).Call(context, args)
+	}
+	switch f.Type() {
+	case FunctionType:
+		result, err = f.Interface().(Function).Call(context, args)
+	case OverloadsType:
+		var values []Value
+		if values, err = evaluateAll(context, compiled); err == nil {
+			result, err = f.Interface().(Overloads).Apply(context, head, values)
+		}
+	default:
+		result, err = planOf(f.Type()).call(context, f, head, args, compiled)
+	}
+	if err != nil {
+		return result, err
+	}
+	return result, context.GlobalScope().Budget().AllocateValue(result)
+}
+
+// How arguments are passed to functions of a given type, decided once for each type.
+type callPlan struct {
+	takesContext bool
+	variadic bool
+	kinds []argKind
+	types []reflect.Type
+	fast func(context EvalContext, f reflect.Value, compiled []Compiled) (Value, error)
+}
+
+type argKind int
+
+const (
+	convertArg argKind = iota  // Evaluated then converted to the parameter's type
+	valueArg  // Evaluated
+	tagArg  // A tag is passed as is otherwise it is evaluated and converted
+	quotedArg  // Passed unevaluated
+)
+
+var plans sync.Map
+
+func planOf(typ reflect.Type) *callPlan {
+	if plan, ok := plans.Load(typ); ok {
+		return plan.(*callPlan)
+	}
+	plan := &callPlan{takesContext: takesContext(typ), variadic: typ.IsVariadic()}
+	start := 0
+	if plan.takesContext {
+		start = 1
+	}
+	for k := start; k < typ.NumIn() && ! plan.variadic; k += 1 {
+		expected := typ.In(k)
+		kind := convertArg
+		switch expected {
+		case ValueType: kind = valueArg
+		case TagType: kind = tagArg
+		case QuotedType: kind = quotedArg
+		}
+		plan.kinds = append(plan.kinds, kind)
+		plan.types = append(plan.types, expected)
+	}
+	plan.fast = fastCall(typ)
+	plans.Store(typ, plan)
+	return plan
+}
+
+func (plan * callPlan) call(context EvalContext, f reflect.Value, head Tag, args []Value, compiled []Compiled) (Value, error) {
+	if plan.fast != nil && ! plan.variadic {
+		return plan.fast(context, f, compiled)
+	}
+	start := 0
+	if plan.takesContext {
+		start = 1
+	}
+	reflectedArgs := make([]reflect.Value, len(args) + start)
+	if plan.takesContext {
+		reflectedArgs[0] = reflect.ValueOf(context)
+	}
+	for k, arg := range args {
+		var result interface{} = arg
+		if ! plan.variadic {
+			_, isTag := arg.(Tag)
+			switch {
+			case plan.kinds[k] == tagArg && isTag:
+			case plan.kinds[k] == quotedArg: result = Quoted{arg}
+			default:
+				evaluated, err := compiled[k](context)
+				if err != nil {
+					return tuple.EMPTY, err
+				}
+				if plan.kinds[k] == valueArg {
+					result = evaluated
+				} else if result, err = Convert(context, evaluated, plan.types[k]); err != nil {
+					return tuple.EMPTY, err
+				}
+			}
+		}
+		if result == nil {
+			return tuple.EMPTY, errors.New("Unexpected nil head=" + head.Name)
+		}
+		reflectedArgs[k + start] = reflect.ValueOf(result)
+	}
+	call := ReflectCall{f, f.Type(), start, reflectedArgs}
+	return call.Call(context, head.Name)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// Calls functions of the most common types without reflection, a function found for a call
+// always has the same number of parameters as arguments unless it is variadic.
+func fastCall(typ reflect.Type) func(context EvalContext, f reflect.Value, compiled []Compiled) (Value, error) {
+	switch typ {
+	case reflect.TypeOf(func () Value { return nil }):
+		return func(context EvalContext, f reflect.Value, compiled []Compiled) (Value, error) {
+			return f.Interface().(func () Value)(), nil
+		}
+	case reflect.TypeOf(func (Value) (Value, error) { return nil, nil }):
+		return func(context EvalContext, f reflect.Value, compiled []Compiled) (Value, error) {
+			a, err := compiled[0](context)
+			if err != nil {
+				return tuple.EMPTY, err
+			}
+			return f.Interface().(func (Value) (Value, error))(a)
+		}
+	case reflect.TypeOf(func (Value, Value) (Value, error) { return nil, nil }):
+		return func(context EvalContext, f reflect.Value, compiled []Compiled) (Value, error) {
+			a, b, err := evaluateTwo(context, compiled)
+			if err != nil {
+				return tuple.EMPTY, err
+			}
+			return f.Interface().(func (Value, Value) (Value, error))(a, b)
+		}
+	case reflect.TypeOf(func (Value, Value) (bool, error) { return false, nil }):
+		return func(context EvalContext, f reflect.Value, compiled []Compiled) (Value, error) {
+			a, b, err := evaluateTwo(context, compiled)
+			if err != nil {
+				return tuple.EMPTY, err
+			}
+			result, err := f.Interface().(func (Value, Value) (bool, error))(a, b)
+			if err != nil {
+				return nil, err
+			}
+			return Bool(result), nil
+		}
+	}
+	return nil
+}
+
+func evaluateTwo(context EvalContext, compiled []Compiled) (Value, Value, error) {
+	a, err := compiled[0](context)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := compiled[1](context)
+	return a, b, err
+}
@@ -34,7 +34,13 @@ var conversions = NewConversions(
 	tuple.BoolToInt,
 	func(value Int64) float64 { return float64(int64(value)) },
 	func(value Float64) int64 { return int64(float64(value)) },
+	func(value tuple.BigInt) float64 { return value.Float64() },
+	func(value tuple.Decimal) float64 { return value.Float64() },
+	func(value tuple.BigInt) string { return value.String() },
+	func(value tuple.Decimal) string { return value.String() },
 	func(value tuple.TagValueMap) tuple.Map { return value },
+	func(value tuple.HashMap) tuple.Map { return value },
+	func(value tuple.Vector) Tuple { return tuple.NewTuple(value.Values()...) },
 	fmt.Sprint,  // TODO Inf rather than +If
 	tuple.Int64ToString)
 
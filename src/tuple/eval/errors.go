@@ -0,0 +1,225 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "tuple"
+import "fmt"
+import "errors"
+import "os"
+import "os/exec"
+import "strings"
+
+/////////////////////////////////////////////////////////////////////////////
+// Script errors
+/////////////////////////////////////////////////////////////////////////////
+
+// An error raised while evaluating, either thrown by a script or returned by a builtin.
+// It is caught as a map value with the message, kind, location and stack of function names
+// innermost first. The stack is built up as the error unwinds through function calls.
+type ScriptError struct {
+	kind string
+	message string
+	location *Location  // Nil until known
+	stack []string
+	thrown Value  // The map or value given to 'throw' if any
+}
+
+func NewScriptError(kind string, message string) *ScriptError {
+	return &ScriptError{kind: kind, message: message}
+}
+
+func (err *ScriptError) Error() string {
+	return err.message
+}
+
+func (err *ScriptError) Kind() string {
+	return err.kind
+}
+
+func (err *ScriptError) Location() (Location, bool) {
+	if err.location == nil {
+		return Location{}, false
+	}
+	return *err.location, true
+}
+
+func (err *ScriptError) Stack() []string {
+	return err.stack
+}
+
+// The error as caught by a script, any other fields of a thrown map are kept.
+func (err *ScriptError) Value() Value {
+	result := tuple.NewTagValueMap()
+	result.Add(Tag{"message"}, String(err.message))
+	result.Add(Tag{"kind"}, String(err.kind))
+	location := ""
+	if err.location != nil {
+		location = err.location.String()
+	}
+	result.Add(Tag{"location"}, String(location))
+	stack := tuple.NewTuple()
+	for _, name := range err.stack {
+		stack.Append(String(name))
+	}
+	result.Add(Tag{"stack"}, stack)
+	switch thrown := err.thrown.(type) {
+	case nil, String:
+	case tuple.Map:
+		thrown.ForallKeyValue(func(key Tag, value Value) {
+			if _, ok := result.Get(key); ! ok {
+				result.Add(key, value)
+			}
+		})
+	default:
+		result.Add(Tag{"value"}, thrown)
+	}
+	return result
+}
+
+// Converts any error into a script error, the kind of a golang error depends on where it came from.
+func toScriptError(err error) *ScriptError {
+	var scriptError *ScriptError
+	if errors.As(err, &scriptError) {
+		return scriptError
+	}
+	var pathError *os.PathError
+	var exitError *exec.ExitError
+	var execError *exec.Error
+	kind := "error"
+	switch {
+	case errors.As(err, &pathError): kind = "io"
+	case errors.As(err, &exitError), errors.As(err, &execError): kind = "exec"
+	case err == errDivideByZero: kind = "arithmetic"
+	}
+	return NewScriptError(kind, err.Error())
+}
+
+// Records where an error was raised, the innermost location is kept.
+func withLocation(err error, location Location) error {
+	if err == nil || uncatchable(err) {
+		return err
+	}
+	scriptError := toScriptError(err)
+	if scriptError.location == nil {
+		scriptError.location = &location
+	}
+	return scriptError
+}
+
+// Records a function the error unwound through.
+func withFrame(err error, name string) error {
+	if err == nil || uncatchable(err) {
+		return err
+	}
+	if name == "" {
+		name = "lambda"
+	}
+	scriptError := toScriptError(err)
+	scriptError.stack = append(scriptError.stack, name)
+	return scriptError
+}
+
+// Of the functions replaced by tail calls, those kept for the stack of an error.
+const replacedFrames = 16
+
+// Adds the functions replaced by tail calls, the latest first.
+func withFrames(err error, names []string) error {
+	for k := len(names) - 1; k >= 0; k -= 1 {
+		err = withFrame(err, names[k])
+	}
+	return err
+}
+
+// Makes the error raised by 'throw', a map can give the message and kind.
+func thrownError(thrown Value) *ScriptError {
+	err := NewScriptError("error", "")
+	err.thrown = thrown
+	switch value := thrown.(type) {
+	case String:
+		err.message = string(value)
+	case tuple.Map:
+		value.ForallKeyValue(func(key Tag, field Value) {
+			switch key.Name {
+			case "message": err.message = fmt.Sprint(field)
+			case "kind": err.kind = fmt.Sprint(field)
+			}
+		})
+	default:
+		err.message = fmt.Sprint(thrown)
+	}
+	return err
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// try code (catch e handler) (finally cleanup)
+//
+// Both the catch and finally clauses are optional, the error caught is bound to 'e' as a map.
+// The cleanup is always evaluated, an error there replaces any error from the code or handler.
+// Exceeding the evaluation budget or cancellation is not caught.
+func try(context EvalContext, values... Value) (result Value, err error) {
+	if len(values) == 0 {
+		return nil, errors.New("No code provided to 'try'")
+	}
+	var catch, finally Tuple
+	for _, clause := range values[1:] {
+		list, ok := clause.(Tuple)
+		if ok && list.Arity() > 0 && list.Get(0) == (Tag{"catch"}) && list.Arity() == 3 {
+			catch = list
+		} else if ok && list.Arity() > 0 && list.Get(0) == (Tag{"finally"}) {
+			finally = list
+		} else {
+			message := fmt.Sprintf("Expected 'catch e code' or 'finally code' in 'try' not '%s'", clause)
+			return nil, errors.New(message)
+		}
+	}
+	if finally.Arity() > 0 {
+		defer func() {
+			for _, code := range finally.List[1:] {
+				if _, cleanupErr := Eval(context, code); cleanupErr != nil {
+					result, err = nil, cleanupErr
+				}
+			}
+		}()
+	}
+	result, err = Eval(context, values[0])
+	if err == nil || catch.Arity() == 0 || uncatchable(err) {
+		return result, err
+	}
+	name, ok := catch.Get(1).(Tag)
+	if ! ok {
+		message := fmt.Sprintf("Expected identifier for the error caught not '%s'", catch.Get(1))
+		return nil, errors.New(message)
+	}
+	scope := context.NewLocalScope()
+	bind(scope, name.Name, toScriptError(err).Value())
+	return Eval(scope, catch.Get(2))
+}
+
+func AddErrorFunctions(table LocalScope) {
+	table.Add("try", try)
+	// throw "message" or throw kind "message" or throw { message: ... kind: ... }
+	table.Add("throw", func(context EvalContext, thrown Value) (Value, error) {
+		return nil, thrownError(thrown)
+	})
+	table.Add("throw", func(context EvalContext, kind string, message string) (Value, error) {
+		return nil, NewScriptError(kind, message)
+	})
+	table.Add("error", func(context EvalContext, values... Value) (Value, error) {
+		return nil, NewScriptError("error", strings.Join(EvalToStrings(context, values), ""))
+	})
+}
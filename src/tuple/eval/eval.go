@@ -19,8 +19,10 @@ package eval
 import "reflect"
 import "fmt"
 import "tuple"
+import gocontext "context"
 import "errors"
 import "strings"
+import "sort"
 
 type Tag = tuple.Tag
 type Value = tuple.Value
@@ -70,6 +72,26 @@ type GlobalScope interface {
 	// to provide a searchable directory structure.
 	Root() Value
 	AddToRoot(string Tag, value Value)  // Is this needed
+
+	// Where parsed values came from, parsers record into this table so errors can be reported
+	// against the expression being evaluated.
+	Locations() tuple.Locations
+	Location() Location
+	SetLocation(location Location)
+
+	// What evaluation has used of its limits, setting the limits starts a new budget.
+	Budget() *Budget
+	SetLimits(limits Limits)
+
+	// Evaluation stops with the cancellation's error when it is cancelled.
+	Cancellation() gocontext.Context
+	SetCancellation(cancellation gocontext.Context)
+
+	// Whether expressions are compiled before being evaluated and the code compiled.
+	Mode() Mode
+	SetMode(mode Mode)
+	Code() *CodeCache
+	Programs() *ProgramCache
 }
 
 type LocalScope interface {
@@ -83,23 +105,44 @@ type Quoted struct {
 func (quoted Quoted) Value() Value { return quoted.value }
 
 func Eval(context EvalContext, expression Value) (Value, error) {
+	global := context.GlobalScope()
+	switch expression.(type) {
+	case Tuple, Tag:
+		switch global.Mode() {
+		case COMPILE: return global.Code().Compile(global, expression)(context)
+		case BYTECODE: return global.Programs().Run(context, expression)
+		}
+	}
+	return interpret(context, expression)
+}
+
+// Evaluates by walking the expression.
+func interpret(context EvalContext, expression Value) (Value, error) {
 
 	context.Log("VERBOSE", "eval: '%s'", expression)
+	global := context.GlobalScope()
+	if err := global.Cancellation().Err(); err != nil {
+		return nil, err
+	}
+	budget := global.Budget()
+	if err := budget.Enter(); err != nil {
+		return nil, err
+	}
+	defer budget.Leave()
 	switch val := expression.(type) {
 	case Tuple:
 		ll := val.Arity()
 		if ll == 0 {
 			return val, nil  // If IsAtom then return val, nul
 		}
-		head := val.Get(0)
-		if ll == 1 {
-			return Eval(context, head)
-		}
-		tag, ok := head.(Tag)
-		if ! ok {
-			return evalTuple(context, val)
+		if location, ok := global.Locations().Find(val); ok {
+			previous := global.Location()
+			global.SetLocation(location)
+			defer global.SetLocation(previous)
+			result, err := evalExpression(context, val)
+			return result, withLocation(err, location)
 		}
-		return Call(context, tag, val.List[1:])
+		return evalExpression(context, val)
 	case Tag:
 		return Call(context, val, []Value{})
 	default:
@@ -107,9 +150,29 @@ func Eval(context EvalContext, expression Value) (Value, error) {
 	}
 }
 
-func evalTuple(context EvalContext, value Tuple) (Tuple, error) {
-	newTuple := tuple.NewTuple()
-	for _,v:= range value.List {
+func evalExpression(context EvalContext, expression Tuple) (Value, error) {
+	head := expression.Get(0)
+	if expression.Arity() == 1 {
+		return Eval(context, head)
+	}
+	tag, ok := head.(Tag)
+	if ! ok {
+		return evalTuple(context, expression)
+	}
+	return Call(context, tag, expression.List[1:])
+}
+
+// Evaluates each element of a tuple, if the first is a function it is called with the rest as arguments.
+func evalTuple(context EvalContext, value Tuple) (Value, error) {
+	head, err := Eval(context, value.List[0])
+	if err != nil {
+		return tuple.EMPTY, err
+	}
+	if function, ok := head.(Function); ok {
+		return function.Call(context, value.List[1:])
+	}
+	newTuple := tuple.NewTuple(head)
+	for _,v:= range value.List[1:] {
 		evaluated, err := Eval(context, v)
 		if err != nil {
 			return tuple.EMPTY, err
@@ -117,12 +180,29 @@ func evalTuple(context EvalContext, value Tuple) (Tuple, error) {
 		newTuple.Append(evaluated)
 	}
 	Trace(context, "Eval tuple return '%s'", newTuple)
-	return newTuple, nil
+	return newTuple, context.GlobalScope().Budget().AllocateValue(newTuple)
 }
 
 func Call(context EvalContext, head Tag, args []Value) (Value, error) {  // Reduce
 
 	_, f := context.Find(context, head, args)
+	if f.Type() == MacroType {
+		return f.Interface().(Macro).Call(context, args)
+	}
+	if f.Type() == OverloadsType {
+		result, err := f.Interface().(Overloads).Call(context, head, args)
+		if err != nil {
+			return result, err
+		}
+		return result, context.GlobalScope().Budget().AllocateValue(result)
+	}
+	if f.Type() == FunctionType {
+		result, err := f.Interface().(Function).Call(context, args)
+		if err != nil {
+			return result, err
+		}
+		return result, context.GlobalScope().Budget().AllocateValue(result)
+	}
 	call := NewReflectCall(context, f, len(args))
 	for key,v:= range args {
 		var result interface{} = v
@@ -149,7 +229,11 @@ func Call(context EvalContext, head Tag, args []Value) (Value, error) {  // Redu
 		}
 		call.setArg(key, result)
 	}
-	return call.Call(context, head.Name)
+	result, err := call.Call(context, head.Name)
+	if err != nil {
+		return result, err
+	}
+	return result, context.GlobalScope().Budget().AllocateValue(result)
 }
 
 /////////////////////////////////////////////////////////////////////////////
@@ -178,9 +262,15 @@ func  (context * SymbolTable) ForallValues(next func(value Value) error) error {
 	return nil
 }
 
+// Adds a golang function or a script Function, which takes any number of arguments.
+// A golang function with the same name and arity as another but different parameter types overloads it.
 func (table * SymbolTable) Add(name string, function interface{}) {
 	reflectValue := reflect.ValueOf(function)
 	typ := reflectValue.Type()
+	if typ == FunctionType || typ == MacroType {
+		table.symbols[makeKey(name, 0, true)] = reflectValue
+		return
+	}
 
 	nn := typ.NumIn()
 	if nn > 0 {
@@ -192,23 +282,27 @@ func (table * SymbolTable) Add(name string, function interface{}) {
 	table.symbols[key] = reflectValue
 	
 	key = makeKey(name, nn, typ.IsVariadic())
-	table.symbols[key] = reflectValue
+	table.symbols[key] = overload(name, table.symbols[key], reflectValue)
 }
 
-func (table * SymbolTable) Find(context EvalContext, head Tag, args []Value) (LocalScope, reflect.Value) {  // Reduce
-
-	/*key := signatureOfCall(head.Name, args)
-	f, ok := table.symbols[key]
-	if ok {
-		return table, f
+// The script functions and macros in the table by name, such as those a module declares.
+func (table * SymbolTable) Functions() tuple.TagValueMap {
+	names := []string{}
+	for key, f := range table.symbols {
+		if strings.HasPrefix(key, "*_") && (f.Type() == FunctionType || f.Type() == MacroType) {
+			names = append(names, key[2:])
+		}
+	}
+	sort.Strings(names)
+	result := tuple.NewTagValueMap()
+	for _, name := range names {
+		result.Add(Tag{name}, table.symbols[makeKey(name, 0, true)].Interface().(Value))
 	}
+	return result
+}
+
+func (table * SymbolTable) Find(context EvalContext, head Tag, args []Value) (LocalScope, reflect.Value) {  // Reduce
 
-	key = strings.Replace(key, "int64", "float64", 99999)
-	f, ok = table.symbols[key]
-	if ok {
-		return table, f
-	}*/
-	
 	name := head.Name
 	nn := len(args)
 
@@ -227,18 +321,12 @@ func (table * SymbolTable) Find(context EvalContext, head Tag, args []Value) (Lo
 
 /////////////////////////////////////////////////////////////////////////////
 
-func signatureOfCall(name string, args []Value) string {
-
-	key := name
-	for _,v := range args {
-		key = key + " " + reflect.TypeOf(v).Name()
-	}
-	return key
-}
-
 func signatureOfFunction(name string, function reflect.Value) string {
 	tt := function.Type()
 	key := name
+	if tt == FunctionType || tt == MacroType || tt == OverloadsType {
+		return key
+	}
 	numIn := tt.NumIn()
 	if tt.IsVariadic() {
 		return strings.ToLower(fmt.Sprintf("*_%s", name))
@@ -0,0 +1,157 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "tuple"
+import "fmt"
+import "errors"
+
+/////////////////////////////////////////////////////////////////////////////
+// Functions
+/////////////////////////////////////////////////////////////////////////////
+
+// A function value, a closure, the code is evaluated in a new scope within the scope
+// the function was declared in so it can refer to the variables there.
+// It can be passed as an argument or stored in a tuple or map like any other value,
+// when printed it looks like the lambda expression that created it.
+type Function struct {
+	name string  // Empty for a lambda
+	params []Tag
+	code Value
+	scope EvalContext
+}
+
+func NewFunction(scope EvalContext, name string, params []Tag, code Value) Function {
+	return Function{name, params, code, scope}
+}
+
+func (function Function) Arity() int { return 3 }
+
+func (function Function) Get(index int) Value {
+	switch index {
+	case 0: return Tag{"lambda"}
+	case 1:
+		params := tuple.NewTuple()
+		for _, param := range function.params {
+			params.Append(param)
+		}
+		return params
+	case 2: return function.code
+	}
+	return tuple.NULL
+}
+
+// Formatted as the lambda it is rather than walking the scope it was defined in.
+func (function Function) String() string {
+	return fmt.Sprintf("(lambda %s %s)", function.Get(1), function.code)
+}
+
+func (function Function) ForallValues(next func(value Value) error) error {
+	for k := 0; k < function.Arity(); k += 1 {
+		if err := next(function.Get(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluates the arguments in the caller's context then applies the function to them.
+func (function Function) Call(context EvalContext, args []Value) (Value, error) {
+	values := make([]Value, len(args))
+	for k, arg := range args {
+		evaluated, err := Eval(context, arg)
+		if err != nil {
+			return nil, err
+		}
+		values[k] = evaluated
+	}
+	return function.Apply(values)
+}
+
+// Applies the function to arguments that have already been evaluated. When compiled, a call
+// of another function whose result would be returned is made here rather than nested within it.
+func (function Function) Apply(values []Value) (Value, error) {
+	global := function.scope.GlobalScope()
+	budget := global.Budget()
+	if err := budget.Call(); err != nil {
+		return tuple.EMPTY, err
+	}
+	defer budget.Return()
+	replaced := []string{}
+	for {
+		if err := function.checkArity(len(values)); err != nil {
+			return tuple.EMPTY, withFrames(err, replaced)
+		}
+		Trace(function.scope, "** FUNC %s argValue: %s", function.name, values)
+		scope := function.scope.NewLocalScope()
+		for k, value := range values {
+			bind(scope, function.params[k].Name, value)
+		}
+		var result Value
+		var err error
+		if global.Mode() == COMPILE {
+			result, err = global.Code().CompileBody(global, function.code)(scope)
+		} else {
+			result, err = Eval(scope, function.code)
+		}
+		call, isTailCall := result.(tailCall)
+		if err != nil || ! isTailCall {
+			return result, withFrames(withFrame(err, function.name), replaced)
+		}
+		replaced = append(replaced, function.name)
+		if len(replaced) > replacedFrames {
+			replaced = replaced[1:]
+		}
+		function, values = call.function, call.values
+	}
+}
+
+func (function Function) checkArity(arity int) error {
+	if arity != len(function.params) {
+		message := fmt.Sprintf("Expected %d arguments not %d", len(function.params), arity)
+		if function.name != "" {
+			message = fmt.Sprintf("For '%s' %s", function.name, message)
+		}
+		return errors.New(message)
+	}
+	return nil
+}
+
+// Binds a name to a value, when the value is a function it can also be called by that name.
+func bind(scope LocalScope, name string, value Value) {
+	scope.Add(name, func () Value { return value })
+	if function, ok := value.(Function); ok {
+		scope.Add(name, function)
+	}
+}
+
+// Splits the values given to 'lambda' or 'func' into the parameter names and code.
+func functionParams(values []Value) ([]Tag, Value, error) {
+	if len(values) == 0 {
+		return nil, nil, errors.New("No code provided for the function")
+	}
+	params := []Tag{}
+	for k, v := range values[:len(values)-1] {
+		param, ok := v.(Tag)
+		if ! ok {
+			message := fmt.Sprintf("Expected identifier not '%s' for arg %d", v, k)
+			return nil, nil, errors.New(message)
+		}
+		params = append(params, param)
+	}
+	return params, values[len(values)-1], nil
+}
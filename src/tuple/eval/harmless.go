@@ -19,8 +19,8 @@ package eval
 import "math"
 import "strings"
 import "reflect"
-import "errors"
 import "tuple"
+import "fmt"
 
 /////////////////////////////////////////////////////////////////////////////
 
@@ -50,41 +50,9 @@ func AddBooleanAndArithmeticFunctions(table LocalScope) {
 	table.Add("atan2", math.Atan2)
 	table.Add("round", math.Round)
 	table.Add("round2", func(value float64) float64 { return math.Round(value*100)/100 }) // Not needed
-	table.Add("**", math.Pow)
 	table.Add("%", func (aa float64) float64 { return aa/100.0 })
-	table.Add("++", func (aa float64) float64 { return aa+1 })
-	table.Add("+", func (aa float64) float64 { return aa })
-	table.Add("-", func (aa float64) float64 { return -aa })
-	table.Add("+", func (aa float64, bb float64) float64 { return aa+bb })
-	table.Add("-", func (aa float64, bb float64) float64 { return aa-bb })
-	table.Add("*", func (aa float64, bb float64) float64 { return aa*bb })
-	table.Add("/", func (aa float64, bb float64) float64 { return aa/bb })
-/*	table.Add("++", func (aa int64) int64 { return aa+1 })
-	table.Add("+", func (aa int64) int64 { return aa })
-	table.Add("-", func (aa int64) int64 { return -aa })
-	table.Add("+", func (aa int64, bb int64) int64 { return aa+bb })
-	table.Add("-", func (aa int64, bb int64) int64 { return aa-bb })
-	table.Add("*", func (aa int64, bb int64) int64 { return aa*bb })
-	table.Add("/", func (aa int64, bb int64) (int64, error) {
-		if bb == 0 {
-			return 0, errors.New("Divide by zero")
-		}
-		return aa/bb, nil
-	})*/
-	table.Add("%", func (context EvalContext, aa int64, bb int64) (int64, error) {
-		if bb == 0 {
-			return 0, errors.New("Divide by zero")
-			//context.Log("ERROR", "divide by zero in: %d %% %d", aa, bb)
-		}
-		return aa%bb, nil
-	})
+	AddIntegerAndFloatFunctions(table)
 	table.Add("streq", func (aa string, bb string) bool { return aa==bb })  // Should take Value as argument
-	table.Add("==", func (aa float64, bb float64) bool { return aa==bb })  // Should take Value as argument
-	table.Add("!=", func (aa float64, bb float64) bool { return aa!=bb })
-	table.Add(">=", func (aa float64, bb float64) bool { return aa>=bb })
-	table.Add("<=", func (aa float64, bb float64) bool { return aa<=bb })
-	table.Add(">", func (aa float64, bb float64) bool { return aa>bb })
-	table.Add("<", func (aa float64, bb float64) bool { return aa<bb })
 	table.Add("&&", func (aa bool, bb bool) bool { return aa&&bb })
 	table.Add("||", func (aa bool, bb bool) bool { return aa||bb })
 	table.Add("!", func (aa bool) bool { return ! aa })
@@ -93,12 +61,15 @@ func AddBooleanAndArithmeticFunctions(table LocalScope) {
 	table.Add("E", func () float64 { return math.E })
 	table.Add("true", func () bool { return true })
 	table.Add("false", func () bool { return false })
+	table.Add("null", func () Value { return tuple.NULL })
 
 }
 
 // String functions that do not allocate any memory
 func AddHarmlessStringFunctions(table LocalScope) {
-	table.Add("len", func(value string) int64 { return int64(len(value)) })  // TODO arity
+	table.Add("len", func(value string) int64 { return int64(len(value)) })
+	table.Add("len", func(value Tuple) int64 { return int64(value.Arity()) })
+	table.Add("len", func(value tuple.Map) int64 { return int64(value.Arity()) })
 	table.Add("lower", strings.ToLower)
 	table.Add("upper", strings.ToUpper)
 }
@@ -171,27 +142,77 @@ func AddHarmlessArrayFunctions(table LocalScope)  {
 		return value.Get(index)
 	})
 
+	// The value of a key in a map, such as the message of an error caught: field message e
+	table.Add("field", func(context EvalContext, key Tag, value tuple.Map) (Value, error) {
+		return fieldOf(key, value)
+	})
+
 	table.Add("istuple", func (context EvalContext, value Value) bool {
-		_, ok := value.(Tuple)
+		_, ok := tuple.AsTuple(value)
 		return ok
 	})
 	table.Add("ismap", func (context EvalContext, value Value) bool {
 		_, ok := value.(tuple.Map)
 		return ok
 	})
+	table.Add("isnull", func (context EvalContext, value Value) bool {
+		_, ok := value.(tuple.Null)
+		return ok
+	})
 	table.Add("typeof", func (context EvalContext, value Value) string {
 		return reflect.TypeOf(value).Name()
 	})
-	table.Add("eq", func (context EvalContext, aa Value, bb Value) bool {
-		if aa.Arity() != bb.Arity() {
-			return false
+	// The signatures of the functions a name calls, such as: overloads "+"
+	table.Add("overloads", func (context EvalContext, quoted Quoted) (Value, error) {
+		lister, ok := context.(overloadLister)
+		if ! ok {
+			return tuple.EMPTY, NewScriptError("notfound", "No functions in this scope")
+		}
+		name := fmt.Sprint(quoted.value)
+		if tag, isTag := quoted.value.(Tag); isTag {
+			name = tag.Name
+		}
+		result := tuple.NewTuple()
+		for _, signature := range lister.overloads(name, map[string]bool{}) {
+			result.Append(String(signature))
 		}
+		return result, nil
+	})
+	table.Add("eq", func (context EvalContext, aa Value, bb Value) bool {
 		//TODO eq ("a1" b2")   1
 		//TODO eq ("a1" b2")   ("a1" b2") 
-		return reflect.DeepEqual(aa, bb)
+		return equal(aa, bb)
 	})
 }
 
+// Tuples and vectors with equal elements are equal, as are maps with equal values for the same keys.
+func equal(aa Value, bb Value) bool {
+	if aa.Arity() != bb.Arity() {
+		return false
+	}
+	listA, isListA := tuple.AsTuple(aa)
+	listB, isListB := tuple.AsTuple(bb)
+	if isListA && isListB {
+		for k, value := range listA.List {
+			if ! equal(value, listB.List[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	mapA, isMapA := aa.(tuple.Map)
+	mapB, isMapB := bb.(tuple.Map)
+	if isMapA && isMapB {
+		same := true
+		mapA.ForallKeyValue(func (key Tag, value Value) {
+			other, err := fieldOf(key, mapB)
+			same = same && err == nil && equal(value, other)
+		})
+		return same
+	}
+	return reflect.DeepEqual(aa, bb)
+}
+
 /////////////////////////////////////////////////////////////////////////////
 
 type ErrorIfFunctionNotFound struct {}
@@ -202,9 +223,22 @@ func NewErrorIfFunctionNotFound() Finder {
 }
 
 func (function * ErrorIfFunctionNotFound) Find(context EvalContext, name Tag, args [] Value) (LocalScope, reflect.Value) {
-	return nil, reflect.ValueOf(func(args... Value) bool {
-		context.Log("ERROR", "function not found: '%s' %s\n", name.Name, args)
-		return false
+	return nil, reflect.ValueOf(func(args... Value) (bool, error) {
+		message := fmt.Sprintf("Function not found: '%s' %s", name.Name, args)
+		return false, NewScriptError("notfound", message)
 	})
 }
 
+func fieldOf(key Tag, value tuple.Map) (Value, error) {
+	var result Value
+	value.ForallKeyValue(func(k Tag, v Value) {
+		if k == key && result == nil {
+			result = v
+		}
+	})
+	if result == nil {
+		message := fmt.Sprintf("No field '%s' in '%s'", key.Name, value)
+		return nil, NewScriptError("notfound", message)
+	}
+	return result, nil
+}
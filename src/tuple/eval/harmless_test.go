@@ -24,6 +24,8 @@ import (
 	"tuple/parsers"
 	"tuple/runner"
 	"math"
+	"fmt"
+	"strings"
 	"math/rand"
 )
 
@@ -162,3 +164,96 @@ func TestTestFunctions(t *testing.T) {
 	test("! (ismap \"a\")")
 	test("eq (nth 1 (11 22 33)) 22")
 }
+
+func TestIntegerArithmetic(t *testing.T) {
+
+	grammar := parsers.NewLispGrammar()
+	test := func (formula string, expected tuple.Value) {
+		val, err := runner.ParseAndEval(safeEvalContext, grammar, formula)
+		if val != expected {
+			t.Errorf("Expected '%s' to be %v got '%v' %v", formula, expected, val, err)
+		}
+	}
+	fails := func (formula string) {
+		if _, err := runner.ParseAndEval(safeEvalContext, grammar, formula); err == nil {
+			t.Errorf("Expected '%s' to fail", formula)
+		}
+	}
+
+	test("(/ 7 2)", Int64(3))
+	test("(/ (- 7) 2)", Int64(-3))
+	test("(% 7 3)", Int64(1))
+	test("(/ 7.0 2)", Float64(3.5))
+	test("(/ 7 2.)", Float64(3.5))
+	test("(** 2 10)", Int64(1024))
+	test("(** 2 (- 1))", Float64(0.5))
+	test("(+ 9007199254740993 0)", Int64(9007199254740993))
+	test("(== 9007199254740993 9007199254740992)", Bool(false))
+	test("(< 3 3.5)", Bool(true))
+	test("(+ true 1)", Int64(2))
+	test("(- 1)", Int64(-1))
+	test("(++ 1)", Int64(2))
+
+	test("(bitand 6 3)", Int64(2))
+	test("(bitor 6 3)", Int64(7))
+	test("(bitxor 6 3)", Int64(5))
+	test("(bitnot 0)", Int64(-1))
+	test("(shl 1 62)", Int64(1 << 62))
+	test("(shr (- 8) 1)", Int64(-4))
+
+	fails("(/ 1 0)")
+	fails("(% 1 0)")
+	fails("(bitand 1.5 1)")
+	fails("(shl 1 (- 1))")
+	fails("(** 2 10000000000)")
+}
+
+func TestExactArithmetic(t *testing.T) {
+
+	grammar := parsers.NewLispGrammar()
+	test := func (formula string, expected string) {
+		val, err := runner.ParseAndEval(safeEvalContext, grammar, formula)
+		if err != nil || fmt.Sprintf("%T %v", val, val) != expected {
+			t.Errorf("Expected '%s' to be %s got '%T %v' %v", formula, expected, val, val, err)
+		}
+	}
+
+	test("(+ 9223372036854775808 1)", "tuple.BigInt 9223372036854775809")
+	test("(- 9223372036854775808 1)", "tuple.Int64 9223372036854775807")
+	test("(* 4611686018427387904 (bigint 2))", "tuple.BigInt 9223372036854775808")
+	test("(+ 9223372036854775807 1)", "tuple.BigInt 9223372036854775808")
+	test("(- (+ 9223372036854775807 1) 1)", "tuple.Int64 9223372036854775807")
+	test("(- (- 9223372036854775807) 2)", "tuple.BigInt -9223372036854775809")
+	test("(* 4611686018427387904 2)", "tuple.BigInt 9223372036854775808")
+	test("(/ (- (- 9223372036854775807) 1) (- 1))", "tuple.BigInt 9223372036854775808")
+	test("(- (- (- 9223372036854775807) 1))", "tuple.BigInt 9223372036854775808")
+	test("(** 2 63)", "tuple.BigInt 9223372036854775808")
+	test("(shl 1 64)", "tuple.BigInt 18446744073709551616")
+	test("(** 2 (bigint 100))", "tuple.BigInt 1267650600228229401496703205376")
+	test("(/ 100000000000000000000 7)", "tuple.BigInt 14285714285714285714")
+	test("(% (- 100000000000000000000) 7)", "tuple.Int64 -2")
+	test("(+ 0.10000000000000000001 1)", "tuple.Decimal 1.10000000000000000001")
+	test("(+ (decimal 0.1) (decimal 0.2))", "tuple.Decimal 0.3")
+	test("(* (decimal 1.5) 9223372036854775808)", "tuple.Decimal 13835058055282163712.0")
+	test("(/ (decimal 1) 3)", "tuple.Decimal 0.33333333333333333333")
+	test("(/ (decimal 2) 3)", "tuple.Decimal 0.66666666666666666667")
+	test("(% (decimal 7.5) 2)", "tuple.Decimal 1.5")
+	test("(** (decimal 1.1) 2)", "tuple.Decimal 1.21")
+	test("(- (decimal 0.5))", "tuple.Decimal -0.5")
+	test("(+ (decimal 0.5) 0.25)", "tuple.Float64 0.75")
+	test("(> 9223372036854775808 9223372036854775807)", "tuple.Bool true")
+	test("(== (decimal 0.5) (bigint 0))", "tuple.Bool false")
+	test("(< 0.10000000000000000001 0.10000000000000000002)", "tuple.Bool true")
+	test("(bitand 18446744073709551615 255)", "tuple.Int64 255")
+	test("(decimal \"12.50\")", "tuple.Decimal 12.5")
+	test("(bigint \"18446744073709551616\")", "tuple.BigInt 18446744073709551616")
+
+	if _, err := runner.ParseAndEval(safeEvalContext, grammar, "(/ (decimal 1) 0)"); err == nil {
+		t.Errorf("Expected decimal divide by zero to fail")
+	}
+	for _, formula := range []string{"(+ (quote (1 2)) 1)", "(bitand (quote (1 2)) 1)", "(bigint (quote (1 2)))", "(decimal (quote (1 2)))"} {
+		if _, err := runner.ParseAndEval(safeEvalContext, grammar, formula); err == nil || strings.Contains(err.Error(), "%!") {
+			t.Errorf("Expected '%s' to fail with a readable message got %v", formula, err)
+		}
+	}
+}
@@ -80,8 +80,15 @@ func Pipe(writer string, reader string) bool {
 }
 
 func executeProcess(arg string, args... string) bool {
+	err := runProcess(arg, args...)
+	if err != nil {
+		log.Printf("Command finished with error: %v", err)
+		return false
+	}
+	return true
+}
 
-
+func runProcess(arg string, args... string) error {
 	cmd := exec.Command(arg, args...)
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
@@ -89,17 +96,21 @@ func executeProcess(arg string, args... string) bool {
 
 	err := cmd.Run()
 	if err != nil {
-		log.Printf("Command finished with error: %v", err)
-		return false
+		return err
 	}
 	outStr := string(stdout.Bytes())
 	fmt.Print(outStr)
-	return true
+	return nil
 }
 
 // TODO sort out variadic arguments
-func executeProcess0(arg string) bool {
-	return executeProcess(arg)
+// A failed command is an error of kind 'exec' which a script can catch.
+func executeProcess0(arg string) (bool, error) {
+	if err := runProcess(arg); err != nil {
+		message := fmt.Sprintf("Command '%s' failed: %s", arg, err)
+		return false, NewScriptError("exec", message)
+	}
+	return true, nil
 }
 
 
@@ -200,7 +211,7 @@ func (_ * Os) GetKeyValue(index int) (Tag,Value) {
 			return Tag{""}, String("")  // TODO Report error
 		}
 		return Tag{"host"}, String(host)
-	default: return Tag{""}, tuple.EMPTY
+	default: return Tag{""}, tuple.NULL
 	}
 }	
 
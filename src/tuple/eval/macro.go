@@ -0,0 +1,190 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "tuple"
+import "errors"
+import "fmt"
+
+/////////////////////////////////////////////////////////////////////////////
+// Macros
+/////////////////////////////////////////////////////////////////////////////
+
+// A macro is called with its arguments unevaluated, its code builds the code that is evaluated in
+// place of the call. The code is expanded once for each place the macro is called, the arguments
+// are identified by their underlying storage as for compiled code.
+//
+//   macro unless condition code { quasiquote (if (unquote condition) () (unquote code)) }
+//
+// In the Lisp grammar `, , and ,@ are short for quasiquote, unquote and unquote_splicing:
+//
+//   (macro unless condition code `(if ,condition () ,code))
+type Macro struct {
+	function Function
+	expansions codeTable
+}
+
+func NewMacro(scope EvalContext, name string, params []Tag, code Value) Macro {
+	return Macro{NewFunction(scope, name, params, code), newCodeTable()}
+}
+
+func (macro Macro) Arity() int { return 3 }
+
+func (macro Macro) Get(index int) Value {
+	if index == 0 {
+		return Tag{"macro"}
+	}
+	return macro.function.Get(index)
+}
+
+func (macro Macro) String() string {
+	return fmt.Sprintf("(macro %s %s)", macro.function.Get(1), macro.function.code)
+}
+
+func (macro Macro) ForallValues(next func(value Value) error) error {
+	for k := 0; k < macro.Arity(); k += 1 {
+		if err := next(macro.Get(k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The code the macro expands to when called with the arguments.
+func (macro Macro) Expand(args []Value) (Value, error) {
+	if len(args) == 0 {
+		return macro.function.Apply(args)
+	}
+	call := tuple.NewTuple(args...)
+	if expansion, ok := macro.expansions.find(call); ok {
+		return expansion.(Value), nil
+	}
+	expansion, err := macro.function.Apply(args)
+	if err != nil {
+		return tuple.EMPTY, err
+	}
+	macro.expansions.add(call, expansion)
+	return expansion, nil
+}
+
+// Expands the macro then evaluates the code in the caller's context.
+func (macro Macro) Call(context EvalContext, args []Value) (Value, error) {
+	expansion, err := macro.Expand(args)
+	if err != nil {
+		return tuple.EMPTY, err
+	}
+	return Eval(context, expansion)
+}
+
+// Expands the expression until it is not a call of a macro.
+func MacroExpand(context EvalContext, expression Value) (Value, error) {
+	for {
+		call, ok := expression.(Tuple)
+		if ! ok || call.Arity() == 0 {
+			return expression, nil
+		}
+		head, ok := call.Get(0).(Tag)
+		if ! ok {
+			return expression, nil
+		}
+		args := call.List[1:]
+		_, f := context.Find(context, head, args)
+		if f.Type() != MacroType {
+			return expression, nil
+		}
+		expanded, err := f.Interface().(Macro).Expand(args)
+		if err != nil {
+			return tuple.EMPTY, err
+		}
+		expression = expanded
+	}
+}
+
+// Copies the template evaluating what is unquoted.
+func quasiQuote(context EvalContext, template Value) (Value, error) {
+	list, ok := template.(Tuple)
+	if ! ok || list.Arity() == 0 {
+		return template, nil
+	}
+	if isCallOf(list, "unquote") {
+		return Eval(context, list.Get(1))
+	}
+	result := tuple.NewTuple()
+	for _, value := range list.List {
+		element, ok := value.(Tuple)
+		if ok && isCallOf(element, "unquote_splicing") {
+			spliced, err := Eval(context, element.Get(1))
+			if err != nil {
+				return tuple.EMPTY, err
+			}
+			values, ok := tuple.AsTuple(spliced)
+			if ! ok {
+				return tuple.EMPTY, errors.New(fmt.Sprintf("Expected a tuple to splice not '%v'", spliced))
+			}
+			result.List = append(result.List, values.List...)
+			continue
+		}
+		copied, err := quasiQuote(context, value)
+		if err != nil {
+			return tuple.EMPTY, err
+		}
+		result.Append(copied)
+	}
+	// Errors in the expanded code are reported where it was written
+	locations := context.GlobalScope().Locations()
+	if location, ok := locations.Find(list); ok {
+		locations.Add(result, location)
+	}
+	return result, context.GlobalScope().Budget().AllocateValue(result)
+}
+
+func isCallOf(list Tuple, name string) bool {
+	head, ok := list.Get(0).(Tag)
+	return ok && list.Arity() == 2 && head.Name == name
+}
+
+func AddMacroFunctions(table LocalScope) {
+
+	// Declares a macro, the arguments of a call are bound to the parameters unevaluated.
+	macro := func(context EvalContext, values... Value) (Value, error) {
+		if len(values) <= 1 {
+			return tuple.EMPTY, errors.New("No name or code provided for the macro")
+		}
+		tag, ok := values[0].(Tag)
+		if ! ok {
+			return tuple.EMPTY, errors.New(fmt.Sprintf("Expected macro name not '%s'", values[0]))
+		}
+		params, code, err := functionParams(values[1:])
+		if err != nil {
+			return tuple.EMPTY, err
+		}
+		context.Add(tag.Name, NewMacro(context, tag.Name, params, code))
+		return tag, nil
+	}
+	table.Add("macro", macro)
+	table.Add("defmacro", macro)
+
+	table.Add("quote", func(value Quoted) Value {
+		return value.Value()
+	})
+	table.Add("quasiquote", func(context EvalContext, template Quoted) (Value, error) {
+		return quasiQuote(context, template.Value())
+	})
+	table.Add("macroexpand", func(context EvalContext, expression Value) (Value, error) {
+		return MacroExpand(context, expression)
+	})
+}
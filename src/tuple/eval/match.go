@@ -0,0 +1,201 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "reflect"
+import "fmt"
+import "tuple"
+
+/////////////////////////////////////////////////////////////////////////////
+//  Pattern matching
+/////////////////////////////////////////////////////////////////////////////
+
+// Matches a value against an unevaluated pattern, which is one of:
+//   _                the value is ignored
+//   name             the value is bound to the name, a name used twice must match equal values
+//   1 "a"            a number or string equal to it
+//   (quote name)     the tag itself
+//   (is Type p)      a value of the type given by typeof, or any Number, Map or Array, matching p
+//   (p1 p2)          a tuple with as many values each matching the pattern in the same position
+//   (p1 ... rest)    a tuple with at least as many values, the rest bound to a tuple if named
+//   {key: p}         a map with each of the keys whose value matches its pattern
+// The names bound are returned only if the whole pattern matches.
+func Match(pattern Value, value Value) (map[string]Value, bool, error) {
+	bindings := map[string]Value{}
+	matched, err := match(pattern, value, bindings)
+	if err != nil || ! matched {
+		return nil, false, err
+	}
+	return bindings, true, nil
+}
+
+var ELLIPSIS = Tag{"..."}
+
+func match(pattern Value, value Value, bindings map[string]Value) (bool, error) {
+	switch pattern := pattern.(type) {
+	case Tag:
+		if pattern.Name == "_" {
+			return true, nil
+		}
+		if bound, ok := bindings[pattern.Name]; ok {
+			return reflect.DeepEqual(bound, value), nil
+		}
+		bindings[pattern.Name] = value
+		return true, nil
+	case Tuple:
+		if head, ok := pattern.Get(0).(Tag); ok && pattern.Arity() > 1 {
+			switch head.Name {
+			case "quote": return pattern.Arity() == 2 && reflect.DeepEqual(pattern.Get(1), value), nil
+			case "is": return matchType(pattern, value, bindings)
+			}
+		}
+		return matchTuple(pattern, value, bindings)
+	case tuple.Map:
+		mapp, ok := value.(tuple.Map)
+		if ! ok {
+			return false, nil
+		}
+		matched := true
+		var err error
+		pattern.ForallKeyValue(func(key Tag, valuePattern Value) {
+			if ! matched || err != nil {
+				return
+			}
+			field, notFound := fieldOf(key, mapp)
+			if notFound != nil {
+				matched = false
+				return
+			}
+			matched, err = match(valuePattern, field, bindings)
+		})
+		return matched, err
+	}
+	return reflect.DeepEqual(pattern, value), nil
+}
+
+func matchType(pattern Tuple, value Value, bindings map[string]Value) (bool, error) {
+	typ, ok := pattern.Get(1).(Tag)
+	if ! ok || pattern.Arity() != 3 {
+		return false, NewScriptError("match", fmt.Sprintf("Expected (is Type pattern) not '%v'", pattern))
+	}
+	if ! isOfType(typ.Name, value) {
+		return false, nil
+	}
+	return match(pattern.Get(2), value, bindings)
+}
+
+func isOfType(name string, value Value) bool {
+	switch name {
+	case "Number":
+		switch value.(type) {
+		case Int64, Float64, tuple.BigInt, tuple.Decimal: return true
+		}
+		return false
+	case "Map":
+		_, ok := value.(tuple.Map)
+		return ok
+	case "Array":
+		_, ok := value.(tuple.Array)
+		return ok
+	}
+	return reflect.TypeOf(value).Name() == name
+}
+
+func matchTuple(pattern Tuple, value Value, bindings map[string]Value) (bool, error) {
+	values, ok := tuple.AsTuple(value)
+	if ! ok {
+		return false, nil
+	}
+	fixed := pattern.List
+	var rest Value
+	for k, element := range pattern.List {
+		if element != ELLIPSIS {
+			continue
+		}
+		fixed = pattern.List[:k]
+		switch len(pattern.List) - k {
+		case 1:
+		case 2: rest = pattern.List[k + 1]
+		default:
+			return false, NewScriptError("match", fmt.Sprintf("Expected at most one name after '...' in '%v'", pattern))
+		}
+		break
+	}
+	if len(values.List) < len(fixed) || (len(fixed) == len(pattern.List) && len(values.List) != len(fixed)) {
+		return false, nil
+	}
+	for k, element := range fixed {
+		if matched, err := match(element, values.List[k], bindings); err != nil || ! matched {
+			return false, err
+		}
+	}
+	if rest != nil {
+		return match(rest, tuple.NewTuple(values.List[len(fixed):]...), bindings)
+	}
+	return true, nil
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// Evaluates the code of the first case whose pattern matches in a scope with the names it binds:
+//   match p {
+//      case (x y) (x+y)
+//      case _ 0
+//   }
+func MatchCases(context EvalContext, value Value, cases Quoted) (Value, error) {
+	clauses := []Value{cases.value}
+	if list, ok := cases.value.(Tuple); ok && ! isCase(list) {
+		clauses = list.List
+	}
+	for _, clause := range clauses {
+		list, ok := clause.(Tuple)
+		if ! ok || ! isCase(list) || list.Arity() != 3 {
+			return tuple.EMPTY, NewScriptError("match", fmt.Sprintf("Expected (case pattern code) not '%v'", clause))
+		}
+		bindings, matched, err := Match(list.Get(1), value)
+		if err != nil {
+			return tuple.EMPTY, err
+		}
+		if matched {
+			scope := context.NewLocalScope()
+			for name, bound := range bindings {
+				bind(scope, name, bound)
+			}
+			return Eval(scope, list.Get(2))
+		}
+	}
+	return tuple.EMPTY, NewScriptError("match", fmt.Sprintf("No case matches '%v'", value))
+}
+
+func isCase(list Tuple) bool {
+	return list.Arity() > 0 && list.Get(0) == Tag{"case"}
+}
+
+// Binds the names in a pattern to the parts of the value it matches: (a b) = pair
+func Destructure(context EvalContext, pattern Value, value Value) (Value, error) {
+	bindings, matched, err := Match(pattern, value)
+	if err != nil {
+		return tuple.EMPTY, err
+	}
+	if ! matched {
+		return tuple.EMPTY, NewScriptError("match", fmt.Sprintf("Cannot assign '%v' to '%v'", value, pattern))
+	}
+	for name, bound := range bindings {
+		bind(context, name, bound)
+	}
+	return value, nil
+}
@@ -0,0 +1,491 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "tuple"
+import "fmt"
+import "errors"
+import "math"
+import "math/big"
+
+type BigInt = tuple.BigInt
+type Decimal = tuple.Decimal
+
+/////////////////////////////////////////////////////////////////////////////
+// Numeric tower
+/////////////////////////////////////////////////////////////////////////////
+
+// Numbers are promoted up the tower: Int64, BigInt, Decimal then Float64, so an operation
+// on an Int64 and a Decimal is exact while any float makes the result a float.
+// Arithmetic on Int64s stays Int64 and division truncates, a result that overflows is a BigInt
+// rather than wrapping around and BigInt results that fit are Int64s again. Booleans count as 0 or 1.
+const (
+	integerRank = iota
+	bigRank
+	decimalRank
+	floatRank
+)
+
+type number struct {
+	rank int
+	integer int64
+	big *big.Int
+	decimal Decimal
+	float float64
+}
+
+func toNumber(value Value) (number, error) {
+	switch value := value.(type) {
+	case Int64: return number{rank: integerRank, integer: int64(value)}, nil
+	case BigInt: return number{rank: bigRank, big: value.Int()}, nil
+	case Decimal: return number{rank: decimalRank, decimal: value}, nil
+	case Float64: return number{rank: floatRank, float: float64(value)}, nil
+	case Bool: return number{rank: integerRank, integer: tuple.BoolToInt(value)}, nil
+	}
+	message := fmt.Sprintf("Expected a number not '%v'", value)
+	return number{}, errors.New(message)
+}
+
+// Promotes a number to a higher rank.
+func (a number) to(rank int) number {
+	for a.rank < rank {
+		switch a.rank {
+		case integerRank: a = number{rank: bigRank, big: big.NewInt(a.integer)}
+		case bigRank: a = number{rank: decimalRank, decimal: tuple.NewDecimal(a.big, 0)}
+		case decimalRank: a = number{rank: floatRank, float: a.decimal.Float64()}
+		}
+	}
+	return a
+}
+
+// Promotes both numbers to the higher of their ranks.
+func toNumbers(aa Value, bb Value) (number, number, error) {
+	a, err := toNumber(aa)
+	if err != nil {
+		return a, a, err
+	}
+	b, err := toNumber(bb)
+	if err != nil {
+		return a, b, err
+	}
+	if a.rank < b.rank {
+		a = a.to(b.rank)
+	} else {
+		b = b.to(a.rank)
+	}
+	return a, b, nil
+}
+
+func (a number) value() Value {
+	switch a.rank {
+	case integerRank: return Int64(a.integer)
+	case bigRank: return tuple.IntegerFromBig(a.big)
+	case decimalRank: return a.decimal
+	}
+	return Float64(a.float)
+}
+
+func (a number) rat() *big.Rat {
+	switch a.rank {
+	case integerRank: return new(big.Rat).SetInt64(a.integer)
+	case bigRank: return new(big.Rat).SetInt(a.big)
+	}
+	return a.decimal.Rat()
+}
+
+// An Int64 result that does not fit, apply repeats the operation on BigInts.
+type overflowError struct {
+	error
+}
+
+func overflow(a int64, operator string, b int64) error {
+	message := fmt.Sprintf("Integer overflow: %d %s %d", a, operator, b)
+	return overflowError{errors.New(message)}
+}
+
+var errDivideByZero = errors.New("Divide by zero")
+
+// An operation at each rank of the tower, a nil operation is not supported at that rank.
+type operation struct {
+	name string
+	integer func(a int64, b int64) (int64, error)
+	big func(a *big.Int, b *big.Int) (*big.Int, error)
+	decimal func(a Decimal, b Decimal) (Decimal, error)
+	float func(a float64, b float64) float64
+}
+
+func (op operation) apply(aa Value, bb Value) (Value, error) {
+	a, b, err := toNumbers(aa, bb)
+	if err != nil {
+		return nil, err
+	}
+	if a.rank == integerRank && op.integer != nil {
+		result, err := op.integer(a.integer, b.integer)
+		if err == nil {
+			return Int64(result), nil
+		}
+		if _, overflowed := err.(overflowError); ! overflowed || op.big == nil {
+			return nil, err
+		}
+	}
+	switch {
+	case a.rank <= bigRank && op.big != nil:
+		a, b = a.to(bigRank), b.to(bigRank)
+		a.big, err = op.big(a.big, b.big)
+	case a.rank == decimalRank && op.decimal != nil:
+		a.decimal, err = op.decimal(a.decimal, b.decimal)
+	case a.rank == floatRank && op.float != nil:
+		a.float = op.float(a.float, b.float)
+	default:
+		message := fmt.Sprintf("Expected integers for '%s' not '%v' and '%v'", op.name, aa, bb)
+		return nil, errors.New(message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.value(), nil
+}
+
+func comparison(intOp func(a int64, b int64) bool, floatOp func(a float64, b float64) bool) func (aa Value, bb Value) (bool, error) {
+	return func (aa Value, bb Value) (bool, error) {
+		a, b, err := toNumbers(aa, bb)
+		switch {
+		case err != nil: return false, err
+		case a.rank == integerRank: return intOp(a.integer, b.integer), nil
+		case a.rank == floatRank: return floatOp(a.float, b.float), nil
+		}
+		return intOp(int64(a.rat().Cmp(b.rat())), 0), nil
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+func add(a int64, b int64) (int64, error) {
+	c := a + b
+	if (c > a) != (b > 0) {
+		return 0, overflow(a, "+", b)
+	}
+	return c, nil
+}
+
+func subtract(a int64, b int64) (int64, error) {
+	c := a - b
+	if (c < a) != (b > 0) {
+		return 0, overflow(a, "-", b)
+	}
+	return c, nil
+}
+
+func multiply(a int64, b int64) (int64, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, overflow(a, "*", b)
+	}
+	return c, nil
+}
+
+func divide(a int64, b int64) (int64, error) {
+	switch {
+	case b == 0: return 0, errDivideByZero
+	case a == math.MinInt64 && b == -1: return 0, overflow(a, "/", b)
+	}
+	return a / b, nil
+}
+
+func modulo(a int64, b int64) (int64, error) {
+	if b == 0 {
+		return 0, errDivideByZero
+	}
+	if b == -1 {
+		return 0, nil
+	}
+	return a % b, nil
+}
+
+func shift(a int64, b int64, left bool) (int64, error) {
+	if b < 0 {
+		message := fmt.Sprintf("Negative shift count: %d", b)
+		return 0, errors.New(message)
+	}
+	if ! left {
+		if b > 63 {
+			b = 63
+		}
+		return a >> uint64(b), nil
+	}
+	if b > 63 || (a << uint64(b)) >> uint64(b) != a {
+		return 0, overflow(a, "shl", b)
+	}
+	return a << uint64(b), nil
+}
+
+func bigShift(a *big.Int, b *big.Int, left bool) (*big.Int, error) {
+	if b.Sign() < 0 || ! b.IsInt64() || b.Int64() > math.MaxUint32 {
+		message := fmt.Sprintf("Invalid shift count: %s", b)
+		return nil, errors.New(message)
+	}
+	if left {
+		return new(big.Int).Lsh(a, uint(b.Int64())), nil
+	}
+	return new(big.Int).Rsh(a, uint(b.Int64())), nil
+}
+
+func bigDivide(a *big.Int, b *big.Int) (*big.Int, error) {
+	if b.Sign() == 0 {
+		return nil, errDivideByZero
+	}
+	return new(big.Int).Quo(a, b), nil
+}
+
+func bigModulo(a *big.Int, b *big.Int) (*big.Int, error) {
+	if b.Sign() == 0 {
+		return nil, errDivideByZero
+	}
+	return new(big.Int).Rem(a, b), nil
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// The number of digits after the decimal point when dividing decimals does not give an exact result.
+const decimalDivisionScale = 20
+
+// Aligns two decimals to the same scale.
+func aligned(a Decimal, b Decimal) (*big.Int, *big.Int, int) {
+	scale := a.Scale()
+	if b.Scale() > scale {
+		scale = b.Scale()
+	}
+	return rescale(a, scale), rescale(b, scale), scale
+}
+
+func rescale(a Decimal, scale int) *big.Int {
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale - a.Scale())), nil)
+	return factor.Mul(factor, a.Unscaled())
+}
+
+func decimalAdd(a Decimal, b Decimal) (Decimal, error) {
+	x, y, scale := aligned(a, b)
+	return tuple.NewDecimal(x.Add(x, y), scale), nil
+}
+
+func decimalSubtract(a Decimal, b Decimal) (Decimal, error) {
+	x, y, scale := aligned(a, b)
+	return tuple.NewDecimal(x.Sub(x, y), scale), nil
+}
+
+func decimalMultiply(a Decimal, b Decimal) (Decimal, error) {
+	product := new(big.Int).Mul(a.Unscaled(), b.Unscaled())
+	return tuple.NewDecimal(product, a.Scale() + b.Scale()), nil
+}
+
+// Rounds half to even when the quotient needs more digits than the scale allows.
+func decimalDivide(a Decimal, b Decimal) (Decimal, error) {
+	if b.Unscaled().Sign() == 0 {
+		return Decimal{}, errDivideByZero
+	}
+	scale := decimalDivisionScale
+	for _, s := range []int{a.Scale(), b.Scale()} {
+		if s > scale {
+			scale = s
+		}
+	}
+	quotient := new(big.Rat).Quo(a.Rat(), b.Rat())
+	numerator := new(big.Int).Mul(quotient.Num(), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	denominator := quotient.Denom()
+	unscaled, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	twice := new(big.Int).Abs(remainder)
+	twice.Lsh(twice, 1)
+	if compared := twice.Cmp(denominator); compared > 0 || (compared == 0 && unscaled.Bit(0) == 1) {
+		if numerator.Sign() < 0 {
+			unscaled.Sub(unscaled, big.NewInt(1))
+		} else {
+			unscaled.Add(unscaled, big.NewInt(1))
+		}
+	}
+	return tuple.NewDecimal(unscaled, scale), nil
+}
+
+// The remainder has the sign of the dividend as for integers.
+func decimalModulo(a Decimal, b Decimal) (Decimal, error) {
+	x, y, scale := aligned(a, b)
+	if y.Sign() == 0 {
+		return Decimal{}, errDivideByZero
+	}
+	return tuple.NewDecimal(x.Rem(x, y), scale), nil
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// A negative or fractional exponent gives a float, otherwise integers and decimals stay exact.
+func power(aa Value, bb Value) (Value, error) {
+	a, err := toNumber(aa)
+	if err != nil {
+		return nil, err
+	}
+	b, err := toNumber(bb)
+	if err != nil {
+		return nil, err
+	}
+	if a.rank == floatRank || b.rank > bigRank || b.to(bigRank).big.Sign() < 0 {
+		return Float64(math.Pow(a.to(floatRank).float, b.to(floatRank).float)), nil
+	}
+	exponent := b.to(bigRank).big
+	if b.rank > a.rank {
+		a = a.to(b.rank)
+	}
+	if a.rank == integerRank && exponent.IsInt64() {
+		if result, err := integerPower(a.integer, exponent.Int64()); err == nil {
+			return Int64(result), nil
+		}
+	}
+	if ! exponent.IsInt64() || exponent.Int64() > math.MaxInt32 {
+		message := fmt.Sprintf("Exponent too large: %s", exponent)
+		return nil, errors.New(message)
+	}
+	if a.rank <= bigRank {
+		return tuple.IntegerFromBig(new(big.Int).Exp(a.to(bigRank).big, exponent, nil)), nil
+	}
+	unscaled := new(big.Int).Exp(a.decimal.Unscaled(), exponent, nil)
+	return tuple.NewDecimal(unscaled, a.decimal.Scale() * int(exponent.Int64())), nil
+}
+
+func integerPower(base int64, exponent int64) (int64, error) {
+	result := int64(1)
+	var err error
+	for ; exponent > 0; exponent >>= 1 {
+		if exponent & 1 == 1 {
+			if result, err = multiply(result, base); err != nil {
+				return 0, err
+			}
+		}
+		if exponent > 1 {
+			if base, err = multiply(base, base); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return result, nil
+}
+
+func negate(aa Value) (Value, error) {
+	return subtraction.apply(Int64(0), aa)
+}
+
+var addition = operation{"+", add,
+	func (a *big.Int, b *big.Int) (*big.Int, error) { return new(big.Int).Add(a, b), nil },
+	decimalAdd,
+	func (a float64, b float64) float64 { return a+b }}
+var subtraction = operation{"-", subtract,
+	func (a *big.Int, b *big.Int) (*big.Int, error) { return new(big.Int).Sub(a, b), nil },
+	decimalSubtract,
+	func (a float64, b float64) float64 { return a-b }}
+var multiplication = operation{"*", multiply,
+	func (a *big.Int, b *big.Int) (*big.Int, error) { return new(big.Int).Mul(a, b), nil },
+	decimalMultiply,
+	func (a float64, b float64) float64 { return a*b }}
+var division = operation{"/", divide, bigDivide, decimalDivide,
+	func (a float64, b float64) float64 { return a/b }}
+var remainder = operation{"%", modulo, bigModulo, decimalModulo, math.Mod}
+
+func bitwise(name string, intOp func(a int64, b int64) (int64, error), bigOp func(a *big.Int, b *big.Int) (*big.Int, error)) func (aa Value, bb Value) (Value, error) {
+	return operation{name, intOp, bigOp, nil, nil}.apply
+}
+
+func AddIntegerAndFloatFunctions(table LocalScope) {
+	table.Add("+", addition.apply)
+	table.Add("-", subtraction.apply)
+	table.Add("*", multiplication.apply)
+	table.Add("/", division.apply)
+	table.Add("%", remainder.apply)
+	table.Add("**", power)
+
+	table.Add("+", func (aa Value) (Value, error) {
+		_, err := toNumber(aa)
+		return aa, err
+	})
+	table.Add("-", negate)
+	table.Add("++", func (aa Value) (Value, error) {
+		return addition.apply(aa, Int64(1))
+	})
+
+	table.Add("==", comparison(func (a int64, b int64) bool { return a==b }, func (a float64, b float64) bool { return a==b }))
+	table.Add("!=", comparison(func (a int64, b int64) bool { return a!=b }, func (a float64, b float64) bool { return a!=b }))
+	table.Add(">=", comparison(func (a int64, b int64) bool { return a>=b }, func (a float64, b float64) bool { return a>=b }))
+	table.Add("<=", comparison(func (a int64, b int64) bool { return a<=b }, func (a float64, b float64) bool { return a<=b }))
+	table.Add(">", comparison(func (a int64, b int64) bool { return a>b }, func (a float64, b float64) bool { return a>b }))
+	table.Add("<", comparison(func (a int64, b int64) bool { return a<b }, func (a float64, b float64) bool { return a<b }))
+
+	// Bitwise operators, named as '|' and '&' are used by the shell grammar.
+	table.Add("bitand", bitwise("bitand",
+		func (a int64, b int64) (int64, error) { return a&b, nil },
+		func (a *big.Int, b *big.Int) (*big.Int, error) { return new(big.Int).And(a, b), nil }))
+	table.Add("bitor", bitwise("bitor",
+		func (a int64, b int64) (int64, error) { return a|b, nil },
+		func (a *big.Int, b *big.Int) (*big.Int, error) { return new(big.Int).Or(a, b), nil }))
+	table.Add("bitxor", bitwise("bitxor",
+		func (a int64, b int64) (int64, error) { return a^b, nil },
+		func (a *big.Int, b *big.Int) (*big.Int, error) { return new(big.Int).Xor(a, b), nil }))
+	table.Add("shl", bitwise("shl",
+		func (a int64, b int64) (int64, error) { return shift(a, b, true) },
+		func (a *big.Int, b *big.Int) (*big.Int, error) { return bigShift(a, b, true) }))
+	table.Add("shr", bitwise("shr",
+		func (a int64, b int64) (int64, error) { return shift(a, b, false) },
+		func (a *big.Int, b *big.Int) (*big.Int, error) { return bigShift(a, b, false) }))
+	table.Add("bitnot", func (aa Value) (Value, error) {
+		return bitwise("bitnot", nil, func (a *big.Int, b *big.Int) (*big.Int, error) { return new(big.Int).Not(a), nil })(aa, Int64(0))
+	})
+
+	// Exact numbers, for instance: decimal "0.1" or bigint "123456789012345678901234567890"
+	table.Add("bigint", toBigInt)
+	table.Add("decimal", toDecimal)
+}
+
+func toBigInt(value Value) (Value, error) {
+	if text, ok := value.(String); ok {
+		if result, ok := tuple.IntegerFromString(string(text), 10); ok {
+			value = result
+		}
+	}
+	switch value.(type) {
+	case Int64: return tuple.NewBigInt(big.NewInt(int64(value.(Int64)))), nil
+	case BigInt: return value, nil
+	}
+	message := fmt.Sprintf("Cannot convert '%v' to a bigint", value)
+	return nil, errors.New(message)
+}
+
+// A float is converted from its shortest representation, so decimal 0.1 is exactly 0.1.
+func toDecimal(value Value) (Value, error) {
+	text := ""
+	switch value := value.(type) {
+	case String: text = string(value)
+	case Float64: text = tuple.Float64ToString(value)
+	case Decimal: return value, nil
+	default:
+		if number, err := toNumber(value); err == nil && number.rank < decimalRank {
+			return number.to(decimalRank).decimal, nil
+		}
+	}
+	if result, ok := tuple.ParseDecimal(text); ok {
+		return result, nil
+	}
+	message := fmt.Sprintf("Cannot convert '%v' to a decimal", value)
+	return nil, errors.New(message)
+}
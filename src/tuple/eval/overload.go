@@ -0,0 +1,246 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "reflect"
+import "fmt"
+import "sort"
+import "strconv"
+import "strings"
+import "tuple"
+
+// Builtins with the same name and number of parameters but different parameter types,
+// such as '+' for integers and for strings. The one called is chosen by the types of the
+// evaluated arguments, so unlike other builtins each argument is always evaluated.
+type Overloads struct {
+	name string
+	functions []reflect.Value
+}
+
+// How well an argument matches a parameter, best first.
+const (
+	exactMatch = iota  // The same type, a golang type of the same kind or an interface it implements
+	promotion  // One number converted to another as by Convert, for example an Int64 to a float64
+	anyValue  // The parameter is a Value
+	noMatch  // Including conversions that are not between numbers, such as an Int64 to a string
+)
+
+// Adds a function to a name, it replaces one with the same parameters otherwise both are kept.
+// Functions taking a quoted argument need it unevaluated so are never overloaded.
+func overload(name string, existing reflect.Value, function reflect.Value) reflect.Value {
+	typ := function.Type()
+	if ! existing.IsValid() || typ.IsVariadic() || takesQuoted(typ) {
+		return function
+	}
+	overloads := Overloads{name: name}
+	if existing.Type() == OverloadsType {
+		overloads = existing.Interface().(Overloads)
+	} else if ! takesQuoted(existing.Type()) {
+		overloads.functions = []reflect.Value{existing}
+	}
+	functions := []reflect.Value{}
+	for _, f := range overloads.functions {
+		if ! sameParameters(f.Type(), typ) {
+			functions = append(functions, f)
+		}
+	}
+	if len(functions) == 0 {
+		return function
+	}
+	return reflect.ValueOf(Overloads{name, append(functions, function)})
+}
+
+func takesQuoted(typ reflect.Type) bool {
+	for _, kind := range planOf(typ).kinds {
+		if kind == quotedArg {
+			return true
+		}
+	}
+	return false
+}
+
+func sameParameters(aa reflect.Type, bb reflect.Type) bool {
+	return reflect.DeepEqual(planOf(aa).types, planOf(bb).types)
+}
+
+func matchOf(value Value, expected reflect.Type) int {
+	actual := reflect.TypeOf(value)
+	switch {
+	case expected == ValueType: return anyValue
+	case actual == expected: return exactMatch
+	case expected.Kind() == reflect.Interface && actual.Implements(expected): return exactMatch
+	}
+	if _, ok := conversions.functions[actual.Name() + " " + expected.Name()]; ok {
+		switch {
+		case actual.Kind() == expected.Kind(): return exactMatch
+		case isNumber(actual) && isNumber(expected): return promotion
+		}
+	}
+	return noMatch
+}
+
+func isNumber(typ reflect.Type) bool {
+	switch typ {
+	case reflect.TypeOf(tuple.BigInt{}), reflect.TypeOf(tuple.Decimal{}): return true
+	}
+	return typ.Kind() == reflect.Int64 || typ.Kind() == reflect.Float64
+}
+
+// Whether a function's arguments all match at least as well as another's and one matches better.
+func better(aa []int, bb []int) bool {
+	strictly := false
+	for k := range aa {
+		if aa[k] > bb[k] {
+			return false
+		}
+		strictly = strictly || aa[k] < bb[k]
+	}
+	return strictly
+}
+
+// Chooses the function that matches the arguments better than all the others that match.
+func (overloads Overloads) Resolve(values []Value) (reflect.Value, error) {
+	candidates := []reflect.Value{}
+	ranks := [][]int{}
+	for _, f := range overloads.functions {
+		plan := planOf(f.Type())
+		rank := make([]int, len(values))
+		matches := true
+		for k, value := range values {
+			rank[k] = matchOf(value, plan.types[k])
+			matches = matches && rank[k] != noMatch
+		}
+		if ! matches {
+			continue
+		}
+		candidates = append(candidates, f)
+		ranks = append(ranks, rank)
+	}
+	for k, f := range candidates {
+		best := true
+		for j := range candidates {
+			if j != k && ! better(ranks[k], ranks[j]) {
+				best = false
+				break
+			}
+		}
+		if best {
+			return f, nil
+		}
+	}
+	types := []string{}
+	for _, value := range values {
+		types = append(types, reflect.TypeOf(value).Name())
+	}
+	if len(candidates) == 0 {
+		message := fmt.Sprintf("No overload of '%s' takes (%s)", overloads.name, strings.Join(types, ", "))
+		return reflect.Value{}, NewScriptError("notfound", message)
+	}
+	signatures := []string{}
+	for _, f := range candidates {
+		signatures = append(signatures, signatureOf(overloads.name, f))
+	}
+	message := fmt.Sprintf("Ambiguous call of '%s' with (%s) could be any of: %s", overloads.name, strings.Join(types, ", "), strings.Join(signatures, ", "))
+	return reflect.Value{}, NewScriptError("ambiguous", message)
+}
+
+// Evaluates the arguments in the caller's context then applies the chosen function to them.
+func (overloads Overloads) Call(context EvalContext, head Tag, args []Value) (Value, error) {
+	values := make([]Value, len(args))
+	for k, arg := range args {
+		value, err := Eval(context, arg)
+		if err != nil {
+			return tuple.EMPTY, err
+		}
+		values[k] = value
+	}
+	return overloads.Apply(context, head, values)
+}
+
+func (overloads Overloads) Apply(context EvalContext, head Tag, values []Value) (Value, error) {
+	f, err := overloads.Resolve(values)
+	if err != nil {
+		return tuple.EMPTY, err
+	}
+	plan := planOf(f.Type())
+	args := make([]interface{}, len(values))
+	for k, value := range values {
+		if plan.types[k].Kind() == reflect.Interface {
+			args[k] = value
+		} else if args[k], err = Convert(context, value, plan.types[k]); err != nil {
+			return tuple.EMPTY, err
+		}
+	}
+	return plan.invoke(context, f, head, args)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// Lists the functions a name refers to in a scope and the scopes it is nested in.
+type overloadLister interface {
+	overloads(name string, shadowed map[string]bool) []string
+}
+
+// The signatures of all the functions a name can call, innermost scope first,
+// leaving out those hidden by a function of the same arity in an inner scope.
+func (table * SymbolTable) Overloads(name string) []string {
+	return table.overloads(name, map[string]bool{})
+}
+
+func (table * SymbolTable) overloads(name string, shadowed map[string]bool) []string {
+	keys := []string{}
+	for key := range table.symbols {
+		prefix := strings.TrimSuffix(key, "_" + name)
+		if prefix == key || shadowed[key] {
+			continue
+		}
+		if _, err := strconv.Atoi(prefix); err == nil || prefix == "*" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	result := []string{}
+	for _, key := range keys {
+		shadowed[key] = true
+		f := table.symbols[key]
+		if f.Type() != OverloadsType {
+			result = append(result, signatureOf(name, f))
+			continue
+		}
+		for _, overload := range f.Interface().(Overloads).functions {
+			result = append(result, signatureOf(name, overload))
+		}
+	}
+	if parent, ok := table.notFound.(overloadLister); ok {
+		result = append(result, parent.overloads(name, shadowed)...)
+	}
+	return result
+}
+
+// A function's name followed by the types of its parameters.
+func signatureOf(name string, f reflect.Value) string {
+	switch f.Type() {
+	case FunctionType:
+		return name + strings.Repeat(" Value", len(f.Interface().(Function).params))
+	case MacroType:
+		return name + strings.Repeat(" Value", len(f.Interface().(Macro).function.params))
+	}
+	if f.Type().IsVariadic() {
+		return name + " ..."
+	}
+	return signatureOfFunction(name, f)
+}
@@ -32,6 +32,9 @@ var MapType = reflect.TypeOf(func (_ tuple.Map) {}).In(0)
 var ArrayType = reflect.TypeOf(func (_ tuple.Array) {}).In(0)
 var EvalContextType = reflect.TypeOf(func (_ EvalContext) {}).In(0)
 var QuotedType = reflect.TypeOf(func (_ Quoted) {}).In(0)
+var FunctionType = reflect.TypeOf(Function{})
+var MacroType = reflect.TypeOf(Macro{})
+var OverloadsType = reflect.TypeOf(Overloads{})
 
 
 // Represents a call to a function using the golang reflect API.
@@ -75,7 +78,7 @@ func (call * ReflectCall) Call(context EvalContext, head string) (Value, error)
 	Trace(context, "  Call '%s' (%s)   f=%s -> %s", head, call.args, call.function, reflectValues)
 
 	if len(reflectValues) == 0  {
-		return tuple.EMPTY, nil  // TODO VOID
+		return tuple.NULL, nil
 	}
 	if len(reflectValues) == 2 {
 		err := reflectValues[1].Interface()
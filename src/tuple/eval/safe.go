@@ -27,6 +27,9 @@ func AddSafeFunctions(table LocalScope) {
 	AddAllocatingTupleFunctions(table)
 	AddSetAndDeclareFunctions(table)
 	AddControlStatementFunctions(table)
+	AddCollectionFunctions(table)
+	AddErrorFunctions(table)
+	AddMacroFunctions(table)
 }
 
 /////////////////////////////////////////////////////////////////////////////
@@ -39,6 +42,8 @@ func toString(context EvalContext, value Value) string {
 	case String: return string(val)  // Quote ???
 	case Float64: return  tuple.FloatToString(float64(val))
 	case Int64: return tuple.Int64ToString(val)
+	case BigInt: return val.String()
+	case Decimal: return val.String()
 	case Bool: return tuple.BoolToString(bool(val))
 	default: 
 		if value.Arity() == 0 {
@@ -87,26 +92,26 @@ func AddAllocatingTupleFunctions(table LocalScope)  {
 
 	table.Add("keys", func(context EvalContext, value Value) (Value, error) {
 
-		result := tuple.NewTuple()  // TODO not efficient use stream
+		result := []Value{}  // TODO not efficient use stream
 		if mmap, ok := value.(tuple.Map); ok {
 			mmap.ForallKeyValue(func(k Tag, _ Value) {
-				result.Append(k)
+				result = append(result, k)
 			})
 		} else {
 			for k := 0; k < value.Arity(); k += 1 {
-				result.Append(tuple.IntToTag(k))
+				result = append(result, tuple.IntToTag(k))
 			}
 		}
-		return result, nil
+		return tuple.NewVector(result...), nil
 	})
 
 	table.Add("values", func(context EvalContext, evaluated Value) (Value, error) {
-		result := tuple.NewTuple()  // TODO not efficient use stream
+		result := []Value{}  // TODO not efficient use stream
 		evaluated.ForallValues(func(value Value) error {
-			result.Append(value)
+			result = append(result, value)
 			return nil
 		})
-		return result, nil
+		return tuple.NewVector(result...), nil
 	})
 
 	table.Add("list", func(context EvalContext, values... Value) (Value, error) {
@@ -119,7 +124,7 @@ func AddAllocatingTupleFunctions(table LocalScope)  {
 				return nil, err
 			}
 		}
-		return tuple.NewTuple(array...), nil
+		return tuple.NewVector(array...), nil
 	})
 	// TODO table.Add("quote", func(value Value) Value { return NewTuple("quote", value) })
 }
@@ -131,16 +136,21 @@ func AddAllocatingTupleFunctions(table LocalScope)  {
 // This assign might set the value of a global variable if one exists
 func Assign (context EvalContext, tag Tag, evaluated Value) (Value, error) {
 	if table, _ := context.Find(context, tag, []Value{}); table != nil {
-		table.Add(tag.Name, func () Value { return evaluated })
+		bind(table, tag.Name, evaluated)
 	} else {
-		context.Add(tag.Name, func () Value { return evaluated })
+		bind(context, tag.Name, evaluated)
 	}
 	return evaluated, nil
 }
 
 // This assign will only set a loca variable in the top most context.
-func AssignLocal (context EvalContext, tag Tag, evaluated Value) (Value, error) {
-	context.Add(tag.Name, func () Value { return evaluated })
+// Assigning to a pattern sets the variables it names: (a b) = pair
+func AssignLocal (context EvalContext, target Quoted, evaluated Value) (Value, error) {
+	tag, ok := target.value.(Tag)
+	if ! ok {
+		return Destructure(context, target.value, evaluated)
+	}
+	bind(context, tag.Name, evaluated)
 	return evaluated, nil
 }
 
@@ -154,48 +164,57 @@ func AddSetAndDeclareFunctions(table LocalScope) {
 		return result, nil
 	})
 	table.Add("set", Assign)  // TODO Assign or AssignLocal
+	// Declares a named function, it is a closure of the scope it is declared in.
+	// A function with arguments can also be referred to by its name and passed as a value.
 	table.Add("func", func(context EvalContext, values... Value) Value {
-		lv := len(values)
-		if lv <= 1 {
+		if len(values) <= 1 {
 			context.Log("ERROR", "No name or arguments provided to 'func'")
 			return tuple.EMPTY
-		} else {
-			tag := values[0]
-			args := values[1:lv-1]
-			code := values[lv-1]
-			for k,v := range values[:lv-2] {
-				if _, ok := v.(Tag); ! ok {
-					context.Log("ERROR", "Expected identifier not '%s' for arg %d", v, k)
-					return tuple.EMPTY
-				}
-			}
-			functionName := tag.(Tag).Name
-			context.Add(functionName, func (context1 EvalContext, values... Value) (Value, error) {
-				if len(values) != len(args) {
-					message := fmt.Sprintf( "For '%s' Expected %d arguments not %d", functionName, len(args), len(values))
-					return tuple.EMPTY, errors.New(message)
-				} else {
-					context.Log("TRACE", "** FUNC %s argValue: %s", functionName, values)
-					newScope := context1.NewLocalScope()
-					for k,v := range values {
-						evaluated, err := Eval(context1, v)
-						if err != nil {
-							return nil, err
-						}
-						name := args[k].(Tag).Name
-						newScope.Add(name, func () Value {
-							return evaluated
-						})
-					}
-					evaluated, err := Eval(newScope, code)
-					if err != nil {
-						return nil, err
-					}
-					return evaluated, nil
-				}
-			})
-			return tag
 		}
+		tag, ok := values[0].(Tag)
+		if ! ok {
+			context.Log("ERROR", "Expected function name not '%s'", values[0])
+			return tuple.EMPTY
+		}
+		params, code, err := functionParams(values[1:])
+		if err != nil {
+			Error(context, "%s", err)
+			return tuple.EMPTY
+		}
+		function := NewFunction(context, tag.Name, params, code)
+		if len(params) > 0 {
+			context.Add(tag.Name, func () Value { return function })
+		}
+		context.Add(tag.Name, function)
+		return tag
+	})
+
+	// An anonymous function: lambda a b { a+b }
+	lambda := func(context EvalContext, values... Value) (Value, error) {
+		params, code, err := functionParams(values)
+		if err != nil {
+			return nil, err
+		}
+		return NewFunction(context, "", params, code), nil
+	}
+	table.Add("lambda", lambda)
+	table.Add("fn", lambda)
+
+	// Calls a function value with the given arguments: call f 1 2
+	table.Add("call", func(context EvalContext, values... Value) (Value, error) {
+		if len(values) == 0 {
+			return nil, errors.New("No function provided to 'call'")
+		}
+		evaluated, err := Eval(context, values[0])
+		if err != nil {
+			return nil, err
+		}
+		function, ok := evaluated.(Function)
+		if ! ok {
+			message := fmt.Sprintf("Expected a function not '%s'", evaluated)
+			return nil, errors.New(message)
+		}
+		return function.Call(context, values[1:])
 	})
 }
 
@@ -206,15 +225,8 @@ func AddSetAndDeclareFunctions(table LocalScope) {
 func AddControlStatementFunctions(table LocalScope) {
 
 	// Perhaps this could be moved to harmless.
-	table.Add("if", func(context EvalContext, condition bool, trueCode Quoted, falseCode Quoted) (Value, error) {
-		var code Value
-		if condition {
-			code = trueCode.Value()
-		} else {
-			code = falseCode.Value()
-		}
-		return Eval(context, code)
-	})
+	table.Add("if", ifThenElse)
+	table.Add("match", MatchCases)
 	table.Add("for", func(context EvalContext, tag Tag, list Value, code Quoted) Value {
 		var iterator Value = nil
 		newScope := context.NewLocalScope()
@@ -274,18 +286,28 @@ func AddControlStatementFunctions(table LocalScope) {
 	})
 
 	// https://www.gnu.org/software/emacs/manual/html_node/eintr/progn.html
-	table.Add("progn", func(context EvalContext, values... Value) (Value, error) {
-		var result Value = tuple.EMPTY
-		for _, v := range values {
-			evaluated, err := Eval(context, v)
-			if err != nil {
-				return nil, err
-			}
-			result = evaluated
-		}
-		return result, nil
-
-	})
+	table.Add("progn", progn)
+}
 
+// The bytecode machine evaluates these inline so that calls within them can be tail calls.
+func ifThenElse(context EvalContext, condition bool, trueCode Quoted, falseCode Quoted) (Value, error) {
+	var code Value
+	if condition {
+		code = trueCode.Value()
+	} else {
+		code = falseCode.Value()
+	}
+	return Eval(context, code)
+}
 
+func progn(context EvalContext, values... Value) (Value, error) {
+	var result Value = tuple.EMPTY
+	for _, v := range values {
+		evaluated, err := Eval(context, v)
+		if err != nil {
+			return nil, err
+		}
+		result = evaluated
+	}
+	return result, nil
 }
@@ -23,6 +23,10 @@ import (
 	"tuple/runner"
 	"tuple/eval"
 	"tuple/parsers"
+	"time"
+	"runtime"
+	"reflect"
+	"strings"
 )
 
 var safeEvalContext = runner.NewSafeEvalContext(logger)
@@ -79,3 +83,500 @@ aa(2)==4`)
 	test(`eq "1 2" (join " " (for v ( a:1 b:2 ) { v }))`)
 	test(`progn a=(forkv k v (a:1 b:2) { concat k v }) (eq "b2" (nth 1 a))`)
 }
+
+func TestClosures(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	context := runner.NewSafeEvalContext(logger)
+	context.Add("=", eval.AssignLocal)
+
+	test := func (formula string) {
+		val, err := runner.ParseAndEval(context, grammar, formula)
+		if val != tuple.Bool(true) {
+			t.Errorf("Expected '%s' to be TRUE got '%v' %v", formula, val, err)
+		}
+	}
+
+	test("progn double=(lambda x { x*2 }) double(4)==8")
+	test("progn add=(fn a b { a+b }) (call add 1 2)==3")
+	test("((lambda x { x+1 }) 2) == 3")
+
+	// Functions capture the scope they are declared in
+	test("progn (func adder n { lambda x { x+n } }) add2=adder(2) add2(5)==7")
+	test("progn (func adder n { lambda x { x+n } }) add2=adder(2) add3=adder(3) add3(1)+add2(1)==7")
+	test("progn (func counter { progn c=0 (lambda { set c c+1 }) }) next=counter() (call next) (call next)==2")
+
+	// Functions as arguments and in tuples
+	test("progn (func twice f x { f(f(x)) }) (twice (lambda x { x*3 }) 2)==18")
+	test("progn (func inc x { x+1 }) (func twice f x { f(f(x)) }) (twice inc 1)==3")
+	test("progn fs=(list (lambda x { x+1 }) (lambda x { x*10 })) (call (nth 1 fs) 3)==30")
+	test("progn ops=(list (lambda x { x-1 })) (call (first ops) 3)==2")
+	test(`eq (typeof (lambda x { x })) "Function"`)
+}
+
+func TestErrors(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	test := func (formula string, expected string) {
+		val, err := runner.ParseAndEval(safeEvalContext, grammar, formula)
+		if err != nil || val != tuple.String(expected) {
+			t.Errorf("Expected '%s' to be '%s' got '%v' %v", formula, expected, val, err)
+		}
+	}
+
+	test(`try (nosuch 1) (catch e (field kind e))`, "notfound")
+	test(`try "fine" (catch e "caught")`, "fine")
+	test(`try (throw "bad") (catch e (field message e))`, "bad")
+	test(`try (throw "io" "missing") (catch e (concat (field kind e) ":" (field message e)))`, "io:missing")
+	test(`try (throw (message:"m" kind:"k" code:42)) (catch e (concat (field kind e) (field code e)))`, "k42")
+	test(`try (error "a" 1) (catch e (field message e))`, "a1")
+	test(`try (1/0) (catch e (field kind e))`, "arithmetic")
+	test(`try (progn (func inner { throw "x" }) (func outer { inner() }) outer()) (catch e (join " " (field stack e)))`, "inner outer")
+	test(`try (try (throw "x") (catch e (throw (concat (field message e) "y")))) (catch e (field message e))`, "xy")
+
+	safeEvalContext.Add("=", eval.AssignLocal)
+	test(`progn log="" (try "ok" (finally (set log "done"))) log`, "done")
+	test(`progn log="" (try (try (throw "x") (finally (set log "done"))) (catch e log))`, "done")
+
+	if _, err := runner.ParseAndEval(safeEvalContext, grammar, `try (throw "uncaught") (finally 1)`); err == nil || err.Error() != "uncaught" {
+		t.Errorf("Expected the error to pass through 'finally' got %v", err)
+	}
+	_, err := runner.ParseAndEval(safeEvalContext, parsers.NewLispGrammar(), "(+ 1\n  (throw \"x\"))")
+	scriptError, _ := err.(*eval.ScriptError)
+	if location, ok := scriptError.Location(); ! ok || location.Line() != 2 {
+		t.Errorf("Expected the error on line 2 got '%s'", location)
+	}
+}
+
+func TestBudget(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	exceeds := func (limits eval.Limits, formula string, resource string) {
+		context := runner.NewLimitedEvalContext(logger, limits)
+		context.Add("=", eval.AssignLocal)
+		_, err := runner.ParseAndEval(context, grammar, formula)
+		budgetError, ok := err.(*eval.BudgetError)
+		if ! ok || budgetError.Resource() != resource {
+			t.Errorf("Expected '%s' to exceed the %s budget got %v", formula, resource, err)
+		}
+	}
+
+	exceeds(eval.Limits{Steps: 1000}, "while true { 1 }", "steps")
+	exceeds(eval.Limits{Steps: 1000}, "try (while true { 1 }) (catch e 1)", "steps")
+	exceeds(eval.Limits{Depth: 100}, "progn (func f n { 1+f(n+1) }) f(0)", "depth")
+	exceeds(eval.Limits{Steps: 1000}, "progn (func f n { f(n+1) }) f(0)", "steps")
+	exceeds(eval.Limits{Recursion: 100}, "progn (func f n { 1+f(n+1) }) f(0)", "recursion")
+	exceeds(eval.Limits{}, "progn (func f n { 1+f(n+1) }) f(0)", "recursion")
+	exceeds(eval.Limits{Elements: 1000}, "range 1000000000000", "elements")
+	exceeds(eval.Limits{Elements: 1000}, "map (lambda x { list x x x }) (range 500)", "elements")
+	exceeds(eval.Limits{Bytes: 1000}, `progn s="x" (while true { s=(concat s s) })`, "bytes")
+	exceeds(eval.Limits{Deadline: time.Now()}, "1+2", "deadline")
+	exceeds(eval.Limits{Deadline: time.Now().Add(10*time.Millisecond)}, "while true { 1 }", "deadline")
+
+	context := runner.NewLimitedEvalContext(logger, eval.Limits{Steps: 100, Depth: 20, Elements: 100, Bytes: 100})
+	if val, err := runner.ParseAndEval(context, grammar, "arity (range 10)"); err != nil || val != tuple.Int64(10) {
+		t.Errorf("Expected a formula within its budget to succeed got %v %v", val, err)
+	}
+	if used := context.GlobalScope().Budget(); used.Limits().Steps != 100 {
+		t.Errorf("Expected the limits to be kept got %v", used.Limits())
+	}
+}
+
+func TestCompiledAndInterpreted(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	formulas := []string{
+		"1+2*3",
+		"if(1<2, \"yes\", \"no\")",
+		"progn (func fib n { if(n<=1, 1, fib(n-1)+fib(n-2)) }) fib(10)",
+		"progn n=0 (while n < 10 { n=n+1 }) n",
+		"map (lambda x { x*x }) (range 5)",
+		"(lambda a b { a-b }) 5 3",
+		"(1 (2+3) \"x\")",
+		"join \"-\" (for v (1 2 3) { v*2 })",
+		"try (nosuch 1) (catch e (field kind e))",
+		"sqrt(16)",
+		"(decimal 0.1) + 0.2",
+	}
+	for _, formula := range formulas {
+		results := []tuple.Value{}
+		for _, mode := range []eval.Mode{eval.INTERPRET, eval.COMPILE, eval.BYTECODE} {
+			context := runner.NewSafeEvalContext(logger)
+			context.Add("=", eval.AssignLocal)
+			context.GlobalScope().SetMode(mode)
+			result, err := runner.ParseAndEval(context, grammar, formula)
+			if err != nil {
+				t.Errorf("Given '%s' in mode %d got error %s", formula, mode, err)
+			}
+			results = append(results, result)
+		}
+		if ! reflect.DeepEqual(results[0], results[1]) || ! reflect.DeepEqual(results[0], results[2]) {
+			t.Errorf("Given '%s' expected the same result compiled got %v", formula, results)
+		}
+	}
+
+	// Compiled code is reused each time a function is called, the code of the first expression may have been forgotten since
+	context := runner.NewSafeEvalContext(logger)
+	runner.ParseAndEval(context, grammar, "progn (func fib n { if(n<=1, 1, fib(n-1)+fib(n-2)) }) fib(15)")
+	compiled := context.GlobalScope().Code().Size()
+	runner.ParseAndEval(context, grammar, "fib(15)")
+	if context.GlobalScope().Code().Size() > compiled + 1 {
+		t.Errorf("Expected only the new expression to be compiled got %d then %d", compiled, context.GlobalScope().Code().Size())
+	}
+}
+
+func TestCodeCache(t *testing.T) {
+
+	for _, mode := range []eval.Mode{eval.COMPILE, eval.BYTECODE} {
+		context := runner.NewSafeEvalContext(logger)
+		context.GlobalScope().SetMode(mode)
+		size := func() int {
+			if mode == eval.COMPILE {
+				return context.GlobalScope().Code().Size()
+			}
+			return context.GlobalScope().Programs().Size()
+		}
+
+		// Replacing an element of a tuple that has been evaluated replaces its code
+		expression := tuple.NewTuple(tuple.Tag{"+"}, tuple.Int64(1), tuple.Int64(2))
+		if result, err := eval.Eval(context, expression); err != nil || result != tuple.Int64(3) {
+			t.Errorf("In mode %d expected 3 got %v %v", mode, result, err)
+		}
+		expression.Set(2, tuple.Int64(5))
+		if result, err := eval.Eval(context, expression); err != nil || result != tuple.Int64(6) {
+			t.Errorf("In mode %d expected the changed tuple to give 6 got %v %v", mode, result, err)
+		}
+
+		// As is changing the storage of a tuple within it, even though the tuple refers to the same storage
+		storage := []tuple.Value{tuple.Tag{"+"}, tuple.Int64(1), tuple.Int64(2)}
+		outer := tuple.NewTuple(tuple.Tag{"*"}, tuple.Tuple{storage}, tuple.Int64(10))
+		if result, err := eval.Eval(context, outer); err != nil || result != tuple.Int64(30) {
+			t.Errorf("In mode %d expected 30 got %v %v", mode, result, err)
+		}
+		storage[2] = tuple.Int64(5)
+		if result, err := eval.Eval(context, outer); err != nil || result != tuple.Int64(60) {
+			t.Errorf("In mode %d expected the changed nested tuple to give 60 got %v %v", mode, result, err)
+		}
+
+		// The code is forgotten once the tuples are garbage collected, the code of the functions defined is kept
+		kept := size()
+		for k := 0; k < 1000; k += 1 {
+			eval.Eval(context, tuple.NewTuple(tuple.Tag{"+"}, tuple.Int64(k), tuple.Int64(1)))
+		}
+		for k := 0; k < 100 && size() > kept; k += 1 {
+			runtime.GC()
+			time.Sleep(time.Millisecond)
+		}
+		if size() > kept {
+			t.Errorf("In mode %d expected the code of collected tuples to be forgotten got %d rather than %d", mode, size(), kept)
+		}
+		runtime.KeepAlive(expression)
+	}
+
+	// The code can be compiled from several goroutines
+	context := runner.NewSafeEvalContext(logger)
+	global := context.GlobalScope()
+	expression := tuple.NewTuple(tuple.Tag{"*"}, tuple.Int64(6), tuple.Int64(7))
+	done := make(chan bool)
+	for k := 0; k < 4; k += 1 {
+		go func() {
+			for j := 0; j < 100; j += 1 {
+				global.Code().Compile(global, expression)
+				global.Code().Compile(global, tuple.NewTuple(tuple.Tag{"-"}, tuple.Int64(j)))
+			}
+			done <- true
+		}()
+	}
+	for k := 0; k < 4; k += 1 {
+		<-done
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	for _, mode := range []eval.Mode{eval.INTERPRET, eval.COMPILE, eval.BYTECODE} {
+		context := runner.NewLimitedEvalContext(logger, eval.Limits{Recursion: 100})
+		context.Add("=", eval.AssignLocal)
+		context.GlobalScope().SetMode(mode)
+		run := func (formula string) (tuple.Value, error) {
+			return runner.ParseAndEval(context, grammar, formula)
+		}
+
+		_, err := run("progn (func f n { if(n==0, 0, 1+f(n-1)) }) f(1000)")
+		if budgetError, ok := err.(*eval.BudgetError); ! ok || budgetError.Resource() != "recursion" {
+			t.Errorf("Expected recursion too deep in mode %d got %v", mode, err)
+		}
+		if val, err := run("f(50)"); val != tuple.Int64(50) {
+			t.Errorf("Expected recursion within the limit in mode %d got %v %v", mode, val, err)
+		}
+		if mode == eval.INTERPRET {
+			continue
+		}
+		val, err := run("progn (func count n total { if(n==0, total, progn(n, count(n-1, total+1))) }) count(1000, 0)")
+		if val != tuple.Int64(1000) {
+			t.Errorf("Expected tail calls not to nest in mode %d got %v %v", mode, val, err)
+		}
+		val, err = run("progn (func loop f n { if(n==0, \"done\", f(f, n-1)) }) loop(loop, 1000)")
+		if val != tuple.String("done") {
+			t.Errorf("Expected a tail call of a function value in mode %d got %v %v", mode, val, err)
+		}
+	}
+}
+
+func TestMacros(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	for _, mode := range []eval.Mode{eval.INTERPRET, eval.COMPILE, eval.BYTECODE} {
+		context := runner.NewSafeEvalContext(logger)
+		context.Add("=", eval.AssignLocal)
+		context.GlobalScope().SetMode(mode)
+		test := func (formula string, expected tuple.Value) {
+			val, err := runner.ParseAndEval(context, grammar, formula)
+			if err != nil || ! reflect.DeepEqual(val, expected) {
+				t.Errorf("Expected '%s' in mode %d to be '%v' got '%v' %v", formula, mode, expected, val, err)
+			}
+		}
+
+		test("macro unless c x { quasiquote (if (unquote c) 0 (unquote x)) }", tuple.Tag{"unless"})
+		test("unless (1 > 2) 3", tuple.Int64(3))
+		test("unless (1 < 2) (nosuch 3)", tuple.Int64(0))
+
+		// The arguments are evaluated where the macro puts them
+		test("macro twice x { quasiquote (progn (unquote x) (unquote x)) }", tuple.Tag{"twice"})
+		test("progn n=0 twice(n=n+1) n", tuple.Int64(2))
+
+		test("macro all xs { quasiquote (list (unquote_splicing xs)) }", tuple.Tag{"all"})
+		test("all (1 2 3)", tuple.NewVector(tuple.Int64(1), tuple.Int64(2), tuple.Int64(3)))
+
+		// Expanded once for each place it is called
+		test("macro counted x { progn (set expanded (expanded+1)) x }", tuple.Tag{"counted"})
+		test("expanded = 0", tuple.Int64(0))
+		test("progn (map (lambda v { counted(v) }) (1 2 3)) expanded", tuple.Int64(1))
+
+		test("macroexpand (quote (unless a b))", tuple.NewTuple(tuple.Tag{"if"}, tuple.Tag{"a"}, tuple.Int64(0), tuple.Tag{"b"}))
+		test("try (macroexpand (quote (all 1))) (catch e (field message e))", tuple.String("Expected a tuple to splice not '1'"))
+	}
+}
+
+func TestMatch(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	for _, mode := range []eval.Mode{eval.INTERPRET, eval.COMPILE, eval.BYTECODE} {
+		context := runner.NewSafeEvalContext(logger)
+		context.Add("=", eval.AssignLocal)
+		context.GlobalScope().SetMode(mode)
+		test := func (formula string, expected tuple.Value) {
+			val, err := runner.ParseAndEval(context, grammar, formula)
+			if err != nil || ! reflect.DeepEqual(val, expected) {
+				t.Errorf("Expected '%s' in mode %d to be '%v' got '%v' %v", formula, mode, expected, val, err)
+			}
+		}
+
+		test(`func describe v {
+			match v {
+				case 0 "zero"
+				case "a" "letter"
+				case (quote a) "tag"
+				case (x x) (concat "pair of " x)
+				case (x y) (concat "pair " x " " y)
+				case (x ... rest) (concat "first " x " of " (1 + arity(rest)))
+				case {name: n} (concat "named " n)
+				case (is Number n) (concat "number " n)
+				case _ "other"
+			}
+		}`, tuple.Tag{"describe"})
+		test("describe 0", tuple.String("zero"))
+		test(`describe "a"`, tuple.String("letter"))
+		test("describe (quote a)", tuple.String("tag"))
+		test("describe (2 2)", tuple.String("pair of 2"))
+		test("describe (1 2)", tuple.String("pair 1 2"))
+		test("describe (1 2 3)", tuple.String("first 1 of 3"))
+		test(`describe {name: "x" size: 1}`, tuple.String("named x"))
+		test("describe 1.5", tuple.String("number 1.5"))
+		test(`describe "b"`, tuple.String("other"))
+		test(`match (1 2) { case (a b) a+b }`, tuple.Int64(3))
+		test(`try (match 1 { case 2 0 }) (catch e (field kind e))`, tuple.String("match"))
+
+		// Destructuring binds each name in the pattern
+		test("(a b) = (1 (2 3))", tuple.NewTuple(tuple.Int64(1), tuple.NewTuple(tuple.Int64(2), tuple.Int64(3))))
+		test("b", tuple.NewTuple(tuple.Int64(2), tuple.Int64(3)))
+		test("(c (d e)) = (4 (5 6))", tuple.NewTuple(tuple.Int64(4), tuple.NewTuple(tuple.Int64(5), tuple.Int64(6))))
+		test("c+d+e", tuple.Int64(15))
+		test("(f ... g) = (7 8 9)", tuple.NewTuple(tuple.Int64(7), tuple.Int64(8), tuple.Int64(9)))
+		test("g", tuple.NewTuple(tuple.Int64(8), tuple.Int64(9)))
+		test("try ((h i) = (1 2 3)) (catch e (field kind e))", tuple.String("match"))
+	}
+}
+
+func TestNull(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	for _, mode := range []eval.Mode{eval.INTERPRET, eval.COMPILE, eval.BYTECODE} {
+		context := runner.NewSafeEvalContext(logger)
+		context.Add("noop", func () {})
+		context.GlobalScope().SetMode(mode)
+		test := func (formula string, expected tuple.Value) {
+			val, err := runner.ParseAndEval(context, grammar, formula)
+			if err != nil || ! reflect.DeepEqual(val, expected) {
+				t.Errorf("Expected '%s' in mode %d to be '%v' got '%v' %v", formula, mode, expected, val, err)
+			}
+		}
+
+		test("noop", tuple.NULL)
+		test("null", tuple.NULL)
+		test("()", tuple.EMPTY)
+		test("nth 3 (1 2 3)", tuple.NULL)
+		test("typeof null", tuple.String("Null"))
+		test("isnull (noop)", tuple.Bool(true))
+		test("isnull ()", tuple.Bool(false))
+		test("eq null ()", tuple.Bool(false))
+		test("arity null", tuple.Int64(0))
+		test("arity (flatten (list 1 null (list null 2)))", tuple.Int64(4))
+	}
+}
+
+func TestOverloads(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	for _, mode := range []eval.Mode{eval.INTERPRET, eval.COMPILE, eval.BYTECODE} {
+		context := runner.NewSafeEvalContext(logger)
+		context.GlobalScope().SetMode(mode)
+		context.Add("describe", func (x float64) string { return "float" })
+		context.Add("describe", func (x tuple.Value) string { return "value" })
+		context.Add("describe", func (x string) string { return "string" })
+		context.Add("pair", func (a int64, b float64) string { return "int float" })
+		context.Add("pair", func (a float64, b int64) string { return "float int" })
+		test := func (formula string, expected tuple.Value) {
+			val, err := runner.ParseAndEval(context, grammar, formula)
+			if err != nil || ! reflect.DeepEqual(val, expected) {
+				t.Errorf("Expected '%s' in mode %d to be '%v' got '%v' %v", formula, mode, expected, val, err)
+			}
+		}
+
+		// An exact match then a numeric promotion then any value
+		test(`describe "a"`, tuple.String("string"))
+		test("describe 1.5", tuple.String("float"))
+		test("describe 1", tuple.String("float"))
+		test("describe (1 2)", tuple.String("value"))
+		test("describe (1+1)", tuple.String("float"))
+		test("pair 1 1.5", tuple.String("int float"))
+		test("pair 1.5 1", tuple.String("float int"))
+
+		test("try (pair 1 2) (catch e (field kind e))", tuple.String("ambiguous"))
+		test(`try (pair "a" 1) (catch e (field kind e))`, tuple.String("notfound"))
+
+		// Adding a function with the same parameters replaces it
+		context.Add("describe", func (x string) string { return "text" })
+		test(`describe "a"`, tuple.String("text"))
+		test("overloads describe", tuple.NewTuple(tuple.String("describe float64"), tuple.String("describe Value"), tuple.String("describe string")))
+		test("overloads pair", tuple.NewTuple(tuple.String("pair int64 float64"), tuple.String("pair float64 int64")))
+		test(`overloads "**"`, tuple.NewTuple(tuple.String("** Value Value")))
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	limit, _ := tuple.IntegerFromString("9223372036854775808", 10)
+	for _, mode := range []eval.Mode{eval.INTERPRET, eval.COMPILE, eval.BYTECODE} {
+		context := runner.NewSafeEvalContext(logger)
+		context.GlobalScope().SetMode(mode)
+		test := func (formula string, expected tuple.Value) {
+			val, err := runner.ParseAndEval(context, grammar, formula)
+			if err != nil || ! reflect.DeepEqual(val, expected) {
+				t.Errorf("Expected '%s' in mode %d to be '%v' got '%v' %v", formula, mode, expected, val, err)
+			}
+		}
+
+		// An Int64 result that overflows is a BigInt, as is a literal that does not fit
+		test("9223372036854775807 + 1", limit)
+		test("9223372036854775808", limit)
+		test("(9223372036854775807 + 1) - 1", tuple.Int64(9223372036854775807))
+		test("4611686018427387904 * 2", limit)
+	}
+}
+
+func TestBytecode(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	context := runner.NewSafeEvalContext(logger)
+	context.Add("=", eval.AssignLocal)
+	context.GlobalScope().SetMode(eval.BYTECODE)
+
+	test := func (formula string, expected tuple.Value) {
+		val, err := runner.ParseAndEval(context, grammar, formula)
+		if err != nil || ! reflect.DeepEqual(val, expected) {
+			t.Errorf("Expected '%s' to be '%v' got '%v' %v", formula, expected, val, err)
+		}
+	}
+
+	// Tail calls replace the frame of the caller, also within 'if' and 'progn'
+	test("progn (func count n total { if(n==0, total, count(n-1, total+1)) }) count(10000, 0)", tuple.Int64(10000))
+	test("progn (func down n { if(n==0, \"done\", progn(n, down(n-1))) }) down(10000)", tuple.String("done"))
+	test("progn (func even n { if(n==0, true, odd(n-1)) }) (func odd n { if(n==0, false, even(n-1)) }) even(10001)", tuple.Bool(false))
+
+	program := eval.Assemble(tuple.NewLocations(), tuple.NewTuple(tuple.Tag{"f"}, tuple.Tag{"x"}))
+	if ! strings.Contains(program.String(), "invoke 0 1 1") {
+		t.Errorf("Expected a tail call got\n%s", program)
+	}
+}
+
+func TestCollectionFunctions(t *testing.T) {
+
+	grammar := parsers.NewShellGrammar()
+	context := runner.NewSafeEvalContext(logger)
+	context.Add("=", eval.AssignLocal)
+
+	test := func (formula string) {
+		val, err := runner.ParseAndEval(context, grammar, formula)
+		if val != tuple.Bool(true) {
+			t.Errorf("Expected '%s' to be TRUE got '%v' %v", formula, val, err)
+		}
+	}
+
+	test(`eq "2 4 6" (join " " (map (lambda x { x*2 }) (1 2 3)))`)
+	test(`eq "4 6" (join " " (map (lambda x { x*2 }) (for v (1 2) { v+1 })))`)
+	test(`eq "2 3" (join " " (values (map (lambda x { x+1 }) (a:1 b:2))))`)
+	test(`eq "b" (join " " (keys (filter (lambda x { x>1 }) (a:1 b:2))))`)
+	test("eq (filter (lambda x { x>1 }) (1 2 3)) (2 3)")
+	test(`progn (func inc x { x+1 }) (eq "2 3" (join " " (map inc (1 2))))`)
+
+	test("(reduce (lambda a b { a+b }) (1 2 3 4)) == 10")
+	test("(reduce (lambda a b { a+b }) 10 (1 2)) == 13")
+	test("(reduce (lambda a b { a+b }) 5 ()) == 5")
+
+	test("any (lambda x { x>2 }) (1 2 3)")
+	test("! (any (lambda x { x>3 }) (1 2 3))")
+	test("all (lambda x { x>0 }) (1 2 3)")
+	test("! (all (lambda x { x>1 }) (1 2 3))")
+
+	test("eq (sort (3 1 2)) (1 2 3)")
+	test(`eq "true 2 a b" (join " " (sort ("b" "a" 2 true)))`)
+	test("eq (sortby (lambda x { 0-x }) (1 3 2)) (3 2 1)")
+	test(`eq "false true" (join " " (keys (groupby (lambda x { x>1 }) (1 2 3))))`)
+	test(`eq (list (list 1) (list 2 3)) (values (groupby (lambda x { x>1 }) (1 2 3)))`)
+	test("eq (uniq (1 2 1 3 2)) (1 2 3)")
+	test("eq (flatten (1 (2 (3 4)) (a:5))) (1 2 3 4 5)")
+
+	test("eq (zip (1 2 3) (4 5)) ((1 4) (2 5))")
+	test("eq (take 2 (1 2 3)) (1 2)")
+	test("eq (drop 2 (1 2 3)) (list 3)")
+	test("eq (range 3) (0 1 2)")
+	test("eq (range 1 3) (1 2)")
+	test("eq (range 6 0 (0-3)) (6 3)")
+
+	// Adding to a list or map makes a new one leaving the one given unchanged
+	test("progn (v = range(2)) (w = push(v 2)) (eq v (0 1)) && (eq w (0 1 2))")
+	test("eq (push (1 2) 3) (1 2 3)")
+	test("progn (m = {a:1}) (n = assoc(m b 2)) (eq m {a:1}) && (eq n {a:1 b:2}) && (eq (dissoc n a) {b:2})")
+	test("progn (g = groupby((lambda x { x>1 }) (1 2 3))) (h = assoc(g true 0)) (eq (values g) (list (list 1) (list 2 3)))")
+	test(`eq "Vector HashMap" (join " " (list (typeof (list 1)) (typeof (map (lambda x { x }) {a:1}))))`)
+
+	// Vectors and hash maps are accepted wherever tuples and maps are
+	test(`(len "abc") == 3`)
+	test("(len (list 1 2 3)) == 3")
+	test("(len (1 2)) == 2")
+	test("(len (assoc {a:1} b 2)) == 2")
+	test("(len (dissoc {a:1 b:2} a)) == 1")
+}
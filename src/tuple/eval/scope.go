@@ -17,6 +17,7 @@
 package eval
 
 import "tuple"
+import gocontext "context"
 import "reflect"
 import "fmt"
 
@@ -26,11 +27,18 @@ type Runner struct {
 	locationLogger LocationLogger
 	symbols SymbolTable
 	root tuple.TagValueMap
+	locations tuple.Locations
+	location Location  // Of the expression being evaluated
+	budget Budget
+	cancellation gocontext.Context
+	mode Mode
+	code CodeCache
+	programs ProgramCache
 }
 
 func NewRunner(notFound Finder, logger LocationLogger) Runner {
 	symbols :=  NewSymbolTable(notFound)
-	runner := Runner{logger, symbols, tuple.NewTagValueMap()}
+	runner := Runner{logger, symbols, tuple.NewTagValueMap(), tuple.NewLocations(), tuple.NewLocation("<eval>", 0, 0, 0), NewBudget(Limits{}), gocontext.Background(), COMPILE, NewCodeCache(), NewProgramCache()}
 
 	runner.AddToRoot(Tag{"funcs"}, &symbols)
 	return runner
@@ -52,15 +60,62 @@ func (runner * Runner) LocationLogger() LocationLogger {
 	return runner.locationLogger
 }
 
+func (runner * Runner) Locations() tuple.Locations {
+	return runner.locations
+}
+
+func (runner * Runner) Location() Location {
+	return runner.location
+}
+
+func (runner * Runner) SetLocation(location Location) {
+	runner.location = location
+}
+
+func (runner * Runner) Budget() *Budget {
+	return &runner.budget
+}
+
+func (runner * Runner) SetLimits(limits Limits) {
+	runner.budget = NewBudget(limits)
+}
+
+func (runner * Runner) Cancellation() gocontext.Context {
+	return runner.cancellation
+}
+
+func (runner * Runner) SetCancellation(cancellation gocontext.Context) {
+	runner.cancellation = cancellation
+}
+
+func (runner * Runner) Mode() Mode {
+	return runner.mode
+}
+
+func (runner * Runner) SetMode(mode Mode) {
+	runner.mode = mode
+}
+
+func (runner * Runner) Code() *CodeCache {
+	return &runner.code
+}
+
+func (runner * Runner) Programs() *ProgramCache {
+	return &runner.programs
+}
+
 func (runner * Runner) Log(level string, format string, args ...interface{}) {
-	location := tuple.NewLocation("<eval>", 0, 0, 0)
-	runner.locationLogger(location, level, fmt.Sprintf(format, args...))
+	runner.locationLogger(runner.location, level, fmt.Sprintf(format, args...))
 }
 
 func (runner * Runner) Find(context EvalContext, name Tag, args [] Value) (LocalScope, reflect.Value) {
 	return runner.symbols.Find(context, name, args)
 }
 
+func (runner * Runner) overloads(name string, shadowed map[string]bool) []string {
+	return runner.symbols.overloads(name, shadowed)
+}
+
 func (runner * Runner) Add(name string, function interface{}) {
 	runner.symbols.Add(name, function)
 }
@@ -85,6 +140,10 @@ func (scope * RunnerLocalScope) NewLocalScope() EvalContext {
 	return &newScope
 }
 
+func (scope * RunnerLocalScope) Functions() tuple.TagValueMap {
+	return scope.symbols.Functions()
+}
+
 func (scope * RunnerLocalScope) GlobalScope() GlobalScope {
 	return scope.global
 }
@@ -94,14 +153,17 @@ func (scope * RunnerLocalScope) Root() Value {
 }
 
 func (scope * RunnerLocalScope) Log(level string, format string, args ...interface{}) {
-	location := tuple.NewLocation("<eval>", 0, 0, 0)
-	scope.global.locationLogger(location, level, fmt.Sprintf(format, args...))
+	scope.global.Log(level, format, args...)
 }
 
 func (scope * RunnerLocalScope) Find(context EvalContext, name Tag, args [] Value) (LocalScope, reflect.Value) {
 	return scope.symbols.Find(context, name, args)
 }
 
+func (scope * RunnerLocalScope) overloads(name string, shadowed map[string]bool) []string {
+	return scope.symbols.overloads(name, shadowed)
+}
+
 func (scope * RunnerLocalScope) Add(name string, function interface{}) {
 	scope.symbols.Add(name, function)
 }
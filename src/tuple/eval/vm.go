@@ -0,0 +1,587 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package eval
+
+import "tuple"
+import "reflect"
+import "errors"
+import "fmt"
+import "strings"
+import "sync"
+
+/////////////////////////////////////////////////////////////////////////////
+// Bytecode
+/////////////////////////////////////////////////////////////////////////////
+
+// Expressions can also be assembled into bytecode for a stack machine. A call of a script function
+// pushes a frame rather than recursing in golang and a call whose result is returned replaces the
+// frame of the caller, a tail call. The builtins 'if' and 'progn' are run inline, unless they have
+// been redefined, so calls within them can also be tail calls. Other builtins are called as for Eval
+// and any code they evaluate is run by a machine of its own.
+
+type opcode uint8
+
+const (
+	opConstant opcode = iota  // Push constants[a]
+	opEnter  // Start evaluating an expression, checking the budget
+	opLeave
+	opLocate  // Evaluate at locations[a] until opUnlocate
+	opUnlocate
+	opLookup  // Find the function called at sites[a]
+	opArg  // Push argument b of sites[a] unevaluated and jump to c, unless the function found evaluates it
+	opConvert  // Convert the evaluated argument b of sites[a] to the function's parameter type
+	opInvoke  // Call the function found with b arguments, c is 1 for a tail call
+	opInline  // Continue if the function found is the builtin sites[a] names, otherwise jump to b
+	opJump  // To a
+	opJumpIfFalse  // Pop a condition and jump to a if it is false
+	opPop
+	opApply  // Call a function value or make a tuple from a head and b values, c is 1 for a tail call
+	opReturn
+)
+
+var opcodeNames = []string{"constant", "enter", "leave", "locate", "unlocate", "lookup", "arg", "convert",
+	"invoke", "inline", "jump", "jumpiffalse", "pop", "apply", "return"}
+
+type instruction struct {
+	op opcode
+	a int32
+	b int32
+	c int32
+}
+
+type callSite struct {
+	head Tag
+	args []Value
+}
+
+// The bytecode of an expression.
+type Program struct {
+	code []instruction
+	constants []Value
+	sites []callSite
+	locations []Location
+}
+
+// Lists the instructions, one per line.
+func (program * Program) String() string {
+	lines := make([]string, len(program.code))
+	for k, ins := range program.code {
+		lines[k] = fmt.Sprintf("%d %s %d %d %d", k, opcodeNames[ins.op], ins.a, ins.b, ins.c)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The builtins run inline, set in init as they evaluate code themselves.
+var inlined map[string]uintptr
+
+func init() {
+	inlined = map[string]uintptr{
+		"if": reflect.ValueOf(ifThenElse).Pointer(),
+		"progn": reflect.ValueOf(progn).Pointer(),
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+type assembler struct {
+	program * Program
+	locations tuple.Locations
+}
+
+func Assemble(locations tuple.Locations, expression Value) *Program {
+	asm := assembler{&Program{}, locations}
+	asm.expression(expression)
+	asm.emit(opReturn, 0, 0, 0)
+	asm.markTailCalls()
+	return asm.program
+}
+
+func (asm * assembler) emit(op opcode, a int, b int, c int) int {
+	asm.program.code = append(asm.program.code, instruction{op, int32(a), int32(b), int32(c)})
+	return len(asm.program.code) - 1
+}
+
+func (asm * assembler) here() int32 {
+	return int32(len(asm.program.code))
+}
+
+func (asm * assembler) constant(value Value) {
+	asm.program.constants = append(asm.program.constants, value)
+	asm.emit(opConstant, len(asm.program.constants) - 1, 0, 0)
+}
+
+func (asm * assembler) expression(expression Value) {
+	switch val := expression.(type) {
+	case Tuple:
+		if val.Arity() == 0 {
+			asm.constant(val)
+			return
+		}
+		asm.emit(opEnter, 0, 0, 0)
+		location, located := asm.locations.Find(val)
+		if located {
+			asm.program.locations = append(asm.program.locations, location)
+			asm.emit(opLocate, len(asm.program.locations) - 1, 0, 0)
+		}
+		asm.tuple(val)
+		if located {
+			asm.emit(opUnlocate, 0, 0, 0)
+		}
+		asm.emit(opLeave, 0, 0, 0)
+	case Tag:
+		asm.emit(opEnter, 0, 0, 0)
+		asm.call(val, []Value{})
+		asm.emit(opLeave, 0, 0, 0)
+	default:
+		asm.constant(val)
+	}
+}
+
+func (asm * assembler) tuple(expression Tuple) {
+	head := expression.Get(0)
+	if expression.Arity() == 1 {
+		asm.expression(head)
+		return
+	}
+	args := arguments(expression)
+	if tag, ok := head.(Tag); ok {
+		asm.call(tag, args)
+		return
+	}
+	asm.expression(head)
+	for _, arg := range args {
+		asm.expression(arg)
+	}
+	asm.emit(opApply, 0, len(args), 0)
+}
+
+func (asm * assembler) call(head Tag, args []Value) {
+	asm.program.sites = append(asm.program.sites, callSite{head, args})
+	site := len(asm.program.sites) - 1
+	asm.emit(opLookup, site, 0, 0)
+
+	ends := []int{}
+	switch {
+	case head.Name == "if" && len(args) == 3:
+		inline := asm.emit(opInline, site, 0, 0)
+		asm.expression(args[0])
+		jumpIfFalse := asm.emit(opJumpIfFalse, 0, 0, 0)
+		asm.expression(args[1])
+		ends = append(ends, asm.emit(opJump, 0, 0, 0))
+		asm.program.code[jumpIfFalse].a = asm.here()
+		asm.expression(args[2])
+		ends = append(ends, asm.emit(opJump, 0, 0, 0))
+		asm.program.code[inline].b = asm.here()
+	case head.Name == "progn":
+		inline := asm.emit(opInline, site, 0, 0)
+		if len(args) == 0 {
+			asm.constant(tuple.EMPTY)
+		}
+		for k, arg := range args {
+			asm.expression(arg)
+			if k < len(args) - 1 {
+				asm.emit(opPop, 0, 0, 0)
+			}
+		}
+		ends = append(ends, asm.emit(opJump, 0, 0, 0))
+		asm.program.code[inline].b = asm.here()
+	}
+
+	for k, arg := range args {
+		skip := asm.emit(opArg, site, k, 0)
+		asm.expression(arg)
+		asm.emit(opConvert, site, k, 0)
+		asm.program.code[skip].c = asm.here()
+	}
+	asm.emit(opInvoke, site, len(args), 0)
+	for _, end := range ends {
+		asm.program.code[end].a = asm.here()
+	}
+}
+
+// A call is a tail call when its result is returned.
+func (asm * assembler) markTailCalls() {
+	code := asm.program.code
+	for k, ins := range code {
+		if ins.op != opInvoke && ins.op != opApply {
+			continue
+		}
+		pc := k + 1
+		for code[pc].op == opLeave || code[pc].op == opUnlocate || code[pc].op == opJump {
+			if code[pc].op == opJump {
+				pc = int(code[pc].a)
+			} else {
+				pc += 1
+			}
+		}
+		if code[pc].op == opReturn {
+			code[k].c = 1
+		}
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// The bytecode of each tuple evaluated, identified as for the compiled code.
+type ProgramCache struct {
+	programs codeTable
+	calls map[string]*Program  // Of tags
+	mutex *sync.Mutex
+}
+
+func NewProgramCache() ProgramCache {
+	return ProgramCache{newCodeTable(), map[string]*Program{}, &sync.Mutex{}}
+}
+
+func (cache * ProgramCache) Program(global GlobalScope, expression Value) *Program {
+	switch val := expression.(type) {
+	case Tuple:
+		if val.Arity() == 0 {
+			break
+		}
+		if program, ok := cache.programs.find(val); ok {
+			return program.(*Program)
+		}
+		program := Assemble(global.Locations(), val)
+		cache.programs.add(val, program)
+		return program
+	case Tag:
+		cache.mutex.Lock()
+		defer cache.mutex.Unlock()
+		program, ok := cache.calls[val.Name]
+		if ! ok {
+			program = Assemble(global.Locations(), val)
+			cache.calls[val.Name] = program
+		}
+		return program
+	}
+	return Assemble(global.Locations(), expression)
+}
+
+// The number of tuples assembled.
+func (cache * ProgramCache) Size() int {
+	return cache.programs.size()
+}
+
+// Evaluates the expression's bytecode, it is assembled the first time.
+func (cache * ProgramCache) Run(context EvalContext, expression Value) (Value, error) {
+	machine := machine{}
+	return machine.run(context, cache.Program(context.GlobalScope(), expression))
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+type machine struct {
+	stack []interface{}  // Values and arguments converted to golang types
+	callees []callee
+	frames []frame
+}
+
+type callee struct {
+	f reflect.Value
+	plan * callPlan
+	function Function
+	isFunction bool
+	macro Macro
+	isMacro bool
+	overloads Overloads
+	isOverloaded bool
+}
+
+type frame struct {
+	program * Program
+	pc int
+	scope EvalContext
+	function Function
+	isFunction bool  // Otherwise the expression being run
+	base int  // Of the stack
+	depth int64  // Of the budget when called
+	located []locatedAt
+	replaced []string  // Functions whose frames were replaced by tail calls, the latest last
+}
+
+type locatedAt struct {
+	location Location
+	previous Location
+}
+
+func (machine * machine) push(value interface{}) {
+	machine.stack = append(machine.stack, value)
+}
+
+func (machine * machine) pop() interface{} {
+	value := machine.stack[len(machine.stack) - 1]
+	machine.stack = machine.stack[:len(machine.stack) - 1]
+	return value
+}
+
+func (machine * machine) popValues(n int) []Value {
+	values := make([]Value, n)
+	for k, value := range machine.stack[len(machine.stack) - n:] {
+		values[k] = value.(Value)
+	}
+	machine.stack = machine.stack[:len(machine.stack) - n]
+	return values
+}
+
+func (machine * machine) run(context EvalContext, program * Program) (Value, error) {
+	global := context.GlobalScope()
+	budget := global.Budget()
+	depth := budget.depth
+	calls := budget.calls
+	machine.frames = append(machine.frames, frame{program: program, scope: context, depth: depth})
+	for {
+		frame := &machine.frames[len(machine.frames) - 1]
+		ins := frame.program.code[frame.pc]
+		frame.pc += 1
+		var err error
+		switch ins.op {
+		case opConstant:
+			if err = enter(global); err == nil {
+				budget.Leave()
+				machine.push(frame.program.constants[ins.a])
+			}
+		case opEnter:
+			err = enter(global)
+		case opLeave:
+			budget.Leave()
+		case opLocate:
+			location := frame.program.locations[ins.a]
+			frame.located = append(frame.located, locatedAt{location, global.Location()})
+			global.SetLocation(location)
+		case opUnlocate:
+			last := frame.located[len(frame.located) - 1]
+			frame.located = frame.located[:len(frame.located) - 1]
+			global.SetLocation(last.previous)
+		case opLookup:
+			site := frame.program.sites[ins.a]
+			_, f := frame.scope.Find(frame.scope, site.head, site.args)
+			found := callee{f: f}
+			switch f.Type() {
+			case FunctionType:
+				found.function = f.Interface().(Function)
+				found.isFunction = true
+			case MacroType:
+				found.macro = f.Interface().(Macro)
+				found.isMacro = true
+			case OverloadsType:
+				found.overloads = f.Interface().(Overloads)
+				found.isOverloaded = true
+			default:
+				found.plan = planOf(f.Type())
+			}
+			machine.callees = append(machine.callees, found)
+		case opInline:
+			found := machine.callees[len(machine.callees) - 1]
+			if found.plan == nil || found.f.Pointer() != inlined[frame.program.sites[ins.a].head.Name] {
+				frame.pc = int(ins.b)
+			} else {
+				machine.callees = machine.callees[:len(machine.callees) - 1]
+			}
+		case opArg:
+			found := machine.callees[len(machine.callees) - 1]
+			arg := frame.program.sites[ins.a].args[ins.b]
+			if unevaluated, ok := found.unevaluated(int(ins.b), arg); ok {
+				machine.push(unevaluated)
+				frame.pc = int(ins.c)
+			}
+		case opConvert:
+			found := machine.callees[len(machine.callees) - 1]
+			if found.plan != nil && found.plan.kinds[ins.b] == convertArg {
+				top := len(machine.stack) - 1
+				machine.stack[top], err = Convert(frame.scope, machine.stack[top].(Value), found.plan.types[ins.b])
+			}
+		case opInvoke:
+			found := machine.callees[len(machine.callees) - 1]
+			machine.callees = machine.callees[:len(machine.callees) - 1]
+			if found.isFunction {
+				err = machine.call(global, found.function, machine.popValues(int(ins.b)), ins.c == 1)
+				break
+			}
+			if found.isMacro {
+				machine.popValues(int(ins.b))
+				var result Value
+				result, err = found.macro.Call(frame.scope, frame.program.sites[ins.a].args)
+				machine.push(result)
+				break
+			}
+			if found.isOverloaded {
+				var result Value
+				result, err = found.overloads.Apply(frame.scope, frame.program.sites[ins.a].head, machine.popValues(int(ins.b)))
+				if err == nil {
+					err = budget.AllocateValue(result)
+					machine.push(result)
+				}
+				break
+			}
+			args := machine.stack[len(machine.stack) - int(ins.b):]
+			var result Value
+			result, err = found.plan.invoke(frame.scope, found.f, frame.program.sites[ins.a].head, args)
+			machine.stack = machine.stack[:len(machine.stack) - int(ins.b)]
+			if err == nil {
+				err = budget.AllocateValue(result)
+				machine.push(result)
+			}
+		case opApply:
+			values := machine.popValues(int(ins.b))
+			head := machine.pop()
+			if function, ok := head.(Function); ok {
+				err = machine.call(global, function, values, ins.c == 1)
+				break
+			}
+			newTuple := tuple.NewTuple(head.(Value))
+			newTuple.List = append(newTuple.List, values...)
+			err = budget.AllocateValue(newTuple)
+			machine.push(newTuple)
+		case opJump:
+			frame.pc = int(ins.a)
+		case opJumpIfFalse:
+			var condition interface{}
+			condition, err = Convert(frame.scope, machine.pop().(Value), BoolType)
+			if err == nil && ! condition.(bool) {
+				frame.pc = int(ins.a)
+			}
+		case opPop:
+			machine.pop()
+		case opReturn:
+			result := machine.pop().(Value)
+			budget.depth = frame.depth
+			if frame.isFunction {
+				budget.Return()
+			}
+			machine.frames = machine.frames[:len(machine.frames) - 1]
+			if len(machine.frames) == 0 {
+				return result, nil
+			}
+			err = budget.AllocateValue(result)
+			machine.push(result)
+		}
+		if err != nil {
+			return tuple.EMPTY, machine.fail(global, err, depth, calls)
+		}
+	}
+}
+
+func enter(global GlobalScope) error {
+	if err := global.Cancellation().Err(); err != nil {
+		return err
+	}
+	return global.Budget().Enter()
+}
+
+// The argument passed to a builtin when it is not evaluated.
+func (found callee) unevaluated(k int, arg Value) (interface{}, bool) {
+	switch {
+	case found.isMacro: return arg, true
+	case found.isFunction, found.isOverloaded: return nil, false
+	case found.plan.variadic: return arg, true
+	case found.plan.kinds[k] == quotedArg: return Quoted{arg}, true
+	case found.plan.kinds[k] == tagArg:
+		_, isTag := arg.(Tag)
+		return arg, isTag
+	}
+	return nil, false
+}
+
+// Pushes a frame to call a script function or, for a tail call, replaces the caller's frame
+// unwinding what it was evaluating.
+func (machine * machine) call(global GlobalScope, function Function, values []Value, tail bool) error {
+	if err := function.checkArity(len(values)); err != nil {
+		return err
+	}
+	scope := function.scope.NewLocalScope()
+	for k, value := range values {
+		bind(scope, function.params[k].Name, value)
+	}
+	program := global.Programs().Program(global, function.code)
+	caller := &machine.frames[len(machine.frames) - 1]
+	if tail && caller.isFunction {
+		if len(caller.located) > 0 {
+			global.SetLocation(caller.located[0].previous)
+		}
+		global.Budget().depth = caller.depth
+		replaced := append(caller.replaced, caller.function.name)
+		if len(replaced) > replacedFrames {
+			replaced = replaced[1:]
+		}
+		machine.stack = machine.stack[:caller.base]
+		*caller = frame{program: program, scope: scope, function: function, isFunction: true, base: caller.base, depth: caller.depth, replaced: replaced}
+		return nil
+	}
+	if err := global.Budget().Call(); err != nil {
+		return err
+	}
+	called := frame{program: program, scope: scope, function: function, isFunction: true, base: len(machine.stack), depth: global.Budget().depth}
+	machine.frames = append(machine.frames, called)
+	return nil
+}
+
+// Unwinds all the frames recording where the error was raised as Eval would.
+func (machine * machine) fail(global GlobalScope, err error, depth int64, calls int64) error {
+	for k := len(machine.frames) - 1; k >= 0; k -= 1 {
+		frame := &machine.frames[k]
+		for j := len(frame.located) - 1; j >= 0; j -= 1 {
+			err = withLocation(err, frame.located[j].location)
+			global.SetLocation(frame.located[j].previous)
+		}
+		if frame.isFunction {
+			err = withFrames(withFrame(err, frame.function.name), frame.replaced)
+		}
+	}
+	machine.frames = nil
+	global.Budget().depth = depth
+	global.Budget().calls = calls
+	return err
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// Calls a builtin with its arguments already evaluated and converted.
+func (plan * callPlan) invoke(context EvalContext, f reflect.Value, head Tag, args []interface{}) (Value, error) {
+	if ! plan.variadic {
+		switch function := f.Interface().(type) {
+		case func () Value:
+			return function(), nil
+		case func (Value) (Value, error):
+			return function(args[0].(Value))
+		case func (Value, Value) (Value, error):
+			return function(args[0].(Value), args[1].(Value))
+		case func (Value, Value) (bool, error):
+			result, err := function(args[0].(Value), args[1].(Value))
+			if err != nil {
+				return nil, err
+			}
+			return Bool(result), nil
+		}
+	}
+	start := 0
+	if plan.takesContext {
+		start = 1
+	}
+	reflectedArgs := make([]reflect.Value, len(args) + start)
+	if plan.takesContext {
+		reflectedArgs[0] = reflect.ValueOf(context)
+	}
+	for k, arg := range args {
+		if arg == nil {
+			return tuple.EMPTY, errors.New("Unexpected nil head=" + head.Name)
+		}
+		reflectedArgs[k + start] = reflect.ValueOf(arg)
+	}
+	call := ReflectCall{f, f.Type(), start, reflectedArgs}
+	return call.Call(context, head.Name)
+}
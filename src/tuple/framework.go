@@ -66,6 +66,10 @@ type Float64 float64
 type Int64 int64
 type Bool bool
 
+// Null is the absence of a value, the result of a void function or a missing index,
+// as distinct from the empty tuple.
+type Null struct{}
+
 // A Tag - a name for something, an identifier or operator
 type Tag struct {
 	Name string
@@ -109,9 +113,26 @@ type Context interface {
 	Close()
 	EOL()
 	ReadRune() (rune, error)
+	UnreadRune() error
 	LookAhead() rune
 	Log(level string, format string, args ...interface{})
+	// Logs at a location other than the current one, such as the start of a line already read.
+	LogAt(location Location, level string, format string, args ...interface{})
 	Errors() int64
+
+	// Where the values produced so far were found in the source.
+	Locations() Locations
+
+	// Marks the character just read as the start of a token,
+	// the span runs from there to the character most recently read.
+	Mark()
+	Span() Span
+}
+
+// An error that knows where in the source it was raised, such as an error evaluating a value.
+type LocatedError interface {
+	error
+	Location() (Location, bool)
 }
 
 func Suffix(context Context) string {
@@ -126,6 +147,7 @@ func Suffix(context Context) string {
 var CONS_ATOM = Tag{"_cons"}
 var NAN Float64 = Float64(math.NaN())
 var EMPTY Tuple = NewTuple()
+var NULL Null = Null{}
 const DOUBLE_QUOTE = "\""
 
 // TODO an atom is pretty subjective, should be grammar specific
@@ -175,35 +197,41 @@ func (value String) Arity() int { return 0 }
 func (value Float64) Arity() int { return 0 }
 func (value Int64) Arity() int { return 0 }
 func (value Bool) Arity() int { return 0 }
+func (value Null) Arity() int { return 0 }
 
 func (value Tag) ForallValues(next func(value Value) error) error { return ForallInArray(value, next) }
 func (value String) ForallValues(next func(value Value) error) error { return ForallInArray(value, next) }
 func (value Float64) ForallValues(next func(value Value) error) error { return ForallInArray(value, next) }
 func (value Int64) ForallValues(next func(value Value) error) error { return ForallInArray(value, next) }
 func (value Bool) ForallValues(next func(value Value) error) error { return ForallInArray(value, next) }
+func (value Null) ForallValues(next func(value Value) error) error { return nil }
 func (value Tuple) ForallValues(next func(value Value) error) error { return ForallInArray(value, next) }
 
 func (value Tag) Get(index int) Value {
 	if index == 0 {
 		return String(value.Name)
 	}
-	return EMPTY
+	return NULL
 }
 func (value String) Get(index int) Value {
 	if index >=0 && index < len(string(value)) {
 		return String(value[index])
 	}
-	return EMPTY
+	return NULL
 }
 func (value Float64) Get(index int) Value { return Int64(int64(value)) }
 func (value Int64) Get(index int) Value { return Bool(NthBitOfInt(int64(value), index)) }
 func (value Bool) Get(_ int) Value { return value }  // TODO should this return EMPTY or just itself??
+func (value Null) Get(_ int) Value { return NULL }
 
 func (value Tag) GetKeyValue(index int) (Tag, Value) { return IntToTag(index), value.Get(index) }
 func (value String) GetKeyValue(index int) (Tag, Value) { return IntToTag(index), value.Get(index) }
 func (value Float64) GetKeyValue(index int) (Tag, Value) { return IntToTag(index), value.Get(index) }
 func (value Int64) GetKeyValue(index int) (Tag, Value) { return IntToTag(index), value.Get(index) }
 func (value Bool) GetKeyValue(index int) (Tag, Value) { return IntToTag(index), value.Get(index) }
+func (value Null) GetKeyValue(index int) (Tag, Value) { return IntToTag(index), NULL }
+
+func (value Null) String() string { return "null" }
 
 ////////////////////////////////////////////////////////////////////////////
 // Tuple
@@ -222,49 +250,84 @@ func (tuple Tuple) Get(index int) Value {
 	if index >= 0 && index < len(tuple.List) {
 		return tuple.List[index]
 	}
-	return NAN  // TODO perhaps this should be an error or EMPTY
+	return NULL
 }
 func (tuple Tuple) GetKeyValue(index int) (Tag,Value) {
 	return IntToTag(index), tuple.Get(index)
 }
 
+// Copies of a tuple share its list, appending to one does not change the others. The spare
+// capacity after the list is only used if no other copy has used it already, an element is never nil
+// so an unused slot is nil. A tuple is meant to be built by one goroutine, see Vector for sharing.
 func (tuple *Tuple) Append(token Value) {
 	AssertNotNil(token)
-	tuple.List = append(tuple.List, token)
+	list := tuple.List
+	if n := len(list); n < cap(list) && list[:n+1][n] != nil {
+		list = append(make([]Value, 0, 2*n + 1), list...)
+	}
+	tuple.List = append(list, token)
 }
 
+// The list is copied so copies of the tuple are unchanged.
 func (tuple *Tuple) Set(index int, token Value) {
 	AssertNotNil(token)
-	tuple.List[index] = token
+	list := append([]Value{}, tuple.List...)
+	list[index] = token
+	tuple.List = list
 }
 
 /////////////////////////////////////////////////////////////////////////////
 //  An implementation of the Map interface
 /////////////////////////////////////////////////////////////////////////////
 
+// Keys are kept in the order they were first added so maps are printed
+// and iterated the same way every time. Copies share the same elements.
 type TagValueMap struct {
 	elements map[Tag]Value
+	keys *[]Tag
 }
 
 func NewTagValueMap() TagValueMap {
-	return TagValueMap{make(map[Tag]Value)}
+	return TagValueMap{make(map[Tag]Value), &[]Tag{}}
+}
+
+// Replacing the value of an existing key keeps its position. The zero
+// TagValueMap is an empty map and is allocated on the first Add.
+func (mapp * TagValueMap) Add(key Tag, value Value) {
+	if mapp.keys == nil {
+		*mapp = NewTagValueMap()
+	}
+	if _, ok := mapp.elements[key]; ! ok {
+		*mapp.keys = append(*mapp.keys, key)
+	}
+	mapp.elements[key] = value
 }
 
-func (mapp * TagValueMap) Add(key Tag, value Value) { mapp.elements[key] = value }
+func (mapp TagValueMap) Get(key Tag) (Value, bool) {
+	value, ok := mapp.elements[key]
+	return value, ok
+}
 
 func (mapp TagValueMap) Arity() int { return len(mapp.elements) }
 
+func (mapp TagValueMap) orderedKeys() []Tag {
+	if mapp.keys == nil {
+		return nil
+	}
+	return *mapp.keys
+}
+
 func (mapp TagValueMap) ForallKeyValue(next KeyValueFunction) {
-	for k, v := range mapp.elements {
-		next(k, v)
+	for _, k := range mapp.orderedKeys() {
+		next(k, mapp.elements[k])
 	}
 }
 
 func (mapp TagValueMap) ForallValues(next func(value Value) error) error {
-	for _, v := range mapp.elements {
-		err := next(v)
+	for _, k := range mapp.orderedKeys() {
+		err := next(mapp.elements[k])
 		if err != nil {
-			return nil
+			return err
 		}
 	}
 	return nil
@@ -286,7 +349,7 @@ func (array StringArray) Get(index int) Value {
 	if index >= 0 && index < len(array.slice) {
 		return String(array.slice[index])
 	}
-	return EMPTY
+	return NULL
 }
 
 func (array StringArray) GetKeyValue(index int) (Tag,Value) {
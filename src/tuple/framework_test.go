@@ -3,8 +3,11 @@ package tuple_test
 import (
 	"testing"
 	"tuple"
-//	"strings"
+	"strings"
 	"math"
+	"fmt"
+	"runtime"
+	"time"
 //	"tuple/parsers"
 )
 
@@ -102,3 +105,164 @@ func TestConversions(t *testing.T) {
 		t.Errorf("Expected")
 	}
 }
+
+func TestNumbers(t *testing.T) {
+	test := func(value tuple.Value, ok bool, expected string) {
+		if ! ok || fmt.Sprintf("%T %v", value, value) != expected {
+			t.Errorf("Expected '%s' got '%T %v'", expected, value, value)
+		}
+	}
+
+	value, ok := tuple.IntegerFromString("9223372036854775807", 10)
+	test(value, ok, "tuple.Int64 9223372036854775807")
+	value, ok = tuple.IntegerFromString("9223372036854775808", 10)
+	test(value, ok, "tuple.BigInt 9223372036854775808")
+	value, ok = tuple.IntegerFromString("ffffffffffffffffff", 16)
+	test(value, ok, "tuple.BigInt 4722366482869645213695")
+	value, ok = tuple.FloatFromString("1.5")
+	test(value, ok, "tuple.Float64 1.5")
+	value, ok = tuple.FloatFromString("0.10000000000000000001")
+	test(value, ok, "tuple.Decimal 0.10000000000000000001")
+	value, ok = tuple.FloatFromString("1e400")
+	test(value, ok, "tuple.Decimal 1"+strings.Repeat("0", 400)+".0")
+	if _, ok := tuple.IntegerFromString("12a", 10); ok {
+		t.Errorf("Expected '12a' not to be an integer")
+	}
+
+	decimal, ok := tuple.ParseDecimal("-12.3400")
+	if ! ok || decimal.String() != "-12.34" || decimal.Scale() != 2 {
+		t.Errorf("Expected -12.34 got '%s'", decimal)
+	}
+	if _, ok := tuple.ParseDecimal("1/3"); ok {
+		t.Errorf("Expected 1/3 not to be a decimal")
+	}
+}
+
+func TestLocations(t *testing.T) {
+	locations := tuple.NewLocations()
+	location := tuple.NewLocation("test", 1, 0, 0)
+
+	value := tuple.NewTuple(tuple.Int64(1))
+	other := tuple.NewTuple(tuple.Int64(1))
+	mapp := tuple.NewTagValueMap()
+	locations.Add(value, location)
+	locations.Add(mapp, location)
+	locations.Add(tuple.Int64(1), location)
+
+	if found, ok := locations.Find(value); ! ok || found != location {
+		t.Errorf("Expected location of tuple got '%v'", found)
+	}
+	if _, ok := locations.Find(mapp); ! ok {
+		t.Errorf("Expected location of map")
+	}
+	if _, ok := locations.Find(other); ok {
+		t.Errorf("Expected no location for an equal but different tuple")
+	}
+	if _, ok := locations.Find(tuple.Int64(1)); ok {
+		t.Errorf("Expected no location for a scalar")
+	}
+
+	// The table does not keep the values it refers to
+	for k := 0; k < 1000; k += 1 {
+		locations.Add(tuple.NewTuple(tuple.Int64(k)), location)
+	}
+	for k := 0; k < 100 && locations.Len() > 2; k += 1 {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	if locations.Len() != 2 {
+		t.Errorf("Expected the locations of collected values to be forgotten got %d", locations.Len())
+	}
+	runtime.KeepAlive(value)
+	runtime.KeepAlive(mapp)
+}
+
+func TestNewLocation(t *testing.T) {
+	location := tuple.NewLocation("file.json", 12, 5, 2)
+	if location.Line() != 12 || location.Column() != 5 || location.Depth() != 2 || location.Offset() != 0 {
+		t.Errorf("Expected line 12, column 5 and depth 2 got '%v'", location)
+	}
+	if location.String() != "file.json:12:5" {
+		t.Errorf("Expected 'file.json:12:5' got '%s'", location)
+	}
+	if text := tuple.NewLocation("file.json", 0, 0, 0).String(); text != "file.json" {
+		t.Errorf("Expected 'file.json' got '%s'", text)
+	}
+
+	location.Advance('é', 2)
+	location.Advance('\n', 1)
+	location.Advance('a', 1)
+	if location.Line() != 13 || location.Column() != 1 || location.Offset() != 3 {
+		t.Errorf("Expected line 13, column 1 and offset 3 got '%v', %d", location, location.Offset())
+	}
+}
+
+func TestDefaultLocationLogger(t *testing.T) {
+	var buffer strings.Builder
+	logger := tuple.NewWriterLocationLogger(&buffer)
+	logger(tuple.NewLocation("file.json", 12, 5, 0), "ERROR", "Unexpected '}'")
+	if buffer.String() != "file.json:12:5: error: Unexpected '}'\n" {
+		t.Errorf("Expected compiler format got '%s'", buffer.String())
+	}
+}
+
+func TestTagValueMapOrder(t *testing.T) {
+	mapp := tuple.NewTagValueMap()
+	mapp.Add(tuple.Tag{"z"}, tuple.Int64(1))
+	mapp.Add(tuple.Tag{"a"}, tuple.Int64(2))
+	mapp.Add(tuple.Tag{"m"}, tuple.Int64(3))
+	mapp.Add(tuple.Tag{"z"}, tuple.Int64(4))
+
+	keys := ""
+	mapp.ForallKeyValue(func (key tuple.Tag, value tuple.Value) {
+		keys += key.Name
+	})
+	if keys != "zam" || mapp.Arity() != 3 {
+		t.Errorf("Expected keys in insertion order 'zam' got '%s'", keys)
+	}
+	if value, ok := mapp.Get(tuple.Tag{"z"}); ! ok || value != tuple.Int64(4) {
+		t.Errorf("Expected replaced value 4 got '%v'", value)
+	}
+}
+
+func TestTagValueMapZeroValue(t *testing.T) {
+	var mapp tuple.TagValueMap
+	if mapp.Arity() != 0 {
+		t.Errorf("Expected an empty map got arity %d", mapp.Arity())
+	}
+	mapp.ForallKeyValue(func (key tuple.Tag, value tuple.Value) {
+		t.Errorf("Expected no keys got '%s'", key.Name)
+	})
+	if _, ok := mapp.Get(tuple.Tag{"a"}); ok {
+		t.Errorf("Expected no value for 'a'")
+	}
+
+	mapp.Add(tuple.Tag{"b"}, tuple.Int64(1))
+	mapp.Add(tuple.Tag{"a"}, tuple.Int64(2))
+	keys := ""
+	mapp.ForallValues(func (value tuple.Value) error {
+		keys += tuple.Int64ToString(value.(tuple.Int64))
+		return nil
+	})
+	if keys != "12" || mapp.Arity() != 2 {
+		t.Errorf("Expected values '12' got '%s'", keys)
+	}
+}
+
+func TestTupleCopies(t *testing.T) {
+	original := tuple.NewTuple(tuple.Int64(1), tuple.Int64(2))
+	original.Append(tuple.Int64(3))
+	first, second := original, original
+	first.Append(tuple.String("first"))
+	second.Append(tuple.String("second"))
+	second.Set(0, tuple.String("zero"))
+	if original.Arity() != 3 || original.Get(0) != tuple.Int64(1) {
+		t.Errorf("Expected the original to be unchanged got %v", original)
+	}
+	if first.Get(3) != tuple.String("first") || first.Get(0) != tuple.Int64(1) {
+		t.Errorf("Expected first to keep its element got %v", first)
+	}
+	if second.Get(3) != tuple.String("second") || second.Get(0) != tuple.String("zero") {
+		t.Errorf("Expected second to keep its elements got %v", second)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package tuple
+
+import "fmt"
+import "runtime"
+import "sync"
+import "unsafe"
+import "weak"
+
+/////////////////////////////////////////////////////////////////////////////
+// Locations
+/////////////////////////////////////////////////////////////////////////////
+
+// Records the location in the source that each value was parsed from.
+//
+// The values are unchanged, instead a value is identified by its underlying storage
+// so only non empty tuples and maps have a location. The table does not keep the values
+// alive, the location of a value is forgotten once the value has been garbage collected
+// so a table can be shared by a long running evaluator. It is safe to use from several goroutines.
+type Locations struct {
+	locations map[locationKey]*locationEntry
+	mutex *sync.Mutex
+}
+
+type locationKey struct {
+	address uintptr
+	arity int
+}
+
+// Refers weakly to the value so a new value at the same address is not mistaken for it.
+type locationEntry struct {
+	location Location
+	first weak.Pointer[Value] // The first element of a tuple
+	keys weak.Pointer[[]Tag]  // The keys of a map
+}
+
+func NewLocations() Locations {
+	return Locations{make(map[locationKey]*locationEntry), &sync.Mutex{}}
+}
+
+// The storage identifying a value, either the first element of a tuple or the keys of a map.
+func storageOf(value Value) (locationKey, *Value, *[]Tag, bool) {
+	switch value.(type) {
+	case Tuple:
+		list := value.(Tuple).List
+		if len(list) > 0 {
+			return locationKey{uintptr(unsafe.Pointer(&list[0])), len(list)}, &list[0], nil, true
+		}
+	case TagValueMap:
+		keys := value.(TagValueMap).keys
+		if keys != nil {
+			return locationKey{uintptr(unsafe.Pointer(keys)), 0}, nil, keys, true
+		}
+	}
+	return locationKey{}, nil, nil, false
+}
+
+func (entry *locationEntry) refersTo(first *Value, keys *[]Tag) bool {
+	if first != nil {
+		return entry.first.Value() == first
+	}
+	return entry.keys.Value() == keys
+}
+
+func (locations Locations) Add(value Value, location Location) {
+	if locations.locations == nil {
+		return
+	}
+	key, first, keys, ok := storageOf(value)
+	if ! ok {
+		return
+	}
+	locations.mutex.Lock()
+	defer locations.mutex.Unlock()
+	if entry, ok := locations.locations[key]; ok && entry.refersTo(first, keys) {
+		entry.location = location
+		return
+	}
+	entry := &locationEntry{location: location}
+	if first != nil {
+		entry.first = weak.Make(first)
+		runtime.AddCleanup(first, locations.forget, locationCleanup{key, entry})
+	} else {
+		entry.keys = weak.Make(keys)
+		runtime.AddCleanup(keys, locations.forget, locationCleanup{key, entry})
+	}
+	locations.locations[key] = entry
+}
+
+type locationCleanup struct {
+	key locationKey
+	entry *locationEntry
+}
+
+// Called once a value has been garbage collected, unless its address has been reused since.
+func (locations Locations) forget(cleanup locationCleanup) {
+	locations.mutex.Lock()
+	defer locations.mutex.Unlock()
+	if locations.locations[cleanup.key] == cleanup.entry {
+		delete(locations.locations, cleanup.key)
+	}
+}
+
+func (locations Locations) Find(value Value) (Location, bool) {
+	key, first, keys, ok := storageOf(value)
+	if ! ok || locations.locations == nil {
+		return Location{}, false
+	}
+	locations.mutex.Lock()
+	defer locations.mutex.Unlock()
+	entry, ok := locations.locations[key]
+	if ! ok || ! entry.refersTo(first, keys) {
+		return Location{}, false
+	}
+	return entry.location, true
+}
+
+// The number of values with a location.
+func (locations Locations) Len() int {
+	if locations.locations == nil {
+		return 0
+	}
+	locations.mutex.Lock()
+	defer locations.mutex.Unlock()
+	return len(locations.locations)
+}
+
+// Copies the location of one value to another that replaces it.
+func (locations Locations) Copy(from Value, to Value) {
+	if location, ok := locations.Find(from); ok {
+		locations.Add(to, location)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Span
+/////////////////////////////////////////////////////////////////////////////
+
+// The part of a source between two locations, both inclusive, such as a token.
+type Span struct {
+	start Location
+	end Location
+}
+
+func NewSpan(start Location, end Location) Span {
+	return Span{start, end}
+}
+
+func (span Span) Start() Location {
+	return span.start
+}
+
+func (span Span) End() Location {
+	return span.end
+}
+
+// The number of bytes in the span.
+func (span Span) Length() int64 {
+	return span.end.next - span.start.offset
+}
+
+// Formats the span as 'file:line:column-line:column' or 'file:line:column-column' on a single line.
+func (span Span) String() string {
+	start, end := span.start, span.end
+	switch {
+	case start.line == 0 || (start.line == end.line && start.column == end.column):
+		return start.String()
+	case start.line == end.line:
+		return fmt.Sprintf("%s-%d", start, end.column)
+	default:
+		return fmt.Sprintf("%s-%d:%d", start, end.line, end.column)
+	}
+}
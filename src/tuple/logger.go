@@ -18,6 +18,9 @@ package tuple
 
 import "log"
 import "fmt"
+import "io"
+import "os"
+import "strings"
 
 /////////////////////////////////////////////////////////////////////////////
 // Logger
@@ -40,28 +43,38 @@ func Error(logger Logger, format string, args ...interface{}) {
 	logger.Log("ERROR", format, args...)
 }
 
+func ErrorAt(context Context, location Location, format string, args ...interface{}) {
+	context.LogAt(location, "ERROR", format, args...)
+}
+
 /////////////////////////////////////////////////////////////////////////////
 // Location
 /////////////////////////////////////////////////////////////////////////////
 
 type LocationLogger func (location Location, level string, message string)
 
-// The Context interface represents the current state of parsing and translation.
-// It can provide: the name of the input and current depth and number of errors
+// A position in a source: the name of the input, the byte offset, line and column of
+// the character most recently read and the current depth of nesting.
+// Lines and columns count from one, a line or column of zero means it is not known.
 type Location struct {
 	sourceName string
+	offset int64
 	line int64
 	column int64
 	depth int
+	next int64 // The offset of the character after this one
 }
 
 func NewLocation(sourceName string, line int64, column int64, depth int) Location {
-	return Location{sourceName, 1, 0, 0}
+	return Location{sourceName, 0, line, column, depth, 0}
 }
 
 func (location Location) SourceName() string {
 	return location.sourceName
 }
+func (location Location) Offset() int64 {
+	return location.offset
+}
 func (location Location) Line() int64 {
 	return location.line
 }
@@ -78,6 +91,16 @@ func (location * Location) IncrLine() {
 func (location * Location) IncrColumn() {
 	location.column += 1
 }
+// Moves on to a character taking size bytes in the source.
+func (location * Location) Advance(ch rune, size int) {
+	location.offset = location.next
+	location.next += int64(size)
+	if ch == '\n' {
+		location.IncrLine()
+	} else {
+		location.IncrColumn()
+	}
+}
 func (location * Location) IncrDepth() {
 	location.depth += 1
 }
@@ -87,6 +110,18 @@ func (location * Location) DecrDepth() {
 	}
 }
 
+// Formats the location as compilers do, 'file:line:column', so editors can jump to it.
+func (location Location) String() string {
+	switch {
+	case location.line == 0:
+		return location.sourceName
+	case location.column == 0:
+		return fmt.Sprintf("%s:%d", location.sourceName, location.line)
+	default:
+		return fmt.Sprintf("%s:%d:%d", location.sourceName, location.line, location.column)
+	}
+}
+
 /////////////////////////////////////////////////////////////////////////////
 
 func GetLogger(logGrammar Grammar, verbose bool) LocationLogger {
@@ -118,10 +153,15 @@ func NewVerboseFilterLogger(verbose bool, logger LocationLogger) LocationLogger
 	}
 }
 
+// Logs to stderr in the format used by compilers: 'file:line:column: level: message'.
 func NewDefaultLocationLogger() LocationLogger {
+	return NewWriterLocationLogger(os.Stderr)
+}
+
+func NewWriterLocationLogger(writer io.Writer) LocationLogger {
+	logger := log.New(writer, "", 0)
 	return func (context Location, level string, message string) {
-		prefix := fmt.Sprintf("%s at %d, %d depth=%d in '%s': %s", level, context.Line(), context.Column(), context.Depth(), context.SourceName(), message)
-		log.Print(prefix)
+		logger.Printf("%s: %s: %s", context, strings.ToLower(level), message)
 	}
 }
 
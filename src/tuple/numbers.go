@@ -0,0 +1,196 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package tuple
+
+import "errors"
+import "math/big"
+import "strconv"
+import "strings"
+
+/////////////////////////////////////////////////////////////////////////////
+// Arbitrary precision numbers
+/////////////////////////////////////////////////////////////////////////////
+
+// An integer too large for an Int64.
+type BigInt struct {
+	value *big.Int
+}
+
+// An exact decimal number: the unscaled integer divided by ten to the power of the scale.
+// Decimals are kept normalised, without trailing zeros after the decimal point,
+// so equal values are identical.
+type Decimal struct {
+	unscaled *big.Int
+	scale int
+}
+
+func NewBigInt(value *big.Int) BigInt {
+	return BigInt{new(big.Int).Set(value)}
+}
+
+func NewDecimal(unscaled *big.Int, scale int) Decimal {
+	unscaled = new(big.Int).Set(unscaled)
+	ten := big.NewInt(10)
+	remainder := new(big.Int)
+	for scale > 0 {
+		quotient, _ := new(big.Int).QuoRem(unscaled, ten, remainder)
+		if remainder.Sign() != 0 {
+			break
+		}
+		unscaled = quotient
+		scale -= 1
+	}
+	for scale < 0 {
+		unscaled.Mul(unscaled, ten)
+		scale += 1
+	}
+	return Decimal{unscaled, scale}
+}
+
+func (value BigInt) Arity() int { return 0 }
+func (value Decimal) Arity() int { return 0 }
+func (value BigInt) ForallValues(next func(value Value) error) error { return nil }
+func (value Decimal) ForallValues(next func(value Value) error) error { return nil }
+
+// A copy of the value.
+func (value BigInt) Int() *big.Int {
+	return new(big.Int).Set(value.value)
+}
+
+func (value BigInt) String() string {
+	return value.value.String()
+}
+
+func (value BigInt) Float64() float64 {
+	result, _ := new(big.Float).SetInt(value.value).Float64()
+	return result
+}
+
+func (value Decimal) Unscaled() *big.Int {
+	return new(big.Int).Set(value.unscaled)
+}
+
+func (value Decimal) Scale() int {
+	return value.scale
+}
+
+func (value Decimal) Rat() *big.Rat {
+	denominator := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(value.scale)), nil)
+	return new(big.Rat).SetFrac(value.unscaled, denominator)
+}
+
+func (value Decimal) Float64() float64 {
+	result, _ := value.Rat().Float64()
+	return result
+}
+
+// Always includes a decimal point so the value is read back as a decimal.
+func (value Decimal) String() string {
+	digits := new(big.Int).Abs(value.unscaled).String()
+	sign := ""
+	if value.unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if value.scale == 0 {
+		return sign + digits + ".0"
+	}
+	if len(digits) <= value.scale {
+		digits = strings.Repeat("0", value.scale - len(digits) + 1) + digits
+	}
+	point := len(digits) - value.scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Parses a decimal literal such as '-12.50' or '1.5e3'.
+func ParseDecimal(text string) (Decimal, bool) {
+	rat, ok := new(big.Rat).SetString(text)
+	if ! ok {
+		return Decimal{}, false
+	}
+	// A terminating decimal has a denominator of 2**twos * 5**fives, needing the larger as the scale
+	denominator := new(big.Int).Set(rat.Denom())
+	twos, fives := 0, 0
+	remainder := new(big.Int)
+	for _, factor := range []int64{2, 5} {
+		divisor := big.NewInt(factor)
+		for {
+			quotient, _ := new(big.Int).QuoRem(denominator, divisor, remainder)
+			if remainder.Sign() != 0 {
+				break
+			}
+			denominator = quotient
+			if factor == 2 {
+				twos += 1
+			} else {
+				fives += 1
+			}
+		}
+	}
+	if denominator.Cmp(big.NewInt(1)) != 0 {
+		return Decimal{}, false
+	}
+	scale := twos
+	if fives > scale {
+		scale = fives
+	}
+	ten := big.NewInt(10)
+	power := new(big.Int).Exp(ten, big.NewInt(int64(scale)), nil)
+	unscaled := new(big.Int).Mul(rat.Num(), power)
+	unscaled.Quo(unscaled, rat.Denom())
+	return NewDecimal(unscaled, scale), true
+}
+
+// Reads an integer literal as an Int64 or a BigInt when it is too large.
+func IntegerFromString(text string, base int) (Value, bool) {
+	if value, err := strconv.ParseInt(text, base, 64); err == nil {
+		return Int64(value), true
+	}
+	value, ok := new(big.Int).SetString(text, base)
+	if ! ok {
+		return nil, false
+	}
+	return IntegerFromBig(value), true
+}
+
+// Reads a literal with a decimal point or exponent as a Float64 unless a float cannot hold it exactly
+// as written, in which case it is a Decimal. So 0.1 is a float but 0.10000000000000000001 is a decimal.
+func FloatFromString(text string) (Value, bool) {
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil && ! errors.Is(err, strconv.ErrRange) {
+		return nil, false
+	}
+	decimal, ok := ParseDecimal(text)
+	if ! ok {
+		return Float64(value), err == nil
+	}
+	if roundTrip, ok := ParseDecimal(strconv.FormatFloat(value, 'g', -1, 64)); ok && decimal.Equal(roundTrip) {
+		return Float64(value), true
+	}
+	return decimal, true
+}
+
+// An integer is an Int64 whenever it fits.
+func IntegerFromBig(value *big.Int) Value {
+	if value.IsInt64() {
+		return Int64(value.Int64())
+	}
+	return NewBigInt(value)
+}
+
+func (value Decimal) Equal(other Decimal) bool {
+	return value.scale == other.scale && value.unscaled.Cmp(other.unscaled) == 0
+}
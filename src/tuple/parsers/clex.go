@@ -17,10 +17,12 @@
 package parsers
 
 import "io"
+import "errors"
 import "unicode"
 import "strconv"
 import "math"
 import "unicode/utf8"
+import "strings"
 import "tuple"
 //import "reflect"
 
@@ -67,6 +69,7 @@ type Style struct {
 	LineBreak string
 	True string
 	False string
+	Null string  // The literal for tuple.NULL, recognised by the lexer when not empty
 	OneLineComment rune
 	ScalarPrefix string
 
@@ -77,6 +80,7 @@ type Style struct {
 	KeyValueSeparatorRune rune
 
 	RecognizeNegative bool
+	RecognizeQuotes bool  // ' ` , and ,@ as in Lisp
 
 	//
 	// TODO provide a lexer that understands indent grammars than use indentation rather than brackets to denote nesting.
@@ -111,8 +115,8 @@ func NewStyle(
 	closeChar2, _ := utf8.DecodeRuneInString(Close2)
 	KeyValueSeparatorRune, _ := utf8.DecodeRuneInString(KeyValueSeparator)
 
-	return Style{StartDoc,EndDoc,Indent, Open,Close,Open2,Close2,KeyValueSeparator,Separator,LineBreak,True,False,OneLineComment,ScalarPrefix,
-		openChar,closeChar,openChar2,closeChar2,KeyValueSeparatorRune, false}
+	return Style{StartDoc,EndDoc,Indent, Open,Close,Open2,Close2,KeyValueSeparator,Separator,LineBreak,True,False,"",OneLineComment,ScalarPrefix,
+		openChar,closeChar,openChar2,closeChar2,KeyValueSeparatorRune, false, false}
 }
 
 /////////////////////////////////////////////////////////////////////////////
@@ -135,6 +139,7 @@ func (style Style) GetNext(context Context, eol func(), open func(open string),
 	}
 
 	ch, err := context.ReadRune()
+	context.Mark()
 	switch {
 	case err != nil: return err
 	case err == io.EOF:
@@ -159,7 +164,14 @@ func (style Style) GetNext(context Context, eol func(), open func(open string),
 			return err
 		}
 		nextLiteral(value)
-	case ch == '.' && context.LookAhead() == '.': nextTag(Tag{".."})
+	case ch == '.' && context.LookAhead() == '.':
+		context.ReadRune()
+		if context.LookAhead() == '.' {
+			context.ReadRune()
+			nextTag(Tag{"..."})
+		} else {
+			nextTag(Tag{".."})
+		}
 	case ((ch == '.' || (ch== '-' && style.RecognizeNegative)) && unicode.IsNumber(context.LookAhead())) || unicode.IsNumber(ch): // TODO || ch == '+' 
 		value, err := ReadNumber(context, string(ch))    // TODO minus
 		if err != nil {
@@ -171,6 +183,8 @@ func (style Style) GetNext(context Context, eol func(), open func(open string),
 			nextLiteral(value)
 		}
 	case ch == style.KeyValueSeparatorRune:		nextTag(tuple.CONS_ATOM)
+	case style.RecognizeQuotes && (ch == '\'' || ch == '`'): nextTag(Tag{string(ch)})
+	case style.RecognizeQuotes && ReadAndLookAhead(ch, ',', '@'):
 	case ch == ',':
 	case ch == ';':  nextTag(Tag{";"})
 	case ReadAndLookAhead(ch, '.', '.'):
@@ -188,7 +202,9 @@ func (style Style) GetNext(context Context, eol func(), open func(open string),
 		if err != nil {
 			return err
 		}
-		if tag, ok := value.(Tag); ok {
+		if tag, ok := value.(Tag); ok && style.Null != "" && tag.Name == style.Null {
+			nextLiteral(tuple.NULL)
+		} else if ok {
 			nextTag(tag)
 		} else {
 			nextLiteral(value)
@@ -269,20 +285,19 @@ func ReadNumber(context Context, token string) (Value, error) {  // Number
 	if token == "." {
 		return Tag{"."}, nil
 	}
+	// Integers too large for an Int64 are BigInts and decimals a float cannot hold exactly are Decimals
+	var value Value
+	var ok bool
 	switch dots {
 	case 0:
-		value, err := strconv.ParseInt(token, 10, 0)  // TODO no need to parse as int64, could treat as bigint
-		if err != nil {
-			return Int64(0), err
-		}
-		return Int64(value), nil
+		value, ok = tuple.IntegerFromString(token, 10)
 	default:
-		value, err := strconv.ParseFloat(token, 64)
-		if err != nil {
-			return Float64(0), err
-		}
-		return Float64(value), nil
-	} 
+		value, ok = tuple.FloatFromString(token)
+	}
+	if ! ok {
+		return Int64(0), errors.New("Invalid number: " + token)
+	}
+	return value, nil
 }
 
 func ReadUntilEndOfLine(context Context) (string, error) {
@@ -304,6 +319,26 @@ func ReadUntilEndOfLine(context Context) (string, error) {
 	}
 }
 
+// Reads the rest of the current line and the line break, returns false at the end of input.
+func ReadLine(context Context) (string, bool) {
+	var builder strings.Builder
+	for {
+		ch, err := context.ReadRune()
+		switch {
+		case err == io.EOF:
+			return builder.String(), builder.Len() > 0
+		case err != nil:
+			Error(context, "%s", err)
+			return builder.String(), builder.Len() > 0
+		case ch == NEWLINE:
+			context.EOL()
+			return strings.TrimSuffix(builder.String(), "\r"), true
+		default:
+			builder.WriteRune(ch)
+		}
+	}
+}
+
 func ReadCLanguageString(context Context) (String, error) {
 	token := "\""
 	for {
@@ -362,6 +397,14 @@ func (printer Style) PrintEmptyTuple(depth string, out StringFunction) {
 	out(printer.Close)
 }
 
+func (printer Style) PrintNull(depth string, out StringFunction) {
+	if printer.Null == "" {
+		out(tuple.NULL.String())
+	} else {
+		out(printer.Null)
+	}
+}
+
 func (printer Style) PrintNullaryOperator(depth string, tag Tag, out StringFunction) {
 	PrintTuple(&printer, depth, NewTuple(tag), out)
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"strconv"
 	"fmt"
+	"reflect"
 )
 
 const NO_RESULT = "..."
@@ -66,6 +67,8 @@ func testLex1(t *testing.T, logger tuple.LocationLogger) {
 	testGetNext(t, logger, "abc123", "abc123")
 	testGetNext(t, logger, "+", "+")
 	testGetNext(t, logger, ">=", ">=")
+	testGetNext(t, logger, "..", "..")
+	testGetNext(t, logger, "...", "...")
 	testGetNext(t, logger, "(", "(")
 	//testGetNext(t, logger, "[", "]")
 	//testGetNext(t, logger, "{", "}")
@@ -85,3 +88,26 @@ func TestCLanguageOperators(t *testing.T) {
 		}
 	})
 }
+
+func TestSpan(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("(a\n  \"bc\" d)"))
+	context := parsers.NewParserContext("test.l", reader, tuple.NewVerboseFilterLogger(false, tuple.NewDefaultLocationLogger()))
+	spans := []string{}
+	next := func(value tuple.Value) {
+		spans = append(spans, context.Span().String())
+	}
+	style := parsers.LispStyle()
+	for {
+		err := style.GetNext(&context, func() {}, func(string) {}, func(string) {}, func(tag tuple.Tag) { next(tag) }, next)
+		if err != nil {
+			break
+		}
+	}
+	expected := []string{"test.l:1:2", "test.l:2:3-6", "test.l:2:8"}
+	if ! reflect.DeepEqual(spans, expected) {
+		t.Errorf("Expected %v got %v", expected, spans)
+	}
+	if start := context.Span().Start(); start.Offset() != 11 {
+		t.Errorf("Expected offset 11 got %d", start.Offset())
+	}
+}
@@ -19,7 +19,7 @@ import "fmt"
 import "tuple"
 import "errors"
 
-func consFilterFinal(expression Value) (Value,error) {// TODO add context for errors and make a Tuple
+func consFilterFinal(expression Value, locations tuple.Locations) (Value,error) {// TODO add context for errors and make a Tuple
 
 	//fmt.Printf("Tuple: %s\n", expression)
 	if isCons(expression) {
@@ -28,13 +28,15 @@ func consFilterFinal(expression Value) (Value,error) {// TODO add context for er
 		if err != nil {
 			return nil, err
 		}
+		locations.Copy(expression, mapp)
 		//context.Log("VERBOSE", "Map len '%d'", mapp.Arity())
 		return mapp, nil
 	}
 	return expression, nil
 }
 
-func consFilter(expression Tuple) (Value,error) {// TODO add context for errors and make a Tuple
+// The locations of cons cells replaced by maps are copied to the maps.
+func consFilter(expression Tuple, locations tuple.Locations) (Value,error) {// TODO add context for errors and make a Tuple
 
 	arity := expression.Arity()
 	if arity == 0 {
@@ -51,16 +53,27 @@ func consFilter(expression Tuple) (Value,error) {// TODO add context for errors
 		}
 		return mapp, nil
 	}
+	var values []Value
 	for k := 1; k < arity; k+=1 {
 		element := expression.Get(k)
 		if isCons(element) {
 			mapp := tuple.NewTagValueMap()
 			addConsToMap(mapp, element)
-			expression.Set(k, mapp)
+			locations.Copy(element, mapp)
+			if values == nil {
+				values = append([]Value{}, expression.List...)
+			}
+			values[k] = mapp
 		}
 
 	}
-	return expression, nil
+	if values == nil {
+		return expression, nil
+	}
+	// A new tuple rather than changing the one parsed, which may be shared
+	result := NewTuple(values...)
+	locations.Copy(expression, result)
+	return result, nil
 }
 
 func addConsToMap(mapp tuple.TagValueMap, value Value) error {
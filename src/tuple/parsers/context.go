@@ -17,6 +17,7 @@
 package parsers
 
 import "tuple"
+import gocontext "context"
 import 	"io"
 import 	"fmt"
 
@@ -30,10 +31,16 @@ type LocationLogger = tuple.LocationLogger
 
 type ParserContext struct {
 	location Location
+	previous Location  // Before the rune most recently read, restored when it is unread
+	last rune
 	errors int64
 	scanner io.RuneScanner
 	logger LocationLogger
 	eolCallback func(context Context)
+	locations tuple.Locations
+	start Location
+	cancellation gocontext.Context
+	done <-chan struct{}  // Of the cancellation, checked for each rune read
 }
 
 func NewParserContext(sourceName string, scanner io.RuneScanner, logger LocationLogger) ParserContext {
@@ -42,7 +49,8 @@ func NewParserContext(sourceName string, scanner io.RuneScanner, logger Location
 
 func NewParserContext2(sourceName string, scanner io.RuneScanner, logger LocationLogger, eol func(context Context)) ParserContext {
 	initialLocation := tuple.NewLocation(sourceName, 1, 0, 0)
-	context :=  ParserContext{initialLocation, 0, scanner, logger, eol}
+	cancellation := gocontext.Background()
+	context :=  ParserContext{initialLocation, initialLocation, 0, 0, scanner, logger, eol, tuple.NewLocations(), initialLocation, cancellation, cancellation.Done()}
 	tuple.Verbose(&context,"Parsing file [%s] suffix [%s]", sourceName, tuple.Suffix(&context))
 	return context
 }
@@ -51,6 +59,30 @@ func (context * ParserContext) Location() Location {
 	return context.location
 }
 
+func (context * ParserContext) Mark() {
+	context.start = context.location
+}
+
+func (context * ParserContext) Span() tuple.Span {
+	return tuple.NewSpan(context.start, context.location)
+}
+
+func (context * ParserContext) Locations() tuple.Locations {
+	return context.locations
+}
+
+// Records locations in a table shared with, for instance, an evaluator rather than the context's own.
+func (context * ParserContext) SetLocations(locations tuple.Locations) {
+	context.locations = locations
+}
+
+// Parsing stops with the cancellation's error when it is cancelled, values already parsed will
+// have been passed on.
+func (context * ParserContext) SetCancellation(cancellation gocontext.Context) {
+	context.cancellation = cancellation
+	context.done = cancellation.Done()
+}
+
 func (context * ParserContext) Errors() int64 {
 	return context.errors
 }
@@ -70,23 +102,43 @@ func (context * ParserContext) EOL() {
 }
 
 func (context * ParserContext) ReadRune() (rune, error) {
-	ch, _, err := context.scanner.ReadRune()
-	switch {
-	case err != nil: return ch, err
-	case ch == '\n':
-		context.location.IncrLine()
-		tuple.Verbose(context,"New line")
+	select {
+	case <-context.done: return 0, context.cancellation.Err()
 	default:
-		context.location.IncrColumn()
+	}
+	ch, size, err := context.scanner.ReadRune()
+	if err != nil {
+		if context.last == '\n' {
+			// The input ends with a line break, the end is the end of the last line rather than a line that is not there
+			context.location = context.previous
+			context.last = 0
+		}
+		return ch, err
+	}
+	context.previous = context.location
+	context.last = ch
+	context.location.Advance(ch, size)
+	if ch == '\n' {
+		tuple.Verbose(context,"New line")
 	}
 	return ch, nil
 }
 
+// Pushes back the rune most recently read, only one rune can be unread.
+func (context * ParserContext) UnreadRune() error {
+	err := context.scanner.UnreadRune()
+	if err != nil {
+		return err
+	}
+	context.location = context.previous
+	context.last = 0
+	return nil
+}
+
 func (context * ParserContext) LookAhead() rune {
 	ch, _, err := context.scanner.ReadRune()
 	if err != nil {
 		// TODO Is this okay to just return false rather than an error
-		context.scanner.UnreadRune()
 		return ' '
 	}
 	context.scanner.UnreadRune()
@@ -95,11 +147,15 @@ func (context * ParserContext) LookAhead() rune {
 }
 
 func (context * ParserContext) Log(level string, format string, args ...interface{}) {
+	context.LogAt(context.location, level, format, args...)
+}
+
+func (context * ParserContext) LogAt(location Location, level string, format string, args ...interface{}) {
 
 	switch level {
 	case "ERROR": context.errors += 1
 	default:
 	}
 	suffix := fmt.Sprintf(format, args...)
-	context.logger(context.location, level, suffix)
+	context.logger(location, level, suffix)
 }
@@ -0,0 +1,313 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package parsers
+import "tuple"
+import "io"
+import "strings"
+
+/////////////////////////////////////////////////////////////////////////////
+// CSV and TSV Grammars
+/////////////////////////////////////////////////////////////////////////////
+
+type CsvGrammar struct {
+	style Style
+	name string
+	suffix string
+	delimiter rune
+	header bool // Whether the first record names the columns
+	columns *[]Tag // The header most recently printed to the stream, if any
+}
+
+// A grammar whose printer remembers what it has printed, such as a CSV header,
+// provides a printer for each output stream.
+type StreamPrinter interface {
+	NewStream() Grammar
+}
+
+func (grammar CsvGrammar) Name() string {
+	return grammar.name
+}
+
+func (grammar CsvGrammar) FileSuffix() string {
+	return grammar.suffix
+}
+
+// Parses each record into a value, when the grammar has a header each record after the first
+// is a map from the column names to the fields otherwise each record is a tuple of fields.
+// Missing fields at the end of a record are empty strings.
+func (grammar CsvGrammar) Parse(context Context, next Next) error {
+	var header []Tag
+	first := grammar.header
+	for {
+		location := context.Location()
+		fields, ok := grammar.readRecord(context)
+		if ! ok {
+			return nil
+		}
+		if first {
+			first = false
+			header = csvHeader(context, location, fields)
+			continue
+		}
+		var err error
+		if header == nil {
+			values := NewTuple()
+			for _, field := range fields {
+				values.Append(field.value())
+			}
+			context.Locations().Add(values, location)
+			err = next(values)
+		} else {
+			if len(fields) > len(header) {
+				Error(context, "Expected at most %d fields but found %d", len(header), len(fields))
+			}
+			record := tuple.NewTagValueMap()
+			for k, column := range header {
+				if k < len(fields) {
+					record.Add(column, fields[k].value())
+				} else {
+					record.Add(column, String(""))
+				}
+			}
+			context.Locations().Add(record, location)
+			err = next(record)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type csvField struct {
+	text string
+	quoted bool
+}
+
+// Quoted fields are always strings, otherwise a field may be a number or a boolean.
+func (field csvField) value() Value {
+	if field.quoted {
+		return String(field.text)
+	}
+	return iniScalar(field.text)
+}
+
+func csvHeader(context Context, location Location, fields []csvField) []Tag {
+	header := []Tag{}
+	unique := map[string]bool{}
+	for _, field := range fields {
+		if field.text == "" || unique[field.text] {
+			ErrorAt(context, location, "Expected a unique column name not '%s'", field.text)
+		}
+		unique[field.text] = true
+		header = append(header, Tag{field.text})
+	}
+	return header
+}
+
+// Reads the fields of the next record skipping blank lines, returns false at the end of input.
+// A quoted field may contain delimiters and line breaks and a quote is escaped by doubling it.
+func (grammar CsvGrammar) readRecord(context Context) ([]csvField, bool) {
+	fields := []csvField{}
+	var builder strings.Builder
+	field := csvField{}
+	started := false
+	for {
+		ch, err := context.ReadRune()
+		if err != nil {
+			if err != io.EOF {
+				Error(context, "%s", err)
+			}
+			if ! started {
+				return nil, false
+			}
+			field.text = builder.String()
+			return append(fields, field), true
+		}
+		started = true
+		switch {
+		case ch == '"' && builder.Len() == 0 && ! field.quoted:
+			field.quoted = true
+			grammar.readQuoted(context, &builder)
+		case ch == grammar.delimiter:
+			field.text = builder.String()
+			fields = append(fields, field)
+			builder.Reset()
+			field = csvField{}
+		case ch == '\r':
+		case ch == NEWLINE:
+			context.EOL()
+			if len(fields) == 0 && builder.Len() == 0 && ! field.quoted {
+				started = false
+				continue
+			}
+			field.text = builder.String()
+			return append(fields, field), true
+		default:
+			if field.quoted {
+				Error(context, "Unexpected '%c' after quoted field", ch)
+			}
+			builder.WriteRune(ch)
+		}
+	}
+}
+
+func (grammar CsvGrammar) readQuoted(context Context, builder *strings.Builder) {
+	for {
+		ch, err := context.ReadRune()
+		switch {
+		case err != nil:
+			Error(context, "Missing close quote: '%s'", DOUBLE_QUOTE)
+			return
+		case ch == '"':
+			if context.LookAhead() != '"' {
+				return
+			}
+			context.ReadRune()
+			builder.WriteRune(ch)
+		case ch == NEWLINE:
+			context.EOL()
+			builder.WriteRune(ch)
+		default:
+			builder.WriteRune(ch)
+		}
+	}
+}
+
+// Returns a printer that prints a header only when the columns differ from those it printed last.
+func (grammar CsvGrammar) NewStream() Grammar {
+	grammar.columns = &[]Tag{}
+	return grammar
+}
+
+// Prints a map as a record preceded by a header when its columns differ from those previously printed,
+// a tuple of maps or tuples is printed as a record for each element, any other tuple is a single record.
+func (grammar CsvGrammar) Print(token Value, out func(value string)) {
+	if grammar.columns == nil {
+		grammar.columns = &[]Tag{}
+	}
+	switch token.(type) {
+	case tuple.Map:
+		grammar.printRecord(token.(tuple.Map), out)
+	case Tuple, tuple.Vector:
+		rows, _ := tuple.AsTuple(token)
+		for _, row := range rows.List {
+			if IsAtom(row) {
+				grammar.printFields(rows.List, out)
+				return
+			}
+		}
+		for _, row := range rows.List {
+			grammar.Print(row, out)
+		}
+	default:
+		grammar.printFields([]Value{token}, out)
+	}
+}
+
+func (grammar CsvGrammar) printRecord(record tuple.Map, out func(value string)) {
+	columns := []Tag{}
+	values := map[Tag]Value{}
+	record.ForallKeyValue(func (key Tag, value Value) {
+		columns = append(columns, key)
+		values[key] = value
+	})
+	if ! sameColumns(columns, *grammar.columns) {
+		*grammar.columns = columns
+		header := []Value{}
+		for _, column := range columns {
+			header = append(header, String(column.Name))
+		}
+		grammar.printFields(header, out)
+	}
+	fields := []Value{}
+	for _, column := range columns {
+		fields = append(fields, values[column])
+	}
+	grammar.printFields(fields, out)
+}
+
+func sameColumns(a []Tag, b []Tag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+func (grammar CsvGrammar) printFields(fields []Value, out func(value string)) {
+	for k, field := range fields {
+		if k > 0 {
+			out(grammar.style.Separator)
+		}
+		out(grammar.quoteIfNeeded(field))
+	}
+	out(grammar.style.LineBreak)
+}
+
+// Fields containing a delimiter, quote or line break are quoted as are strings that would otherwise be read as numbers.
+func (grammar CsvGrammar) quoteIfNeeded(value Value) string {
+	text := ""
+	quote := false
+	switch value.(type) {
+	case Tag: text = value.(Tag).Name
+	case String:
+		text = string(value.(String))
+		_, literal := iniScalar(text).(String)
+		quote = ! literal
+	case Bool, Int64, Float64, BigInt, Decimal: PrintScalar(grammar.style, "", value, func (value string) { text += value })
+	default:
+		if value.Arity() != 0 {
+			NewJSONGrammar().Print(value, func (value string) { text += value })
+		}
+	}
+	if quote || strings.ContainsAny(text, string(grammar.delimiter) + "\"\r\n") {
+		return DOUBLE_QUOTE + strings.ReplaceAll(text, DOUBLE_QUOTE, DOUBLE_QUOTE + DOUBLE_QUOTE) + DOUBLE_QUOTE
+	}
+	return text
+}
+
+func newCsvGrammar(name string, suffix string, delimiter rune, lineBreak string, header bool) Grammar {
+	style := NewStyle("", "", "",
+		"", "", "", "", "",
+		string(delimiter), lineBreak, "true", "false", '#', "")
+	return CsvGrammar{style, name, suffix, delimiter, header, nil}
+}
+
+// The first record is a header.
+func NewCsvGrammar() Grammar {
+	return NewCsvGrammarWithHeader(true)
+}
+
+func NewCsvGrammarWithHeader(header bool) Grammar {
+	// https://en.wikipedia.org/wiki/Comma-separated_values
+	// https://www.rfc-editor.org/rfc/rfc4180
+	return newCsvGrammar("CSV", ".csv", ',', "\r\n", header)
+}
+
+// The first record is a header.
+func NewTsvGrammar() Grammar {
+	return NewTsvGrammarWithHeader(true)
+}
+
+func NewTsvGrammarWithHeader(header bool) Grammar {
+	// https://en.wikipedia.org/wiki/Tab-separated_values
+	return newCsvGrammar("TSV", ".tsv", '\t', "\n", header)
+}
@@ -0,0 +1,105 @@
+package parsers_test
+
+import (
+	"testing"
+	"tuple"
+	"tuple/parsers"
+	"reflect"
+)
+
+func parseAll(t *testing.T, grammar tuple.Grammar, text string) []tuple.Value {
+	values := []tuple.Value{}
+	_, err := parsers.RunParser(grammar, text, logger, func (value tuple.Value) error {
+		values = append(values, value)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Given '%s' got error '%s'", text, err)
+	}
+	return values
+}
+
+func TestCsvParse(t *testing.T) {
+	var grammar = parsers.NewCsvGrammarWithHeader(false)
+
+	test := func(csv string, expected ...tuple.Value) {
+		values := parseAll(t, grammar, csv)
+		if len(values) != len(expected) || (len(values) > 0 && ! reflect.DeepEqual(values, expected)) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", csv, expected, values)
+		}
+	}
+
+	test("")
+	test("0,1", tuple.NewTuple(zero, one))
+	// Without a header a record of text is data
+	a := tuple.String("a")
+	b := tuple.String("b")
+	test("a,b\nb,a\n", tuple.NewTuple(a, b), tuple.NewTuple(b, a))
+	test("0,1\r\n\r\n1,0\r\n", tuple.NewTuple(zero, one), tuple.NewTuple(one, zero))
+	test("\"a,b\",\"say \"\"hi\"\"\",\"1\",1\n", tuple.NewTuple(tuple.String("a,b"), tuple.String("say \"hi\""), tuple.String("1"), one))
+	test("1,\"two\nlines\",\n", tuple.NewTuple(one, tuple.String("two\nlines"), tuple.String("")))
+
+	grammar = parsers.NewCsvGrammar()
+	test("")
+	test("a,b\n")
+	first := tuple.NewTagValueMap()
+	first.Add(Tag{"name"}, tuple.String("a b"))
+	first.Add(Tag{"count"}, one)
+	second := tuple.NewTagValueMap()
+	second.Add(Tag{"name"}, tuple.String("c"))
+	second.Add(Tag{"count"}, tuple.String(""))
+	test("name,count\na b,1\nc\n", first, second)
+	test("\"name\",count\r\n\"a b\",1\r\nc,\r\n", first, second)
+
+	var tsv = parsers.NewTsvGrammar()
+	values := parseAll(t, tsv, "name\tcount\na b\t1\n")
+	if ! reflect.DeepEqual(values, []tuple.Value{first}) {
+		t.Errorf("Expected '%v' got '%v'", first, values)
+	}
+}
+
+func TestCsvRoundTrip(t *testing.T) {
+
+	test := func(grammar tuple.Grammar, text string) {
+		values := parseAll(t, grammar, text)
+		printed := ""
+		printer := grammar.(parsers.StreamPrinter).NewStream()
+		for _, value := range values {
+			printer.Print(value, func(value string) {
+				printed += value
+			})
+		}
+		result := parseAll(t, grammar, printed)
+		if ! reflect.DeepEqual(values, result) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", text, values, result)
+		}
+	}
+
+	test(parsers.NewCsvGrammarWithHeader(false), "0,1\n2,\"3\"\n")
+	test(parsers.NewCsvGrammarWithHeader(false), "a,b\nc,d\n")
+	test(parsers.NewCsvGrammar(), "a,b,c\n1,\"x, y\",\"80\"\n2,\"say \"\"hi\"\"\",\"two\nlines\"\n")
+}
+
+func TestCsvStreams(t *testing.T) {
+	var grammar = parsers.NewCsvGrammar()
+
+	record := tuple.NewTagValueMap()
+	record.Add(Tag{"a"}, one)
+	print := func(printer tuple.Grammar) string {
+		printed := ""
+		printer.Print(record, func(value string) {
+			printed += value
+		})
+		return printed
+	}
+
+	// Each stream prints its own header
+	first := grammar.(parsers.StreamPrinter).NewStream()
+	second := grammar.(parsers.StreamPrinter).NewStream()
+	if print(first) != "a\r\n1\r\n" || print(first) != "1\r\n" || print(second) != "a\r\n1\r\n" {
+		t.Errorf("Expected a header for each stream")
+	}
+	if print(grammar) != "a\r\n1\r\n" || print(grammar) != "a\r\n1\r\n" {
+		t.Errorf("Expected a header for each value printed without a stream")
+	}
+}
@@ -85,7 +85,7 @@ func (grammar InfixExpressionGrammar) Parse(context Context, next Next) error {
 				if context.Location().Depth() == 0 {
 					err := operatorGrammar.EndOfInput(next)
 					if err != nil {
-						Error(context, "%s", err)
+						operatorGrammar.LogError(err)
 					}
 				}
 			},
@@ -175,7 +175,7 @@ func (grammar ShellGrammar) Parse(context Context, next Next) error {
 				if context.Location().Depth() == 0 {
 					err := operatorGrammar.EndOfInput(next)
 					if err != nil {
-						Error(context, "%s", err)
+						operatorGrammar.LogError(err)
 					}
 				} else if ! operatorGrammar.wasOperator {
 					operatorGrammar.PushOperator(Tag{";"})
@@ -109,7 +109,7 @@ func TestExpr(t *testing.T) {
 
 	test("0", tuple.Int64(0))
 	test("1", tuple.Int64(1))
-	test("-1", tuple.Float64(-1))
+	test("-1", tuple.Int64(-1))
 
 	test("-1.", tuple.Float64(-1.))
 	test(".0", tuple.Float64(.0))
@@ -277,9 +277,9 @@ func TestExprDeclareFunctions(t *testing.T) {
 	test("nth(0  ( 1 2 3 )) == 1")
 	test("nth(1  ( 1 2 3 )) == 2")
 	test("nth(2  ( 1 2 3 )) == 3")
-	test("nth((-1) ( 1 2 3 )) != 1")
+	test("isnull(nth((-1) ( 1 2 3 )))")
 	// TODO BUG in operator grammar test("nth(-1 ( 1 2 3 )) != 1")
-	test("nth(3  ( 1 2 3 )) != 4")
+	test("isnull(nth(3  ( 1 2 3 )))")
 
 	test("-1 == progn(1+2 3+4 cos(PI))")
 	// TODO uses assign test("6==progn (m=3) (s=2) (m*s)")
@@ -16,154 +16,144 @@
 */
 package parsers
 import "tuple"
+import "strings"
+import "strconv"
 
 func Quote(value string, out func(value string)) {
 	out(tuple.DoubleQuotedString(value))
 }
 
 /////////////////////////////////////////////////////////////////////////////
-// Yaml Grammar
+// Ini Grammar
 /////////////////////////////////////////////////////////////////////////////
 
-// http://www.yamllint.com/
-type Yaml struct {
-	Style
-}
-
-func (grammar Yaml) Name() string {
-	return "Yaml"
+type Ini struct {
+	style Style
 }
 
-func (grammar Yaml) FileSuffix() string {
-	return ".yaml"
+func (grammar Ini) Name() string {
+	return "Ini"
 }
 
-func (grammar Yaml) Parse(context Context, _ Next) error {
-	Error(context, "Not implemented file suffix: '%s'", grammar.FileSuffix())
-	return nil
+func (grammar Ini) FileSuffix() string {
+	return ".ini"
 }
 
-// TODO Replace with Printer
-func (grammar Yaml) printObject(depth string, token Value, out func(value string)) {
-
-	style := grammar.Style
-
-	if IsAtom(token) {
-		out(depth)
-		switch token.(type) {
-		case Tag:
-			out(style.ScalarPrefix)
-			Quote(token.(Tag).Name, out)
-		default:
-			PrintScalar(grammar, "", token, out)
+// Parses an INI file into a map of sections, each section is a map of keys to values.
+// Keys that appear before the first section are added directly to the top level map
+// and a key repeated within a section has a tuple of all its values.
+func (grammar Ini) Parse(context Context, next Next) error {
+	root := tuple.NewTagValueMap()
+	context.Locations().Add(root, context.Location())
+	sections := map[string]*iniSection{"": &iniSection{root, map[Tag]Value{}}}
+	section := sections[""]
+	empty := true
+	for {
+		location := context.Location()
+		line, ok := ReadLine(context)
+		if ! ok {
+			break
 		}
-
-	} else {
-		tuple := token.(Tuple)
-		out(depth)
-		out(style.ScalarPrefix)
-		len := tuple.Arity()
-		out(style.LineBreak)
-		depth = depth + style.Indent
-		tag, first := Head(tuple)
-		newDepth := depth
-		if first {
-			out(depth)
-			Quote(tag.Name, out)
-			out(style.Open)
-			out(style.LineBreak)
-			newDepth = depth + style.Indent
-		}
-		for k, token := range tuple.List {
-			if ! first || k >0  {
-				grammar.printObject(newDepth, token, out)
-				if k < len-1 {
-					out(style.LineBreak)
-				}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line[0] == ';' || line[0] == '#':
+		case line[0] == '[':
+			end := strings.Index(line, CLOSE_SQUARE_BRACKET)
+			if end < 0 {
+				Error(context, "Missing close bracket '%s' in section header '%s'", CLOSE_SQUARE_BRACKET, line)
+				continue
+			}
+			name := strings.TrimSpace(line[1:end])
+			if existing, ok := sections[name]; ok {
+				section = existing
+			} else {
+				section = &iniSection{tuple.NewTagValueMap(), map[Tag]Value{}}
+				context.Locations().Add(section.mapp, location)
+				sections[name] = section
+				root.Add(Tag{name}, section.mapp)
 			}
+			empty = false
+		default:
+			separator := strings.IndexAny(line, "=:")
+			if separator <= 0 {
+				Error(context, "Expected 'key = value' but found '%s'", line)
+				continue
+			}
+			key := Tag{strings.TrimSpace(line[:separator])}
+			section.add(key, iniValue(context, strings.TrimSpace(line[separator+1:])))
+			empty = false
 		}
 	}
+	if empty {
+		return nil
+	}
+	return next(root)
 }
 
-func (grammar Yaml) Print(object Value, out func(value string)) {
-	// TODO PrintExpression(grammar, "", object, out)  // TODO Use Printer
-	grammar.printObject("", object, out)
-	out (string(NEWLINE))
-}
-
-func NewYamlGrammar() Grammar {
-	style := NewStyle("---\n", "...\n", "  ", 
-		":", "", OPEN_SQUARE_BRACKET, CLOSE_SQUARE_BRACKET, "",
-		"", "\n", "true", "false", '#', "- ")
-	return Yaml{style}
-}
-
-
-func (parser Yaml) PrintIndent(depth string, out StringFunction) {
-	out(depth)
-}
-
-func (parser Yaml) PrintSuffix(depth string, out StringFunction) {
-	out(string(NEWLINE))
-}
-
-func (parser Yaml) PrintSeparator(depth string, out StringFunction) {}
-
-func (parser Yaml) PrintEmptyTuple(depth string, out StringFunction) {
-	out("[]")
-}
-func (parser Yaml) PrintOpenTuple(depth string, tuple Value, out StringFunction) string {
-	out("- ")
-	return depth + "  "
-}
-
-func (parser Yaml) PrintHeadTag(tag Tag, out StringFunction) {
-	Quote(tag.Name, out)
-	out(": ")
-}
-
-func (parser Yaml) PrintCloseTuple(depth string, tuple Value, out StringFunction) {}
-
-func (parser Yaml) PrintTag(depth string, tag Tag, out StringFunction) {
-	Quote(tag.Name, out)
-	//bout(tag.Name)
-}
-
-func (parser Yaml) PrintScalarPrefix(depth string, out StringFunction) {
-	out ("- ")
-}
-
-func (parser Yaml) PrintNullaryOperator(depth string, tag Tag, out StringFunction) {
-	PrintTuple(&parser, depth, NewTuple(tag), out)
-}
-
-func (parser Yaml) PrintUnaryOperator(depth string, tag Tag, value Value, out StringFunction) {
-	PrintTuple(&parser, depth, NewTuple(tag, value), out)
-}
-
-func (parser Yaml) PrintBinaryOperator(depth string, tag Tag, value1 Value, value2 Value, out StringFunction) {
-	PrintTuple(&parser, depth, NewTuple(tag, value1, value2), out)
-}
-
-/////////////////////////////////////////////////////////////////////////////
-// Ini Grammar
-/////////////////////////////////////////////////////////////////////////////
-
-type Ini struct {
-	style Style
-}
-
-func (grammar Ini) Name() string {
-	return "Ini"
+type iniSection struct {
+	mapp tuple.TagValueMap
+	values map[Tag]Value
 }
 
-func (grammar Ini) FileSuffix() string {
-	return ".ini"
+func (section *iniSection) add(key Tag, value Value) {
+	previous, repeated := section.values[key]
+	if repeated {
+		values, ok := previous.(Tuple)
+		if ! ok {
+			values = NewTuple(previous)
+		}
+		values.Append(value)
+		value = values
+	}
+	section.values[key] = value
+	section.mapp.Add(key, value)
+}
+
+// Values are kept as strings, as written, so a file converted to another format and back is unchanged:
+// 'port = 0080' is "0080" rather than 80. Within single quotes a doubled quote is a quote.
+func iniValue(context Context, text string) Value {
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end := yamlClosingQuote(text, 0)
+		if end < 0 {
+			Error(context, "Missing close quote: '%s'", text[:1])
+			return String(text[1:])
+		}
+		if rest := strings.TrimSpace(text[end+1:]); rest != "" && rest[0] != ';' && rest[0] != '#' {
+			Error(context, "Unexpected '%s' after quoted value", rest)
+		}
+		if text[0] == '\'' {
+			return String(strings.ReplaceAll(text[1:end], "''", "'"))
+		}
+		str, err := strconv.Unquote(text[:end+1])
+		if err != nil {
+			Error(context, "Got '%s' err= %s", text[:end+1], err)
+			return String(text[1:end])
+		}
+		return String(str)
+	}
+	for k := 1; k < len(text); k += 1 {
+		if (text[k] == ';' || text[k] == '#') && (text[k-1] == ' ' || text[k-1] == '\t') {
+			text = strings.TrimSpace(text[:k])
+			break
+		}
+	}
+	return String(text)
 }
 
-func (grammar Ini) Parse(context Context, _ Next) error {
-	Error(context, "Not implemented file suffix: '%s'", grammar.FileSuffix())
-	return nil
+func iniScalar(text string) Value {
+	switch {
+	case strings.EqualFold(text, "true"): return Bool(true)
+	case strings.EqualFold(text, "false"): return Bool(false)
+	case integerPattern.MatchString(text):
+		if value, ok := tuple.IntegerFromString(text, 10); ok {
+			return value
+		}
+	case floatPattern.MatchString(text):
+		if value, ok := tuple.FloatFromString(text); ok {
+			return value
+		}
+	}
+	return String(text)
 }
 
 // TODO 
@@ -176,7 +166,7 @@ func (grammar Ini ) printObject(depth string, key string, token Value, out func(
 		out(style.ScalarPrefix)
 		PrintScalar(grammar.style, "", token, out)
 	} else {
-		tuple := token.(Tuple)
+		tuple, _ := tuple.AsTuple(token)
 		len := tuple.Arity()
 		if len == 0 {
 			out(depth)
@@ -221,89 +211,86 @@ func (grammar Ini ) printObject(depth string, key string, token Value, out func(
 }
 
 func (grammar Ini) Print(token Value, out func(value string)) {
+	if mapp, ok := token.(tuple.Map); ok {
+		started := false
+		grammar.printSection("", mapp, &started, out)
+		return
+	}
 	grammar.printObject("", "", token, out)
 	out (string(NEWLINE))
 }
 
-func NewIniGrammar() Grammar {
-	// https://en.wikipedia.org/wiki/INI_file
-	style := NewStyle("", "", "",
-		"", "", "", "", "",
-		"= ", "\n", "true", "false", '#', "=")
-	return Ini{style}
-}
-
-/////////////////////////////////////////////////////////////////////////////
-// PropertyGrammar Grammar
-/////////////////////////////////////////////////////////////////////////////
-
-type PropertyGrammar struct {
-	style Style
-}
-
-func (grammar PropertyGrammar) Name() string {
-	return "PropertyGrammar"
-}
-
-func (grammar PropertyGrammar) FileSuffix() string {
-	return ".properties"
-}
-
-func (grammar PropertyGrammar) Parse(context Context, _ Next) error {
-	Error(context, "Not implemented file suffix: '%s'", grammar.FileSuffix())
-	return nil
-}
-
-func (grammar PropertyGrammar) printObject(depth string, token Value, out func(value string)) {
+// Prints the keys with simple values then each nested map as a section,
+// sections nested within sections are given a dotted name.
+func (grammar Ini) printSection(name string, mapp tuple.Map, started *bool, out func(value string)) {
 	style := grammar.style
-	
-	if IsAtom(token) {
-		out(depth)
-		out(style.ScalarPrefix)
-		PrintScalar(grammar.style, "", token, out)
-	} else {
-		tuple := token.(Tuple)
-		len := tuple.Arity()
-		if len == 0 {
-			out(depth)
-			out(style.ScalarPrefix)
+	mapp.ForallKeyValue(func (key Tag, value Value) {
+		if _, ok := value.(tuple.Map); ok {
 			return
 		}
-		var newDepth string
-		tag, first := Head(tuple)
-		var prefix string
-		if depth == "" {
-			prefix = ""
+		if array, ok := tuple.AsTuple(value); ok && array.Arity() > 0 {
+			for _, element := range array.List {
+				grammar.printKeyValue(key, element, out)
+			}
 		} else {
-			prefix = depth + "."
+			grammar.printKeyValue(key, value, out)
 		}
-		if first {
-			newDepth = prefix + tag.Name
-		} else {
-			newDepth = depth + "."
+		*started = true
+	})
+	mapp.ForallKeyValue(func (key Tag, value Value) {
+		section, ok := value.(tuple.Map)
+		if ! ok {
+			return
 		}
-		for k, token := range tuple.List {
-			if ! first || k >0  {
-				grammar.printObject(newDepth, token, out)
-				if k < len-1 {
-					out(style.Separator)
-					out(style.LineBreak)
-				}
-			}
+		sectionName := key.Name
+		if name != "" {
+			sectionName = name + "." + key.Name
+		}
+		if *started {
+			out(style.LineBreak)
+		}
+		out(OPEN_SQUARE_BRACKET)
+		out(sectionName)
+		out(CLOSE_SQUARE_BRACKET)
+		out(style.LineBreak)
+		*started = true
+		grammar.printSection(sectionName, section, started, out)
+	})
+}
+
+func (grammar Ini) printKeyValue(key Tag, value Value, out func(value string)) {
+	style := grammar.style
+	out(key.Name)
+	out(strings.TrimRight(style.KeyValueSeparator, " "))
+	text := ""
+	switch value.(type) {
+	case Tag: text = iniQuoteIfNeeded(value.(Tag).Name)
+	case String: text = iniQuoteIfNeeded(string(value.(String)))
+	case Bool, Int64, Float64, BigInt, Decimal: PrintScalar(style, "", value, func (value string) { text += value })
+	default:
+		if value.Arity() != 0 {
+			PrintScalar(style, "", value, func (value string) { text += value })  // Cannot be represented
 		}
 	}
+	if text != "" {
+		out(" ")
+		out(text)
+	}
+	out(style.LineBreak)
 }
 
-func (grammar PropertyGrammar) Print(token Value, out func(value string)) {
-	grammar.printObject("", token, out)
-	//out (string(NEWLINE))
+// Text is quoted if it would otherwise be read back differently, such as with a comment or spaces trimmed.
+func iniQuoteIfNeeded(text string) string {
+	if text != strings.TrimSpace(text) || strings.ContainsAny(text, "\"';#\n\r\t\\") {
+		return tuple.DoubleQuotedString(text)
+	}
+	return text
 }
 
-func NewPropertyGrammar() Grammar {
-	// https://en.wikipedia.org/wiki/.properties
+func NewIniGrammar() Grammar {
+	// https://en.wikipedia.org/wiki/INI_file
 	style := NewStyle("", "", "",
-		"", "", "", "", "",
-		" = ", "\n", "true", "false", '#', " = ")
-	return PropertyGrammar{style}
+		"", "", "", "", " = ",
+		"= ", "\n", "true", "false", '#', "=")
+	return Ini{style}
 }
-
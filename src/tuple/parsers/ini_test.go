@@ -0,0 +1,86 @@
+package parsers_test
+
+import (
+	"testing"
+	"tuple"
+	"tuple/parsers"
+	"reflect"
+)
+
+func TestIniParse(t *testing.T) {
+	var grammar = parsers.NewIniGrammar()
+
+	test := func(ini string, expected tuple.Value) {
+		val, err := parsers.ParseString(logger, grammar, ini)
+		if err != nil {
+			t.Errorf("Given '%s' expected '%s' got error '%s'", ini, expected, err)
+		}
+		if ! reflect.DeepEqual(val, expected) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", ini, expected, val)
+		}
+	}
+
+	root := tuple.NewTagValueMap()
+	root.Add(Tag{"a"}, tuple.String("1"))
+	test("a = 1", root)
+	test("; comment\n# comment\na=1 ; comment\n", root)
+
+	section := tuple.NewTagValueMap()
+	root.Add(Tag{"section"}, section)
+	test("a = 1\n[section]\n", root)
+	section.Add(Tag{"b"}, tuple.String("x y"))
+	test("a = 1\n[section]\nb = x y\n", root)
+	test("a = 1\n[ section ]\nb : \"x y\"\n", root)
+	test("a = 1\n[section]\nb = 'x y'\n", root)
+	section.Add(Tag{"c"}, tuple.String("1 # 2"))
+	test("a = 1\n[section]\nb = x y\n[section]\nc = \"1 # 2\"\n", root)
+	section.Add(Tag{"c"}, tuple.NewTuple(tuple.String("1"), tuple.String("true"), tuple.String("1.5"), tuple.String("")))
+	test("a = 1\n[section]\nb = x y\nc = 1\nc = true\nc = 1.5\nc =\n", root)
+
+	// Values are kept as written
+	values := tuple.NewTagValueMap()
+	values.Add(Tag{"port"}, tuple.String("0080"))
+	values.Add(Tag{"version"}, tuple.String("1.10"))
+	values.Add(Tag{"name"}, tuple.String("it's"))
+	test("port = 0080\nversion = 1.10\nname = 'it''s'\n", values)
+}
+
+func TestIniToJsonRoundTrip(t *testing.T) {
+	var ini = parsers.NewIniGrammar()
+	var json = NewJSONGrammar()
+
+	convert := func(value tuple.Value, grammar tuple.Grammar) tuple.Value {
+		printed := ""
+		grammar.Print(value, func(value string) {
+			printed += value
+		})
+		result, err := parsers.ParseString(logger, grammar, printed)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", printed, err)
+		}
+		return result
+	}
+
+	test := func(text string) {
+		val, err := parsers.ParseString(logger, ini, text)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", text, err)
+		}
+		result := convert(convert(val, json), ini)
+		if ! reflect.DeepEqual(val, result) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", text, val, result)
+		}
+		printed := ""
+		ini.Print(result, func(value string) {
+			printed += value
+		})
+		if printed != text {
+			t.Errorf("Given '%s' printed '%s'", text, printed)
+		}
+	}
+
+	test("a = 1\n")
+	test("a = 1\n\n[section]\nb = x y\nc = 80\nd = true\ne = \"quoted ; value\"\n")
+	test("port = 0080\nversion = 1.10\nname = \"it's\"\n")
+	test("[one]\na = 1\na = 2\n\n[two]\nb = \"c:\\\\windows\"\n")
+}
@@ -50,6 +50,7 @@ func NewJSONGrammar() Grammar {
 		OPEN_SQUARE_BRACKET, CLOSE_SQUARE_BRACKET, OPEN_BRACE, CLOSE_BRACE, JSON_CONS_OPERATOR,
 		",", "\n", "true", "false", '%', "") // prolog, sql '--' for   // TODO remove comment %
 	style.RecognizeNegative = true
+	style.Null = "null"
 	operators := NewOperators(style)
 	operators.AddBracket(OPEN_SQUARE_BRACKET, CLOSE_SQUARE_BRACKET)
 	operators.AddBracket(OPEN_BRACE, CLOSE_BRACE)
@@ -42,6 +42,7 @@ func TestEvalJson(t *testing.T) {
 	test("\"abc\"", tuple.String("abc"))
 	test("\"a\\nb\\tc\"", tuple.String("a\nb\tc"))
 	test("[]", tuple.NewTuple())
+	test("null", tuple.NULL)
 	// TODO...
 }
 
@@ -90,6 +91,7 @@ func TestEvalParseJson(t *testing.T) {
 	test("{\"a\" : 1 }", mmap)
 	mmap.Add(Tag{"b"}, zero)
 	test("{\"a\" : 1, \"b\" : 0 }", mmap)
+	test("[0, null]", tuple.NewTuple(zero, tuple.NULL))
 
 	// TODO...
 }
@@ -113,5 +115,35 @@ func TestJsonPrint(t *testing.T) {
 	test(tuple.NewTuple(), "[]")
 	test(tuple.NewTuple(one), "[1]")
 	test(tuple.NewTuple(zero, one), "[0,1]")
+	test(tuple.NewTuple(tuple.NULL, tuple.NewTuple()), "[null,[]]")
+
+	big, _ := tuple.IntegerFromString("18446744073709551616", 10)
+	decimal, _ := tuple.FloatFromString("0.10000000000000000001")
+	test(tuple.NewTuple(big, decimal), "[18446744073709551616,0.10000000000000000001]")
+	parsed, err := parsers.ParseString(logger, grammar, "[18446744073709551616, 0.10000000000000000001]")
+	if err != nil || ! reflect.DeepEqual(parsed, tuple.NewTuple(big, decimal)) {
+		t.Errorf("Expected exact numbers got '%v' %v", parsed, err)
+	}
 	// TODO
 }
+
+func TestJsonErrorLocations(t *testing.T) {
+	var grammar = NewJSONGrammar()
+
+	test := func(json string, line int64) {
+		lines := []int64{}
+		logger := func (location tuple.Location, level string, message string) {
+			if level == "ERROR" {
+				lines = append(lines, location.Line())
+			}
+		}
+		parsers.ParseString(logger, grammar, json)
+		if len(lines) == 0 || lines[len(lines)-1] != line {
+			t.Errorf("Given '%s' expected an error on line %d got %v", json, line, lines)
+		}
+	}
+
+	test("{\n  \"a\": [1,\n   2\n}\n", 4)
+	test("{\n  \"a\": 1\n", 2)
+	test("[1,\n 2", 2)
+}
@@ -23,9 +23,11 @@ var LISP_CONS_OPERATOR = "."
 /////////////////////////////////////////////////////////////////////////////
 
 func LispStyle () Style {
-	return NewStyle("", "", "  ",
+	style := NewStyle("", "", "  ",
 	OPEN_BRACKET, CLOSE_BRACKET, "", "", LISP_CONS_OPERATOR, 
 		"", "\n", "true", "false", ';', "")
+	style.Null = "nil"
+	return style
 }
 
 /////////////////////////////////////////////////////////////////////////////
@@ -37,7 +39,7 @@ func parse(context Context, operators Operators, style Style, next Next) error {
 		if context.Location().Depth() == 0 && operatorGrammar.Values.Arity() == 1 && len(operatorGrammar.operatorStack) == 0  {
 			err := operatorGrammar.EndOfInput(next)
 			if err != nil {
-				Error(context, "%s", err)
+				operatorGrammar.LogError(err)
 			}
 			return true
 		}
@@ -50,7 +52,7 @@ func parse(context Context, operators Operators, style Style, next Next) error {
 				if context.Location().Depth() == 0 {
 					err := operatorGrammar.EndOfInput(next)
 					if err != nil {
-						Error(context, "%s", err)
+						operatorGrammar.LogError(err)
 					}
 				}
 			},
@@ -115,11 +117,17 @@ func (grammar LispGrammar) Print(object Value, next func(value string)) {
 func NewLispGrammar() Grammar {
 	style := LispStyle()
 	style.RecognizeNegative = true
+	style.RecognizeQuotes = true
 	operators := NewOperators(style)
 	operators.AddBracket(OPEN_BRACKET, CLOSE_BRACKET)
 	operators.AddInfix(CONS_ATOM.Name, 30)
 	operators.AddInfix(LISP_CONS_OPERATOR, 105) // CONS Operator
 	operators.AddInfix(SPACE_ATOM.Name, 20)  // TODO space???
+	// 'x is (quote x), `(a ,b ,@c) is (quasiquote (a (unquote b) (unquote_splicing c)))
+	operators.AddPrefix3("'", 150, "quote")
+	operators.AddPrefix3("`", 150, "quasiquote")
+	operators.AddPrefix3(",", 150, "unquote")
+	operators.AddPrefix3(",@", 150, "unquote_splicing")
 	return LispGrammar{style, operators}
 
 }
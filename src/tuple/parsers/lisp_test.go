@@ -4,6 +4,8 @@ import (
 	"testing"
 	"tuple"
 	"math"
+	"strings"
+	"tuple/runner"
 )
 
 func testIntExpression(t *testing.T, grammar tuple.Grammar, formula string, expected int64) {
@@ -28,6 +30,10 @@ func testFloatExpression(t *testing.T, grammar tuple.Grammar, formula string, ex
 	}
 	floatExpected := tuple.Float64(expected)
 	floatVal, ok := val.(tuple.Float64)
+	if intVal, isInt := val.(tuple.Int64); isInt {
+		// Integer arithmetic stays integer
+		floatVal, ok = tuple.Float64(intVal), true
+	}
 	if ok {
 		if floatVal != floatExpected {
 			t.Errorf("ERROR: %s=%f  val=%f %f", formula, expected, floatVal, floatExpected)
@@ -160,3 +166,42 @@ func TestLispInfixEquals(t *testing.T) {
 	test("(-3 == -(-(-1)+2))")
 }
 
+
+func TestLispQuasiQuote(t *testing.T) {
+
+	grammar := NewLispGrammar()
+	context := runner.NewSafeEvalContext(logger)
+	test := func(formula string) {
+		val, err := ParseAndEval(context, grammar, formula)
+		if val != tuple.Bool(true) {
+			t.Errorf("Given '%s' expected true got %v %v", formula, val, err)
+		}
+	}
+	test("(eq (arity '(a b c)) 3)")
+	test("(eq `(1 ,(+ 1 1) ,@(list 3 4) 5) (list 1 2 3 4 5))")
+	test("(progn (macro unless c x `(if ,c false ,x)) (unless false true))")
+	test("(eq (macroexpand '(unless (> 1 2) 3)) '(if (> 1 2) false 3))")
+}
+
+func TestLispNull(t *testing.T) {
+
+	grammar := NewLispGrammar()
+	test := func(formula string) {
+		val, err := ParseAndEval(safeEvalContext, grammar, formula)
+		if val != tuple.Bool(true) {
+			t.Errorf("Given '%s' expected true got %v %v", formula, val, err)
+		}
+	}
+	test("(isnull nil)")
+	test("(isnull (nth 3 (1 2 3)))")
+	test("(! (isnull ()))")
+	test("(! (eq nil ()))")
+
+	printed := ""
+	grammar.Print(tuple.NewTuple(tuple.NULL, tuple.NewTuple()), func(value string) {
+		printed += value
+	})
+	if strings.Join(strings.Fields(printed), "") != "(nil())" {
+		t.Errorf("Expected nil got '%s'", printed)
+	}
+}
@@ -38,11 +38,25 @@ type OperatorGrammar struct {
 	operators * Operators
 	operatorStack []Tag
 	Values Tuple
+	locations []Location  // Where each of the values started
 	wasOperator bool
+	start Location  // Where the expression most recently ended started
 }
 
 func NewOperatorGrammar(context Context, operators * Operators) OperatorGrammar {
-	return OperatorGrammar{context, operators, make([]Tag, 0), NewTuple(),true}
+	return OperatorGrammar{context, operators, make([]Tag, 0), NewTuple(), make([]Location, 0), true, context.Location()}
+}
+
+// Logs an error raised by the end of an expression at where it happened, if the error knows,
+// otherwise at the start of the expression rather than at the line break or bracket that ended it.
+func (stack * OperatorGrammar) LogError(err error) {
+	location := stack.start
+	if located, ok := err.(tuple.LocatedError); ok {
+		if at, ok := located.Location(); ok {
+			location = at
+		}
+	}
+	ErrorAt(stack.context, location, "%s", err)
 }
 
 func (stack * OperatorGrammar) pushOperator(token Tag) {
@@ -106,13 +120,17 @@ func (stack * OperatorGrammar) reduceOperatorExpression(top Tag) (int, error) {
 		index = popped - 2
 	}
 
-	value, err := consFilter(tuple)  // TODO generalize this
+	location := stack.locations[lv-popped]
+	stack.context.Locations().Add(tuple, location)
+	value, err := consFilter(tuple, stack.context.Locations())  // TODO generalize this
 	if err != nil {
 		//panic(fmt.Sprintf("TODO handle err: %s", err))
 		return 0, err
 	}
 	AssertNotNil(value)
+	stack.context.Locations().Add(value, location)
 	stack.Values.List = append((*values)[:lv-popped], value)
+	stack.locations = append(stack.locations[:lv-popped], location)
 	return index, nil
 }
 
@@ -120,7 +138,9 @@ func (stack * OperatorGrammar) reduceOperatorExpression(top Tag) (int, error) {
 func (stack * OperatorGrammar) PushValueWithoutInsertingMissingSepator(value Value) {
 	AssertNotNil(value)
 	Verbose(stack.context,"PUSH VALUE\t'%s'\n", value)
-	stack.Values.Append(value)
+	// The stack is only used here so it is appended to in place, as it is truncated when reducing
+	stack.Values.List = append(stack.Values.List, value)
+	stack.locations = append(stack.locations, stack.context.Span().Start())
 	stack.wasOperator = false
 }
 
@@ -158,6 +178,7 @@ func (stack * OperatorGrammar) CloseBracket(token Tag) error {
 			//lv := stack.Values.Arity()
 			values := stack.Values.List
 			stack.Values.List = append(values, NewTuple())
+			stack.locations = append(stack.locations, stack.context.Location())
 			Verbose(stack.context," REDUCE:\t'()'\n")
 			return nil
 		} else {
@@ -206,6 +227,9 @@ func (stack * OperatorGrammar) EndOfInput(next Next) error {
 	if empty {
 		return nil
 	}
+	if len(stack.locations) > 0 {
+		stack.start = stack.locations[0]
+	}
 
 	stack.postfix()
 	
@@ -229,7 +253,7 @@ func (stack * OperatorGrammar) EndOfInput(next Next) error {
 		}
 		// TODO this is a hack to handle space separated expressions: 1+2 3*4 5
 		if len(stack.Values.List) == 1 {
-			result, err := consFilterFinal(stack.Values.Get(0))
+			result, err := consFilterFinal(stack.Values.Get(0), stack.context.Locations())
 			if err != nil {
 				stack.flush()
 				return err
@@ -240,6 +264,7 @@ func (stack * OperatorGrammar) EndOfInput(next Next) error {
 				return err
 			}
 		} else {
+			stack.context.Locations().Add(stack.Values, stack.locations[0])
 			err := next(stack.Values)
 			if err != nil {
 				stack.flush()
@@ -253,11 +278,18 @@ func (stack * OperatorGrammar) EndOfInput(next Next) error {
 
 func (stack * OperatorGrammar) flush() {
 	stack.Values = NewTuple()
+	stack.locations = make([]Location, 0)
 	stack.operatorStack = make([]Tag, 0)
 	stack.wasOperator = true
 }
 
 func (stack * OperatorGrammar) PushOperator(operator Tag) {
+	_, isInfix := stack.operators.infix[operator.Name]
+	_, isPostfix := stack.operators.postfix[operator.Name]
+	_, isPrefixOnly := stack.operators.prefix[operator.Name]
+	if isPrefixOnly && ! isInfix && ! isPostfix && ! stack.wasOperator {
+		stack.PushOperator(SPACE_ATOM)  // A prefix operator after a value starts the next value
+	}
 	_, ok := stack.operators.postfix[operator.Name]
 	operatorIsPostfix := ! stack.wasOperator && ok
 	prefixOperator, ok := stack.operators.prefix[operator.Name]
@@ -274,6 +306,7 @@ func (stack * OperatorGrammar) PushOperator(operator Tag) {
 		val1 := (*values) [lv - 1]
 		name := stack.operators.Map(operator)
 		tuple := NewTuple(name, val1)
+		stack.context.Locations().Add(tuple, stack.locations[lv-1])
 		stack.Values.List = append((*values)[:lv-1], tuple)
 		Verbose(stack.context," REDUCE POSTFIX:\t%s\t'%s'\n", name.Name, val1)
 		stack.wasOperator = false
@@ -406,11 +439,15 @@ func (operators *Operators) AddInfix3(operator string, precedence int, name stri
 }
 
 func (operators *Operators) AddPrefix(operator string, precedence int) {
+	operators.AddPrefix3(operator, precedence, operator)
+}
+
+func (operators *Operators) AddPrefix3(operator string, precedence int, evalName string) {
 	name := PREFIX + operator
-	operators.prefix[operator] = Operator{Tag{name}, precedence, false,Tag{operator}}
+	operators.prefix[operator] = Operator{Tag{name}, precedence, false,Tag{evalName}}
 	operators.precedence[operator] = precedence
 	operators.precedence[name] = precedence
-	operators.evalName[name] = Tag{operator}
+	operators.evalName[name] = Tag{evalName}
 }
 
 func (operators *Operators) AddPostfix(operator string, precedence int) {
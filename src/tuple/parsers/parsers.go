@@ -17,6 +17,7 @@
 package parsers
 
 import "tuple"
+import gocontext "context"
 import "bufio"
 import "strings"
 import "errors"
@@ -33,6 +34,9 @@ type Float64 = tuple.Float64
 type Int64 = tuple.Int64
 type Array = tuple.Array
 type Bool = tuple.Bool
+type BigInt = tuple.BigInt
+type Decimal = tuple.Decimal
+type Null = tuple.Null
 
 var CONS_ATOM = tuple.CONS_ATOM
 var IsAtom = tuple.IsAtom
@@ -40,6 +44,7 @@ var Head = tuple.Head
 
 var NewTuple = tuple.NewTuple
 var Error = tuple.Error
+var ErrorAt = tuple.ErrorAt
 var Verbose = tuple.Verbose
 
 func UnexpectedCloseBracketError(context Context, token string) {
@@ -84,7 +89,7 @@ func AddStandardCOperators(operators *Operators) {
 }
 
 func ParseString(logger LocationLogger, grammar Grammar, expression string) (Value, error) {
-	var result Value = tuple.EMPTY // TODO Void?
+	var result Value = tuple.NULL
 	pipeline := func(value Value) error {
 		result = value
 		return nil
@@ -98,9 +103,21 @@ func ParseString(logger LocationLogger, grammar Grammar, expression string) (Val
 }
 
 func RunParser(grammar Grammar, expression string, logger LocationLogger, next Next) (Context, error) {
+	return RunParserWithLocations(grammar, expression, logger, tuple.NewLocations(), next)
+}
+
+// Parses the expression recording the location of each value in the given table.
+func RunParserWithLocations(grammar Grammar, expression string, logger LocationLogger, locations tuple.Locations, next Next) (Context, error) {
+	return RunParserWithCancellation(gocontext.Background(), grammar, expression, logger, locations, next)
+}
+
+// Parses the expression until done or the cancellation is cancelled.
+func RunParserWithCancellation(cancellation gocontext.Context, grammar Grammar, expression string, logger LocationLogger, locations tuple.Locations, next Next) (Context, error) {
 
 	reader := bufio.NewReader(strings.NewReader(expression))
 	context := NewParserContext("<eval>", reader, logger)
+	context.SetLocations(locations)
+	context.SetCancellation(cancellation)
 	err := grammar.Parse(&context, next)
 	return &context, err
 }
@@ -31,6 +31,7 @@ type Printer interface {
 	PrintScalarPrefix(depth string, out StringFunction)
 	PrintSeparator(depth string, out StringFunction)
 	PrintEmptyTuple(depth string, out StringFunction)
+	PrintNull(depth string, out StringFunction)
 	PrintNullaryOperator(depth string, tag Tag, out StringFunction)
 	PrintUnaryOperator(depth string, tag Tag, value Value, out StringFunction)
 	PrintBinaryOperator(depth string, tag Tag, value1 Value, value2 Value, out StringFunction)
@@ -51,6 +52,9 @@ func PrintScalar(printer Printer, depth string, value Value, out StringFunction)
 	case Bool: out(tuple.BoolToString(bool(value.(Bool))))
 	case Int64: out(tuple.Int64ToString(value.(Int64)))
 	case Float64: out(tuple.Float64ToString(value.(Float64)))
+	case BigInt: out(value.(BigInt).String())
+	case Decimal: out(value.(Decimal).String())
+	case Null: printer.PrintNull(depth, out)
 	default:
 		if value.Arity() == 0 {
 			printer.PrintEmptyTuple(depth, out)
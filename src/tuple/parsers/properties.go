@@ -0,0 +1,273 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package parsers
+import "tuple"
+import "strings"
+import "strconv"
+
+/////////////////////////////////////////////////////////////////////////////
+// PropertyGrammar Grammar
+/////////////////////////////////////////////////////////////////////////////
+
+type PropertyGrammar struct {
+	style Style
+}
+
+func (grammar PropertyGrammar) Name() string {
+	return "PropertyGrammar"
+}
+
+func (grammar PropertyGrammar) FileSuffix() string {
+	return ".properties"
+}
+
+// Parses a Java properties file, the dotted keys are split into nested maps
+// so 'a.b = 1' gives {"a": {"b": "1"}}. A key that has both a value and nested keys
+// is a map with its own value under the empty key. As in Java the last value of a repeated key wins.
+func (grammar PropertyGrammar) Parse(context Context, next Next) error {
+	root := tuple.NewTagValueMap()
+	context.Locations().Add(root, context.Location())
+	properties := propertyTree{map[string]tuple.TagValueMap{"": root}, map[string]Value{}, context.Locations()}
+	empty := true
+	for {
+		location := context.Location()
+		line, ok := propertyLine(context)
+		if ! ok {
+			break
+		}
+		if line == "" {
+			continue
+		}
+		key, value := propertyKeyValue(line)
+		properties.add(unescapeProperty(context, key), String(unescapeProperty(context, value)), location)
+		empty = false
+	}
+	if empty {
+		return nil
+	}
+	return next(root)
+}
+
+// Reads the next logical line, joining lines ending in a backslash and
+// skipping leading whitespace, comment lines are returned as an empty line.
+func propertyLine(context Context) (string, bool) {
+	line, ok := ReadLine(context)
+	if ! ok {
+		return "", false
+	}
+	line = strings.TrimLeft(line, " \t\f")
+	if line == "" || line[0] == '#' || line[0] == '!' {
+		return "", true
+	}
+	for continued(line) {
+		line = line[:len(line)-1]
+		more, ok := ReadLine(context)
+		if ! ok {
+			break
+		}
+		line += strings.TrimLeft(more, " \t\f")
+	}
+	return line, true
+}
+
+// A line is continued if it ends with an odd number of backslashes.
+func continued(line string) bool {
+	count := 0
+	for k := len(line)-1; k >= 0 && line[k] == '\\'; k -= 1 {
+		count += 1
+	}
+	return count % 2 == 1
+}
+
+// The key ends at the first unescaped '=', ':' or whitespace, the separator may be surrounded by whitespace.
+func propertyKeyValue(line string) (string, string) {
+	end := len(line)
+	for k := 0; k < len(line); k += 1 {
+		if line[k] == '\\' {
+			k += 1
+		} else if strings.IndexByte("=: \t\f", line[k]) >= 0 {
+			end = k
+			break
+		}
+	}
+	value := strings.TrimLeft(line[end:], " \t\f")
+	if value != "" && (value[0] == '=' || value[0] == ':') {
+		value = strings.TrimLeft(value[1:], " \t\f")
+	}
+	return line[:end], value
+}
+
+func unescapeProperty(context Context, text string) string {
+	if strings.IndexByte(text, '\\') < 0 {
+		return text
+	}
+	var builder strings.Builder
+	for k := 0; k < len(text); k += 1 {
+		if text[k] != '\\' || k == len(text)-1 {
+			builder.WriteByte(text[k])
+			continue
+		}
+		k += 1
+		switch text[k] {
+		case 't': builder.WriteByte('\t')
+		case 'n': builder.WriteByte('\n')
+		case 'r': builder.WriteByte('\r')
+		case 'f': builder.WriteByte('\f')
+		case 'u':
+			if k+5 > len(text) {
+				Error(context, "Malformed \\uxxxx encoding: '%s'", text[k-1:])
+				builder.WriteString(text[k+1:])
+				return builder.String()
+			}
+			code, err := strconv.ParseUint(text[k+1:k+5], 16, 16)
+			if err != nil {
+				Error(context, "Malformed \\uxxxx encoding: '%s'", text[k-1:k+5])
+			}
+			builder.WriteRune(rune(code))
+			k += 4
+		default:
+			builder.WriteByte(text[k])
+		}
+	}
+	return builder.String()
+}
+
+type propertyTree struct {
+	maps map[string]tuple.TagValueMap
+	values map[string]Value
+	locations tuple.Locations
+}
+
+func (tree propertyTree) add(key string, value Value, location Location) {
+	names := strings.Split(key, ".")
+	path := ""
+	parent := tree.maps[path]
+	for _, name := range names[:len(names)-1] {
+		path = propertyPath(path, name)
+		mapp, ok := tree.maps[path]
+		if ! ok {
+			mapp = tuple.NewTagValueMap()
+			tree.locations.Add(mapp, location)
+			if previous, ok := tree.values[path]; ok {
+				mapp.Add(Tag{""}, previous)
+			}
+			tree.maps[path] = mapp
+			parent.Add(Tag{name}, mapp)
+		}
+		parent = mapp
+	}
+	name := names[len(names)-1]
+	path = propertyPath(path, name)
+	if mapp, ok := tree.maps[path]; ok {
+		mapp.Add(Tag{""}, value)
+	} else {
+		parent.Add(Tag{name}, value)
+	}
+	tree.values[path] = value
+}
+
+func propertyPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func (grammar PropertyGrammar) printObject(depth string, token Value, out func(value string)) {
+	if mapp, ok := token.(tuple.Map); ok {
+		mapp.ForallKeyValue(func (key Tag, value Value) {
+			path := depth
+			if key.Name != "" {
+				path = propertyPath(depth, key.Name)
+			}
+			grammar.printObject(path, value, out)
+		})
+	} else if IsAtom(token) {
+		grammar.printProperty(depth, token, out)
+	} else {
+		tuple, _ := tuple.AsTuple(token)
+		if tuple.Arity() == 0 {
+			grammar.printProperty(depth, token, out)
+			return
+		}
+		var newDepth string
+		tag, first := Head(tuple)
+		if first {
+			newDepth = propertyPath(depth, tag.Name)
+		} else {
+			newDepth = depth + "."
+		}
+		for k, token := range tuple.List {
+			if ! first || k >0  {
+				grammar.printObject(newDepth, token, out)
+			}
+		}
+	}
+}
+
+func (grammar PropertyGrammar) printProperty(key string, value Value, out func(value string)) {
+	style := grammar.style
+	text := ""
+	switch value.(type) {
+	case Tag: text = value.(Tag).Name
+	case String: text = string(value.(String))
+	case Bool, Int64, Float64, BigInt, Decimal: PrintScalar(style, "", value, func (value string) { text += value })
+	}
+	out(escapeProperty(key, true))
+	out(style.KeyValueSeparator)
+	out(escapeProperty(text, false))
+	out(style.LineBreak)
+}
+
+// Escapes the characters that would otherwise end a key, start a comment or be skipped as leading whitespace.
+func escapeProperty(text string, key bool) string {
+	var builder strings.Builder
+	for k, ch := range text {
+		switch ch {
+		case '\\': builder.WriteString("\\\\")
+		case '\t': builder.WriteString("\\t")
+		case '\n': builder.WriteString("\\n")
+		case '\r': builder.WriteString("\\r")
+		case '\f': builder.WriteString("\\f")
+		case '=', ':', '#', '!':
+			if key {
+				builder.WriteByte('\\')
+			}
+			builder.WriteRune(ch)
+		case ' ':
+			if key || k == 0 {
+				builder.WriteByte('\\')
+			}
+			builder.WriteRune(ch)
+		default:
+			builder.WriteRune(ch)
+		}
+	}
+	return builder.String()
+}
+
+func (grammar PropertyGrammar) Print(token Value, out func(value string)) {
+	grammar.printObject("", token, out)
+}
+
+func NewPropertyGrammar() Grammar {
+	// https://en.wikipedia.org/wiki/.properties
+	style := NewStyle("", "", "",
+		"", "", "", "", " = ",
+		"\n", "\n", "true", "false", '#', "")
+	return PropertyGrammar{style}
+}
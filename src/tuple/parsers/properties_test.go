@@ -0,0 +1,80 @@
+package parsers_test
+
+import (
+	"testing"
+	"tuple"
+	"tuple/parsers"
+	"reflect"
+)
+
+func TestPropertiesParse(t *testing.T) {
+	var grammar = parsers.NewPropertyGrammar()
+
+	test := func(properties string, expected tuple.Value) {
+		val, err := parsers.ParseString(logger, grammar, properties)
+		if err != nil {
+			t.Errorf("Given '%s' expected '%s' got error '%s'", properties, expected, err)
+		}
+		if ! reflect.DeepEqual(val, expected) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", properties, expected, val)
+		}
+	}
+
+	root := tuple.NewTagValueMap()
+	root.Add(Tag{"a"}, tuple.String("1"))
+	test("a = 1", root)
+	test("a=1", root)
+	test("a:1", root)
+	test("a 1", root)
+	test("# comment\n! comment\n\n  a = 1\n", root)
+	test("a = 0\na = 1\n", root)
+
+	root.Add(Tag{"key with spaces"}, tuple.String("x\ty = \u00e9"))
+	test("a = 1\nkey\\ with\\ spaces = x\\ty = \\u00e9", root)
+	test("a = 1\nkey\\ with\\ spaces = x\\ty \\\n    = \\u00E9", root)
+
+	nested := tuple.NewTagValueMap()
+	nested.Add(Tag{"c"}, tuple.String("2"))
+	b := tuple.NewTagValueMap()
+	b.Add(Tag{"b"}, nested)
+	expected := tuple.NewTagValueMap()
+	expected.Add(Tag{"a"}, b)
+	test("a.b.c = 2", expected)
+
+	nested.Add(Tag{""}, tuple.String("3"))
+	test("a.b.c = 2\na.b = 3", expected)
+
+	// The value of a key comes before its nested keys when it is given first
+	nested = tuple.NewTagValueMap()
+	nested.Add(Tag{""}, tuple.String("3"))
+	nested.Add(Tag{"c"}, tuple.String("2"))
+	b.Add(Tag{"b"}, nested)
+	test("a.b = 3\na.b.c = 2", expected)
+}
+
+func TestPropertiesRoundTrip(t *testing.T) {
+	var grammar = parsers.NewPropertyGrammar()
+
+	test := func(text string) {
+		val, err := parsers.ParseString(logger, grammar, text)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", text, err)
+		}
+		printed := ""
+		grammar.Print(val, func(value string) {
+			printed += value
+		})
+		result, err := parsers.ParseString(logger, grammar, printed)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", printed, err)
+		}
+		if ! reflect.DeepEqual(val, result) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", text, val, result)
+		}
+	}
+
+	test("a = 1")
+	test("a.b.c = 2\na.b = 3\na.d = #4\n")
+	test("key\\ with\\:colon = \\ leading space\\\\\nmulti = one\\ntwo\\\n  three\n")
+	test("path = c:\\\\windows\nempty =\n")
+}
@@ -0,0 +1,666 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package parsers
+import "tuple"
+import "fmt"
+import "math"
+import "regexp"
+import "strconv"
+import "strings"
+
+/////////////////////////////////////////////////////////////////////////////
+// TOML Grammar
+/////////////////////////////////////////////////////////////////////////////
+
+type TomlGrammar struct {
+	style Style
+}
+
+func (grammar TomlGrammar) Name() string {
+	return "TOML"
+}
+
+func (grammar TomlGrammar) FileSuffix() string {
+	return ".toml"
+}
+
+// Parses a TOML document into a map, tables are nested maps and an array of tables is a tuple of maps.
+// Dates and times have no equivalent value so are read as strings.
+func (grammar TomlGrammar) Parse(context Context, next Next) error {
+	parser := tomlParser{context, nil}
+	root := newTomlTable()
+	context.Locations().Add(root.mapp, context.Location())
+	current := root
+	empty := true
+	for {
+		parser.skipWhitespace()
+		ch := parser.peek(0)
+		switch {
+		case ch == tomlEnd:
+			if empty {
+				return nil
+			}
+			return next(root.mapp)
+		case ch == '#' || ch == '\r' || ch == NEWLINE:
+		case ch == '[':
+			current = parser.parseHeader(root)
+			empty = false
+		default:
+			parser.parseKeyValue(current)
+			empty = false
+		}
+		parser.endOfLine()
+	}
+}
+
+// A table tracks which of its keys are tables, arrays of tables or values
+// so the maps can be added to as the document is read.
+type tomlTable struct {
+	mapp tuple.TagValueMap
+	tables map[string]*tomlTable
+	arrays map[string]*tomlArray
+	values map[string]bool
+	explicit bool
+}
+
+type tomlArray struct {
+	list Tuple
+	tables []*tomlTable
+}
+
+func newTomlTable() *tomlTable {
+	return &tomlTable{tuple.NewTagValueMap(), map[string]*tomlTable{}, map[string]*tomlArray{}, map[string]bool{}, false}
+}
+
+const tomlEnd rune = -1
+
+// The key a value other than a map is printed under.
+const TOML_VALUE = "value"
+
+type tomlParser struct {
+	context Context
+	pending []rune
+}
+
+func (parser *tomlParser) peek(k int) rune {
+	for len(parser.pending) <= k {
+		ch, err := parser.context.ReadRune()
+		if err != nil {
+			return tomlEnd
+		}
+		parser.pending = append(parser.pending, ch)
+	}
+	return parser.pending[k]
+}
+
+func (parser *tomlParser) next() rune {
+	ch := parser.peek(0)
+	if ch == tomlEnd {
+		return ch
+	}
+	parser.pending = parser.pending[1:]
+	if ch == NEWLINE {
+		parser.context.EOL()
+	}
+	return ch
+}
+
+func (parser *tomlParser) skipWhitespace() {
+	for ch := parser.peek(0); ch == ' ' || ch == '\t'; ch = parser.peek(0) {
+		parser.next()
+	}
+}
+
+// Skips blank lines and comments within an array.
+func (parser *tomlParser) skipWhitespaceAndComments() {
+	for {
+		parser.skipWhitespace()
+		switch parser.peek(0) {
+		case '#':
+			for ch := parser.peek(0); ch != NEWLINE && ch != tomlEnd; ch = parser.peek(0) {
+				parser.next()
+			}
+		case '\r', NEWLINE:
+			parser.next()
+		default:
+			return
+		}
+	}
+}
+
+// Expects a comment or the end of the line, anything else is reported and skipped.
+func (parser *tomlParser) endOfLine() {
+	parser.skipWhitespace()
+	ch := parser.peek(0)
+	if ch != '#' && ch != '\r' && ch != NEWLINE && ch != tomlEnd {
+		Error(parser.context, "Unexpected '%c' expected the end of the line", ch)
+	}
+	for ch := parser.next(); ch != NEWLINE && ch != tomlEnd; ch = parser.next() {
+	}
+}
+
+func (parser *tomlParser) expect(expected rune) bool {
+	parser.skipWhitespace()
+	if ch := parser.peek(0); ch != expected {
+		Error(parser.context, "Expected '%c' but found '%c'", expected, ch)
+		return false
+	}
+	parser.next()
+	return true
+}
+
+// A header is either [table] or [[array of tables]], returns the table that following keys are added to.
+func (parser *tomlParser) parseHeader(root *tomlTable) *tomlTable {
+	table := parser.parseHeaderTable(root)
+	parser.context.Locations().Add(table.mapp, parser.context.Location())
+	return table
+}
+
+func (parser *tomlParser) parseHeaderTable(root *tomlTable) *tomlTable {
+	parser.next()
+	array := parser.peek(0) == '['
+	if array {
+		parser.next()
+	}
+	keys := parser.parseKey()
+	parser.expect(']')
+	if array {
+		parser.expect(']')
+	}
+	if len(keys) == 0 {
+		return newTomlTable()
+	}
+	table := parser.descend(root, keys[:len(keys)-1])
+	key := keys[len(keys)-1]
+	switch {
+	case array && table.arrays[key] != nil:
+		return table.arrays[key].add(table, key)
+	case array && table.tables[key] == nil && ! table.values[key]:
+		table.arrays[key] = &tomlArray{}
+		return table.arrays[key].add(table, key)
+	case ! array && table.tables[key] != nil && ! table.tables[key].explicit:
+		table.tables[key].explicit = true
+		return table.tables[key]
+	case ! array && table.tables[key] == nil && table.arrays[key] == nil && ! table.values[key]:
+		child := table.add(key)
+		child.explicit = true
+		return child
+	}
+	Error(parser.context, "Table '%s' is already defined", strings.Join(keys, "."))
+	return newTomlTable()
+}
+
+func (array *tomlArray) add(parent *tomlTable, key string) *tomlTable {
+	table := newTomlTable()
+	array.tables = append(array.tables, table)
+	array.list.Append(table.mapp)
+	parent.mapp.Add(Tag{key}, array.list)
+	return table
+}
+
+func (table *tomlTable) add(key string) *tomlTable {
+	child := newTomlTable()
+	table.tables[key] = child
+	table.mapp.Add(Tag{key}, child.mapp)
+	return child
+}
+
+// Finds or creates the table named by the dotted keys, a key naming an array of tables refers to its last table.
+func (parser *tomlParser) descend(table *tomlTable, keys []string) *tomlTable {
+	for _, key := range keys {
+		switch {
+		case table.tables[key] != nil:
+			table = table.tables[key]
+		case table.arrays[key] != nil:
+			tables := table.arrays[key].tables
+			table = tables[len(tables)-1]
+		case table.values[key]:
+			Error(parser.context, "Key '%s' is already defined as a value", key)
+			return newTomlTable()
+		default:
+			table = table.add(key)
+		}
+	}
+	return table
+}
+
+func (parser *tomlParser) parseKeyValue(table *tomlTable) {
+	keys := parser.parseKey()
+	if ! parser.expect('=') || len(keys) == 0 {
+		return
+	}
+	parser.skipWhitespace()
+	value := parser.parseValue()
+	table = parser.descend(table, keys[:len(keys)-1])
+	key := keys[len(keys)-1]
+	if table.values[key] || table.tables[key] != nil || table.arrays[key] != nil {
+		Error(parser.context, "Key '%s' is already defined", strings.Join(keys, "."))
+		return
+	}
+	table.values[key] = true
+	table.mapp.Add(Tag{key}, value)
+}
+
+// Reads a dotted key, each part may be bare or quoted.
+func (parser *tomlParser) parseKey() []string {
+	keys := []string{}
+	for {
+		parser.skipWhitespace()
+		ch := parser.peek(0)
+		switch {
+		case ch == '"' || ch == '\'':
+			keys = append(keys, parser.parseString())
+		case isTomlBareKey(ch):
+			var builder strings.Builder
+			for ch := parser.peek(0); isTomlBareKey(ch); ch = parser.peek(0) {
+				builder.WriteRune(parser.next())
+			}
+			keys = append(keys, builder.String())
+		default:
+			Error(parser.context, "Expected a key but found '%c'", ch)
+			return nil
+		}
+		parser.skipWhitespace()
+		if parser.peek(0) != '.' {
+			return keys
+		}
+		parser.next()
+	}
+}
+
+func isTomlBareKey(ch rune) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '_' || ch == '-'
+}
+
+func (parser *tomlParser) parseValue() Value {
+	location := parser.context.Location()
+	value := parser.parseCollection()
+	parser.context.Locations().Add(value, location)
+	return value
+}
+
+func (parser *tomlParser) parseCollection() Value {
+	switch ch := parser.peek(0); {
+	case ch == '"' || ch == '\'':
+		return String(parser.parseString())
+	case ch == '[':
+		parser.next()
+		values := NewTuple()
+		for {
+			parser.skipWhitespaceAndComments()
+			if parser.peek(0) == ']' {
+				parser.next()
+				return values
+			}
+			values.Append(parser.parseValue())
+			parser.skipWhitespaceAndComments()
+			switch parser.peek(0) {
+			case ',':
+				parser.next()
+			case ']':
+			default:
+				parser.expect(']')
+				return values
+			}
+		}
+	case ch == '{':
+		parser.next()
+		table := newTomlTable()
+		parser.skipWhitespace()
+		if parser.peek(0) == '}' {
+			parser.next()
+			return table.mapp
+		}
+		for {
+			parser.parseKeyValue(table)
+			parser.skipWhitespace()
+			if parser.peek(0) != ',' {
+				parser.expect('}')
+				return table.mapp
+			}
+			parser.next()
+		}
+	default:
+		return parser.parseScalar()
+	}
+}
+
+var tomlIntegerPattern = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)$|^0x[0-9a-fA-F](_?[0-9a-fA-F])*$|^0o[0-7](_?[0-7])*$|^0b[01](_?[01])*$`)
+var tomlFloatPattern = regexp.MustCompile(`^[-+]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][-+]?[0-9](_?[0-9])*)?$`)
+var tomlDatePattern = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`)
+var tomlDateTimePattern = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2}([Tt ]|$))?([0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?([Zz]|[-+][0-9]{2}:[0-9]{2})?)?$`)
+
+// Dates and times are kept as tags of the text written, a tag that looks like a date is printed unquoted
+// whereas a string is always quoted.
+func isTomlDateTime(text string) bool {
+	return text != "" && tomlDateTimePattern.MatchString(text)
+}
+
+// Reads a boolean, number, date or time.
+func (parser *tomlParser) parseScalar() Value {
+	var builder strings.Builder
+	for ch := parser.peek(0); isTomlBareKey(ch) || ch == '+' || ch == '.' || ch == ':'; ch = parser.peek(0) {
+		builder.WriteRune(parser.next())
+	}
+	text := builder.String()
+	if tomlDatePattern.MatchString(text) && parser.peek(0) == ' ' && parser.peek(1) >= '0' && parser.peek(1) <= '9' {
+		builder.WriteRune(parser.next())
+		for ch := parser.peek(0); isTomlBareKey(ch) || ch == '+' || ch == '.' || ch == ':'; ch = parser.peek(0) {
+			builder.WriteRune(parser.next())
+		}
+		text = builder.String()
+	}
+	switch text {
+	case "true": return Bool(true)
+	case "false": return Bool(false)
+	case "inf", "+inf": return Float64(math.Inf(1))
+	case "-inf": return Float64(math.Inf(-1))
+	case "nan", "+nan", "-nan": return tuple.NAN
+	}
+	switch {
+	case text == "":
+		Error(parser.context, "Expected a value but found '%c'", parser.peek(0))
+	case tomlIntegerPattern.MatchString(text):
+		// Integers too large for 64 bits are big integers
+		value, ok := tuple.IntegerFromString(strings.TrimPrefix(text, "+"), 0)
+		if ! ok {
+			Error(parser.context, "Unexpected integer: '%s'", text)
+			break
+		}
+		return value
+	case tomlFloatPattern.MatchString(text):
+		value, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64)
+		if err != nil {
+			Error(parser.context, "Got '%s' err= %s", text, err)
+		}
+		return Float64(value)
+	case isTomlDateTime(text):
+		return Tag{text}
+	default:
+		Error(parser.context, "Unexpected value: '%s'", text)
+	}
+	return String(text)
+}
+
+// Reads a basic or literal string either of which may be multi-line.
+func (parser *tomlParser) parseString() string {
+	quote := parser.next()
+	multiLine := parser.peek(0) == quote && parser.peek(1) == quote
+	if multiLine {
+		parser.next()
+		parser.next()
+		if parser.peek(0) == '\r' && parser.peek(1) == NEWLINE {
+			parser.next()
+		}
+		if parser.peek(0) == NEWLINE {
+			parser.next()
+		}
+	} else if parser.peek(0) == quote {
+		parser.next()
+		return ""
+	}
+	var builder strings.Builder
+	for {
+		ch := parser.next()
+		switch {
+		case ch == tomlEnd || (ch == NEWLINE && ! multiLine):
+			Error(parser.context, "Missing close quote: '%c'", quote)
+			return builder.String()
+		case ch == quote && ! multiLine:
+			return builder.String()
+		case ch == quote:
+			count := 1
+			for parser.peek(0) == quote && count < 5 {
+				parser.next()
+				count += 1
+			}
+			if count >= 3 {
+				builder.WriteString(strings.Repeat(string(quote), count-3))
+				return builder.String()
+			}
+			builder.WriteString(strings.Repeat(string(quote), count))
+		case ch == '\\' && quote == '"':
+			parser.parseEscape(&builder, multiLine)
+		default:
+			builder.WriteRune(ch)
+		}
+	}
+}
+
+func (parser *tomlParser) parseEscape(builder *strings.Builder, multiLine bool) {
+	ch := parser.next()
+	switch ch {
+	case 'b': builder.WriteByte('\b')
+	case 't': builder.WriteByte('\t')
+	case 'n': builder.WriteByte('\n')
+	case 'f': builder.WriteByte('\f')
+	case 'r': builder.WriteByte('\r')
+	case 'e': builder.WriteByte('\x1b')
+	case '"', '\\': builder.WriteRune(ch)
+	case 'u', 'U':
+		size := 4
+		if ch == 'U' {
+			size = 8
+		}
+		hex := ""
+		for k := 0; k < size; k += 1 {
+			hex += string(parser.next())
+		}
+		code, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			Error(parser.context, "Invalid unicode escape: '\\%c%s'", ch, hex)
+		}
+		builder.WriteRune(rune(code))
+	case ' ', '\t', '\r', NEWLINE:
+		// A backslash at the end of a line trims the line break and any whitespace that follows
+		if ! multiLine {
+			Error(parser.context, "Invalid escape: '\\%c'", ch)
+		}
+		for ch := parser.peek(0); ch == ' ' || ch == '\t' || ch == '\r' || ch == NEWLINE; ch = parser.peek(0) {
+			parser.next()
+		}
+	default:
+		Error(parser.context, "Invalid escape: '\\%c'", ch)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// Prints the values in a map then each nested map as a [table] and each tuple of maps as an [[array of tables]].
+func (grammar TomlGrammar) printTable(path []string, mapp tuple.Map, out func(value string)) {
+	style := grammar.style
+	keys, values := mapKeys(mapp)
+	for _, key := range keys {
+		if isTomlTable(values[key]) || isTomlArrayOfTables(values[key]) {
+			continue
+		}
+		out(tomlKey(key))
+		out(style.KeyValueSeparator)
+		grammar.printValue(values[key], out)
+		out(style.LineBreak)
+	}
+	for _, key := range keys {
+		if isTomlTable(values[key]) {
+			table := append(append([]string{}, path...), key)
+			out(style.LineBreak)
+			out("[" + tomlPath(table) + "]")
+			out(style.LineBreak)
+			grammar.printTable(table, values[key].(tuple.Map), out)
+		}
+	}
+	for _, key := range keys {
+		if isTomlArrayOfTables(values[key]) {
+			table := append(append([]string{}, path...), key)
+			list, _ := tuple.AsTuple(values[key])
+			for _, element := range list.List {
+				out(style.LineBreak)
+				out("[[" + tomlPath(table) + "]]")
+				out(style.LineBreak)
+				grammar.printTable(table, element.(tuple.Map), out)
+			}
+		}
+	}
+}
+
+// The keys of a map in order along with their values, TOML has no null so a key whose value is null is left out.
+func mapKeys(mapp tuple.Map) ([]string, map[string]Value) {
+	keys := []string{}
+	values := map[string]Value{}
+	mapp.ForallKeyValue(func (key Tag, value Value) {
+		if _, ok := value.(tuple.Null); ok {
+			return
+		}
+		keys = append(keys, key.Name)
+		values[key.Name] = value
+	})
+	return keys, values
+}
+
+func isTomlTable(value Value) bool {
+	_, ok := value.(tuple.Map)
+	return ok
+}
+
+func isTomlArrayOfTables(value Value) bool {
+	list, ok := tuple.AsTuple(value)
+	if ! ok || list.Arity() == 0 {
+		return false
+	}
+	for _, element := range list.List {
+		if ! isTomlTable(element) {
+			return false
+		}
+	}
+	return true
+}
+
+func tomlKey(key string) string {
+	if key == "" {
+		return tuple.DoubleQuotedString(key)
+	}
+	for _, ch := range key {
+		if ! isTomlBareKey(ch) {
+			return tomlQuote(key)
+		}
+	}
+	return key
+}
+
+func tomlPath(keys []string) string {
+	quoted := []string{}
+	for _, key := range keys {
+		quoted = append(quoted, tomlKey(key))
+	}
+	return strings.Join(quoted, ".")
+}
+
+// A basic string, control characters are escaped as TOML has no \x escape.
+func tomlQuote(text string) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for _, ch := range text {
+		switch {
+		case ch == '"': builder.WriteString("\\\"")
+		case ch == '\\': builder.WriteString("\\\\")
+		case ch == '\b': builder.WriteString("\\b")
+		case ch == '\t': builder.WriteString("\\t")
+		case ch == '\n': builder.WriteString("\\n")
+		case ch == '\f': builder.WriteString("\\f")
+		case ch == '\r': builder.WriteString("\\r")
+		case ch < ' ' || ch == 0x7f: builder.WriteString(fmt.Sprintf("\\u%04X", ch))
+		default: builder.WriteRune(ch)
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
+
+// Prints a value on one line, maps within arrays are inline tables.
+func (grammar TomlGrammar) printValue(value Value, out func(value string)) {
+	style := grammar.style
+	switch value.(type) {
+	case String:
+		out(tomlQuote(string(value.(String))))
+	case Tag:
+		name := value.(Tag).Name
+		if name == "true" || name == "false" || isTomlDateTime(name) {
+			out(name)
+		} else {
+			out(tomlQuote(name))
+		}
+	case Bool: out(tuple.BoolToString(bool(value.(Bool))))
+	case Int64: out(tuple.Int64ToString(value.(Int64)))
+	case BigInt: out(value.(BigInt).String())
+	case Decimal: out(value.(Decimal).String())
+	case Float64:
+		number := float64(value.(Float64))
+		switch {
+		case math.IsNaN(number): out("nan")
+		case math.IsInf(number, 1): out("inf")
+		case math.IsInf(number, -1): out("-inf")
+		default:
+			text := tuple.FloatToString(number)
+			if ! strings.ContainsAny(text, ".eE") {
+				text += ".0"
+			}
+			out(text)
+		}
+	case tuple.Map:
+		keys, values := mapKeys(value.(tuple.Map))
+		out("{")
+		for k, key := range keys {
+			if k > 0 {
+				out(style.Separator)
+			}
+			out(tomlKey(key))
+			out(style.KeyValueSeparator)
+			grammar.printValue(values[key], out)
+		}
+		out("}")
+	default:
+		out(style.Open)
+		k := 0
+		value.ForallValues(func (element Value) error {
+			if k > 0 {
+				out(style.Separator)
+			}
+			grammar.printValue(element, out)
+			k += 1
+			return nil
+		})
+		out(style.Close)
+	}
+}
+
+// A document must be a map, anything else is printed as the value of a TOML_VALUE key.
+func (grammar TomlGrammar) Print(token Value, out func(value string)) {
+	mapp, ok := token.(tuple.Map)
+	if ! ok {
+		wrapped := tuple.NewTagValueMap()
+		wrapped.Add(Tag{TOML_VALUE}, token)
+		mapp = wrapped
+	}
+	grammar.printTable([]string{}, mapp, out)
+}
+
+func NewTomlGrammar() Grammar {
+	// https://toml.io/en/v1.0.0
+	style := NewStyle("", "", "",
+		"[", "]", "{", "}", " = ",
+		", ", "\n", "true", "false", '#', "")
+	return TomlGrammar{style}
+}
@@ -0,0 +1,150 @@
+package parsers_test
+
+import (
+	"testing"
+	"tuple"
+	"tuple/parsers"
+	"reflect"
+	"math"
+)
+
+func TestTomlParse(t *testing.T) {
+	var grammar = parsers.NewTomlGrammar()
+
+	test := func(toml string, expected tuple.Value) {
+		val, err := parsers.ParseString(logger, grammar, toml)
+		if err != nil {
+			t.Errorf("Given '%s' expected '%s' got error '%s'", toml, expected, err)
+		}
+		if ! reflect.DeepEqual(val, expected) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", toml, expected, val)
+		}
+	}
+
+	root := tuple.NewTagValueMap()
+	root.Add(Tag{"a"}, one)
+	test("a = 1", root)
+	test("# comment\n\na = 0x1 # comment\n", root)
+	test("a = +1\r\n", root)
+
+	values := func(value tuple.Value) tuple.Value {
+		root := tuple.NewTagValueMap()
+		root.Add(Tag{"a"}, value)
+		return root
+	}
+	test("a = 1_000", values(tuple.Int64(1000)))
+	test("a = 0o17", values(tuple.Int64(15)))
+	test("a = -1.5e2", values(tuple.Float64(-150)))
+	test("a = -inf", values(tuple.Float64(math.Inf(-1))))
+	test("a = true", values(tuple.Bool(true)))
+	big, _ := tuple.IntegerFromString("18446744073709551616", 10)
+	test("a = 18_446_744_073_709_551_616", values(big))
+	test("a = 1979-05-27T07:32:00Z", values(Tag{"1979-05-27T07:32:00Z"}))
+	test("a = 1979-05-27 07:32:00", values(Tag{"1979-05-27 07:32:00"}))
+	test("a = 07:32:00.5", values(Tag{"07:32:00.5"}))
+	test("a = \"tab\\t\\u00e9\"", values(tuple.String("tab\té")))
+	test("a = 'C:\\path'", values(tuple.String("C:\\path")))
+	test("a = \"\"\"\nline \\\n   one\n\"two\"\"\"\"", values(tuple.String("line one\n\"two\"")))
+	test("a = '''\nraw\\n'''", values(tuple.String("raw\\n")))
+	test("a = [ 0,\n 1, # comment\n ]", values(tuple.NewTuple(zero, one)))
+
+	inline := tuple.NewTagValueMap()
+	inline.Add(Tag{"x"}, one)
+	test("a = { x = 1 }", values(inline))
+	test("a.x = 1", values(inline))
+	test("[a]\nx = 1", values(inline))
+	test("\"a\" . 'x' = 1", values(inline))
+
+	first := tuple.NewTagValueMap()
+	first.Add(Tag{"x"}, one)
+	second := tuple.NewTagValueMap()
+	nested := tuple.NewTagValueMap()
+	nested.Add(Tag{"y"}, zero)
+	second.Add(Tag{"b"}, nested)
+	test("[[a]]\nx = 1\n[[a]]\n[a.b]\ny = 0\n", values(tuple.NewTuple(first, second)))
+}
+
+func TestTomlErrors(t *testing.T) {
+	var grammar = parsers.NewTomlGrammar()
+
+	test := func(toml string) {
+		_, err := parsers.ParseString(logger, grammar, toml)
+		if err == nil {
+			t.Errorf("Given '%s' expected an error", toml)
+		}
+	}
+
+	test("a = 1\na = 2")
+	test("[a]\n[a]")
+	test("a = 1\n[a]")
+	test("a = 1 b = 2")
+	test("a = \"open")
+	test("a = 01")
+}
+
+func TestTomlRoundTrip(t *testing.T) {
+	var grammar = parsers.NewTomlGrammar()
+
+	test := func(text string) {
+		val, err := parsers.ParseString(logger, grammar, text)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", text, err)
+		}
+		printed := ""
+		grammar.Print(val, func(value string) {
+			printed += value
+		})
+		result, err := parsers.ParseString(logger, grammar, printed)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", printed, err)
+		}
+		if ! reflect.DeepEqual(val, result) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", text, val, result)
+		}
+	}
+
+	test("a = 1")
+	test("title = \"say \\\"hi\\\"\\n\"\n\"key with.dot\" = 1.0\n[t.u]\nv = [[1, 2], {w = inf}]\n")
+	test("[[p]]\nx = 1\n[p.q]\ny = 'z'\n[[p]]\n")
+	test("a = 18446744073709551616")
+
+	// Dates and times are printed as they were written
+	// Dates and times are printed as they were written, a string that looks like a date is still quoted
+	dates := "a = 1979-05-27T07:32:00Z\nb = 1979-05-27 07:32:00\nc = 1979-05-27\nd = 07:32:00.5\ne = \"07:32\"\nf = \"2024-01-01\"\n"
+	test(dates)
+	val, _ := parsers.ParseString(logger, grammar, dates)
+	printed := ""
+	grammar.Print(val, func(value string) {
+		printed += value
+	})
+	if printed != dates {
+		t.Errorf("Expected '%s' got '%s'", dates, printed)
+	}
+}
+
+func TestTomlPrint(t *testing.T) {
+	var grammar = parsers.NewTomlGrammar()
+
+	test := func(value tuple.Value, expected string) {
+		printed := ""
+		grammar.Print(value, func(value string) {
+			printed += value
+		})
+		if printed != expected {
+			t.Errorf("Given '%s' expected '%s' got '%s'", value, expected, printed)
+		}
+		if _, err := parsers.ParseString(logger, grammar, printed); err != nil {
+			t.Errorf("Given '%s' printed '%s' got error '%s'", value, printed, err)
+		}
+	}
+
+	// A value that is not a map is printed under a key, a null is left out
+	test(one, "value = 1\n")
+	test(tuple.NewTuple(one, tuple.String("2024-01-01")), "value = [1, \"2024-01-01\"]\n")
+	test(tuple.NewTuple(tuple.NewTagValueMap()), "\n[[value]]\n")
+	test(tuple.NULL, "")
+	mapp := tuple.NewTagValueMap()
+	mapp.Add(Tag{"a"}, tuple.NULL)
+	mapp.Add(Tag{"b"}, one)
+	test(mapp, "b = 1\n")
+}
@@ -0,0 +1,404 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package parsers
+import "tuple"
+import "encoding/xml"
+import "io"
+import "strconv"
+import "strings"
+import "unicode"
+import "unicode/utf8"
+
+/////////////////////////////////////////////////////////////////////////////
+// XML Grammar
+/////////////////////////////////////////////////////////////////////////////
+
+type XmlGrammar struct {
+	style Style
+}
+
+func (grammar XmlGrammar) Name() string {
+	return "XML"
+}
+
+func (grammar XmlGrammar) FileSuffix() string {
+	return ".xml"
+}
+
+// Parses each top level element into a tuple headed by a tag with the element name,
+// followed by a map of the attributes if there are any, then the text and child elements.
+// Namespace prefixes are kept as part of the names, comments and processing instructions are ignored
+// as is text that is only whitespace. The '_' elements written by the printer for names that are
+// not XML names, or to separate text, are read back as they were.
+func (grammar XmlGrammar) Parse(context Context, next Next) error {
+	decoder := xml.NewDecoder(&contextReader{context, nil})
+	decoder.Strict = true
+	elements := []Tuple{}
+	locations := []Location{}
+	for {
+		location := context.Location()
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			Error(context, "%s", err)
+			return nil
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			start := token.(xml.StartElement)
+			element := NewTuple(Tag{xmlName(start.Name)})
+			if len(start.Attr) > 0 {
+				attributes := tuple.NewTagValueMap()
+				for _, attribute := range start.Attr {
+					attributes.Add(Tag{xmlName(attribute.Name)}, String(attribute.Value))
+				}
+				context.Locations().Add(attributes, location)
+				element.Append(attributes)
+			}
+			elements = append(elements, element)
+			locations = append(locations, location)
+			context.Open()
+		case xml.EndElement:
+			end := token.(xml.EndElement)
+			if len(elements) == 0 {
+				Error(context, "Unexpected end element '</%s>'", xmlName(end.Name))
+				continue
+			}
+			element := elements[len(elements)-1]
+			elements = elements[:len(elements)-1]
+			location := locations[len(locations)-1]
+			locations = locations[:len(locations)-1]
+			context.Close()
+			if tag, _ := Head(element); tag.Name != xmlName(end.Name) {
+				Error(context, "Expected '</%s>' but found '</%s>'", tag.Name, xmlName(end.Name))
+			}
+			value := xmlUnwrap(element)
+			context.Locations().Add(value, location)
+			if len(elements) > 0 {
+				elements[len(elements)-1].Append(value)
+			} else if err := next(value); err != nil {
+				return err
+			}
+		case xml.CharData:
+			text := string(token.(xml.CharData))
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			if len(elements) == 0 {
+				Error(context, "Unexpected text outside an element: '%s'", strings.TrimSpace(text))
+				continue
+			}
+			elements[len(elements)-1].Append(String(text))
+		}
+	}
+	if len(elements) > 0 {
+		tag, _ := Head(elements[len(elements)-1])
+		Error(context, "Missing end element '</%s>'", tag.Name)
+	}
+	return nil
+}
+
+// The element printed in place of a name that is not an XML name, around text next to other text
+// and around a tuple without a tag at its head. Text with characters XML cannot hold is quoted within one.
+const XML_ANONYMOUS = "_"
+const XML_NAME_ATTRIBUTE = "name"
+const XML_QUOTED_ATTRIBUTE = "quoted"
+
+// Reverses the wrapping done by printElement and printText.
+func xmlUnwrap(element Tuple) Value {
+	if tag, _ := Head(element); tag.Name != XML_ANONYMOUS {
+		return element
+	}
+	if element.Arity() == 2 {
+		if _, ok := element.Get(1).(String); ok {
+			return element.Get(1)
+		}
+	}
+	if element.Arity() == 1 {
+		return NewTuple()
+	}
+	attributes, ok := element.Get(1).(tuple.TagValueMap)
+	if ! ok {
+		return NewTuple(element.List[1:]...)
+	}
+	quoted, _ := attributes.Get(Tag{XML_QUOTED_ATTRIBUTE})
+	name, named := attributes.Get(Tag{XML_NAME_ATTRIBUTE})
+	switch {
+	case quoted == String("true") && named && attributes.Arity() == 2:
+		if text, err := strconv.Unquote(string(name.(String))); err == nil {
+			return NewTuple(append([]Value{Tag{text}}, element.List[2:]...)...)
+		}
+	case quoted == String("true") && attributes.Arity() == 1 && element.Arity() == 3:
+		if content, ok := element.Get(2).(String); ok {
+			if text, err := strconv.Unquote(string(content)); err == nil {
+				return String(text)
+			}
+		}
+	case named && attributes.Arity() == 1:
+		return NewTuple(append([]Value{Tag{string(name.(String))}}, element.List[2:]...)...)
+	}
+	return element
+}
+
+// https://www.w3.org/TR/xml/#NT-Name
+func isXmlName(name string) bool {
+	for k, ch := range name {
+		switch {
+		case ch == '_' || ch == ':' || unicode.IsLetter(ch):
+		case k > 0 && (ch == '-' || ch == '.' || unicode.IsDigit(ch)):
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// Adapts a parser context to an io.Reader, reading a byte at a time keeps the location up to date.
+type contextReader struct {
+	context Context
+	pending []byte
+}
+
+func (reader *contextReader) ReadByte() (byte, error) {
+	if len(reader.pending) == 0 {
+		ch, err := reader.context.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if ch == NEWLINE {
+			reader.context.EOL()
+		}
+		reader.pending = []byte(string(ch))
+	}
+	b := reader.pending[0]
+	reader.pending = reader.pending[1:]
+	return b, nil
+}
+
+func (reader *contextReader) Read(buffer []byte) (int, error) {
+	if len(buffer) == 0 {
+		return 0, nil
+	}
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	buffer[0] = b
+	return 1, nil
+}
+
+// Prints a tuple headed by a tag as an element, a map as an element for each key and anything else within an '_' element.
+// An element containing text is printed on one line so no whitespace is added to its text.
+// Attributes are printed in the order of the map, when any of their names is not an XML name
+// the map is printed as a child instead.
+func (grammar XmlGrammar) printObject(depth string, token Value, out func(value string)) {
+	style := grammar.style
+	switch token.(type) {
+	case tuple.Map:
+		token.(tuple.Map).ForallKeyValue(func (key Tag, value Value) {
+			if list, ok := tuple.AsTuple(value); ok && list.Arity() > 0 {
+				if _, ok := Head(list); ! ok {
+					for _, value := range list.List {
+						grammar.printElement(depth, key.Name, nil, []Value{value}, out)
+					}
+					return
+				}
+			}
+			grammar.printElement(depth, key.Name, nil, []Value{value}, out)
+		})
+	case Tuple, tuple.Vector:
+		asTuple, _ := tuple.AsTuple(token)
+		list := asTuple.List
+		tag, ok := Head(token)
+		if ! ok {
+			grammar.printElement(depth, XML_ANONYMOUS, nil, list, out)
+			return
+		}
+		var attributes tuple.Map
+		children := list[1:]
+		if len(children) > 0 {
+			if mapp, ok := children[0].(tuple.Map); ok && grammar.xmlAttributes(mapp) {
+				attributes = mapp
+				children = children[1:]
+			}
+		}
+		grammar.printElement(depth, tag.Name, attributes, children, out)
+	default:
+		out(depth)
+		grammar.printText(token, true, out)
+		out(style.LineBreak)
+	}
+}
+
+func (grammar XmlGrammar) xmlAttributes(mapp tuple.Map) bool {
+	valid := true
+	mapp.ForallKeyValue(func (key Tag, value Value) {
+		valid = valid && isXmlName(key.Name) && IsAtom(value) && isXmlText(grammar.textOf(value))
+	})
+	return valid
+}
+
+// A name that is not an XML name is printed as the 'name' attribute of an '_' element,
+// text next to other text is printed within an '_' element.
+func (grammar XmlGrammar) printElement(depth string, name string, attributes tuple.Map, children []Value, out func(value string)) {
+	style := grammar.style
+	out(depth)
+	out("<")
+	element := name
+	if ! isXmlName(name) {
+		element = XML_ANONYMOUS
+		out(element)
+		out(" " + XML_NAME_ATTRIBUTE + "=\"")
+		if isXmlText(name) {
+			out(xmlEscape(name, true))
+			out("\"")
+		} else {
+			out(xmlEscape(tuple.DoubleQuotedString(name), true))
+			out("\" " + XML_QUOTED_ATTRIBUTE + "=\"true\"")
+		}
+	} else {
+		out(name)
+	}
+	if attributes != nil {
+		attributes.ForallKeyValue(func (key Tag, value Value) {
+			out(" ")
+			out(key.Name)
+			out("=\"")
+			out(xmlEscape(grammar.textOf(value), true))
+			out("\"")
+		})
+	}
+	if len(children) == 0 {
+		out("/>")
+		out(style.LineBreak)
+		return
+	}
+	out(">")
+	inline := false
+	for _, child := range children {
+		if IsAtom(child) {
+			inline = true
+		}
+	}
+	if inline {
+		compact := grammar
+		compact.style.Indent = ""
+		compact.style.LineBreak = ""
+		for k, child := range children {
+			if IsAtom(child) {
+				adjacent := (k > 0 && IsAtom(children[k-1])) || (k+1 < len(children) && IsAtom(children[k+1]))
+				grammar.printText(child, adjacent, out)
+			} else {
+				compact.printObject("", child, out)
+			}
+		}
+	} else {
+		out(style.LineBreak)
+		for _, child := range children {
+			grammar.printObject(depth + style.Indent, child, out)
+		}
+		out(depth)
+	}
+	out("</")
+	out(element)
+	out(">")
+	out(style.LineBreak)
+}
+
+// Prints the text of a scalar, within an '_' element if wrapped. Text with characters XML cannot
+// hold, such as most control characters, is printed quoted within an '_' element.
+func (grammar XmlGrammar) printText(value Value, wrap bool, out func(value string)) {
+	text := grammar.textOf(value)
+	if ! isXmlText(text) {
+		out("<" + XML_ANONYMOUS + " " + XML_QUOTED_ATTRIBUTE + "=\"true\">")
+		out(xmlEscape(tuple.DoubleQuotedString(text), false))
+		out("</" + XML_ANONYMOUS + ">")
+		return
+	}
+	if wrap {
+		out("<" + XML_ANONYMOUS + ">")
+	}
+	out(xmlEscape(text, false))
+	if wrap {
+		out("</" + XML_ANONYMOUS + ">")
+	}
+}
+
+func (grammar XmlGrammar) textOf(value Value) string {
+	text := ""
+	switch value.(type) {
+	case Tag: text = value.(Tag).Name
+	case String: text = string(value.(String))
+	case Bool, Int64, Float64, BigInt, Decimal: PrintScalar(grammar.style, "", value, func (value string) { text += value })
+	}
+	return text
+}
+
+// https://www.w3.org/TR/xml/#NT-Char
+func isXmlText(text string) bool {
+	for k, ch := range text {
+		switch {
+		case ch == utf8.RuneError && ! strings.HasPrefix(text[k:], string(utf8.RuneError)):
+			return false
+		case ch == '\t' || ch == '\n' || ch == '\r':
+		case ch < 0x20 || (ch >= 0xD800 && ch <= 0xDFFF) || ch == 0xFFFE || ch == 0xFFFF:
+			return false
+		}
+	}
+	return true
+}
+
+// Escapes text, within an attribute quotes and whitespace other than spaces are also escaped.
+func xmlEscape(text string, attribute bool) string {
+	var builder strings.Builder
+	for len(text) > 0 {
+		ch, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		switch {
+		case ch == '&': builder.WriteString("&amp;")
+		case ch == '<': builder.WriteString("&lt;")
+		case ch == '>': builder.WriteString("&gt;")
+		case ch == '"' && attribute: builder.WriteString("&quot;")
+		case ch == '\n' && attribute: builder.WriteString("&#xA;")
+		case ch == '\r': builder.WriteString("&#xD;")
+		case ch == '\t' && attribute: builder.WriteString("&#x9;")
+		default: builder.WriteRune(ch)
+		}
+	}
+	return builder.String()
+}
+
+func (grammar XmlGrammar) Print(token Value, out func(value string)) {
+	grammar.printObject("", token, out)
+}
+
+func NewXmlGrammar() Grammar {
+	// https://www.w3.org/TR/xml/
+	style := NewStyle("", "", "  ",
+		"<", ">", "", "", "",
+		"", "\n", "true", "false", 0, "")
+	return XmlGrammar{style}
+}
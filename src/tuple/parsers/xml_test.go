@@ -0,0 +1,143 @@
+package parsers_test
+
+import (
+	"testing"
+	"tuple"
+	"tuple/parsers"
+	"reflect"
+)
+
+func TestXmlParse(t *testing.T) {
+	var grammar = parsers.NewXmlGrammar()
+
+	test := func(xml string, expected tuple.Value) {
+		val, err := parsers.ParseString(logger, grammar, xml)
+		if err != nil {
+			t.Errorf("Given '%s' expected '%s' got error '%s'", xml, expected, err)
+		}
+		if ! reflect.DeepEqual(val, expected) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", xml, expected, val)
+		}
+	}
+
+	test("<a/>", tuple.NewTuple(Tag{"a"}))
+	test("<?xml version=\"1.0\"?>\n<!-- comment -->\n<a>\n</a>\n", tuple.NewTuple(Tag{"a"}))
+	test("<a>x &amp; y</a>", tuple.NewTuple(Tag{"a"}, tuple.String("x & y")))
+	test("<a><![CDATA[<b>]]></a>", tuple.NewTuple(Tag{"a"}, tuple.String("<b>")))
+
+	attributes := tuple.NewTagValueMap()
+	attributes.Add(Tag{"id"}, tuple.String("1"))
+	attributes.Add(Tag{"xmlns:m"}, tuple.String("urn:m"))
+	test("<a id=\"1\" xmlns:m='urn:m'>\n  <m:b>text</m:b>\n  <c/>\n</a>",
+		tuple.NewTuple(Tag{"a"}, attributes, tuple.NewTuple(Tag{"m:b"}, tuple.String("text")), tuple.NewTuple(Tag{"c"})))
+}
+
+func TestXmlRoundTrip(t *testing.T) {
+	var grammar = parsers.NewXmlGrammar()
+
+	test := func(text string, expected string) {
+		val, err := parsers.ParseString(logger, grammar, text)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", text, err)
+		}
+		printed := ""
+		grammar.Print(val, func(value string) {
+			printed += value
+		})
+		if printed != expected {
+			t.Errorf("Given '%s' expected '%s' got '%s'", text, expected, printed)
+		}
+		result, err := parsers.ParseString(logger, grammar, printed)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", printed, err)
+		}
+		if ! reflect.DeepEqual(val, result) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", text, val, result)
+		}
+	}
+
+	test("<a/>", "<a/>\n")
+	test("<a x='&lt;\"&gt;'><b>1 &amp; 2</b><c>mixed <d>text</d></c></a>",
+		"<a x=\"&lt;&quot;&gt;\">\n  <b>1 &amp; 2</b>\n  <c>mixed <d>text</d></c>\n</a>\n")
+	test("<a z='1' y='2' x='3'/>", "<a z=\"1\" y=\"2\" x=\"3\"/>\n")
+	test("<_ name='a b'><_>1</_><_>2</_></_>", "<_ name=\"a b\"><_>1</_><_>2</_></_>\n")
+}
+
+func TestXmlPrintNames(t *testing.T) {
+	var grammar = parsers.NewXmlGrammar()
+
+	test := func(value tuple.Value, expected string, reparsed tuple.Value) {
+		printed := ""
+		grammar.Print(value, func(value string) {
+			printed += value
+		})
+		if printed != expected {
+			t.Errorf("Given '%v' expected '%s' got '%s'", value, expected, printed)
+		}
+		result, err := parsers.ParseString(logger, grammar, printed)
+		if err != nil || ! reflect.DeepEqual(result, reparsed) {
+			t.Errorf("Given '%s' expected '%v' got '%v' %v", printed, reparsed, result, err)
+		}
+	}
+
+	one := tuple.String("1")
+	two := tuple.String("2")
+	test(tuple.NewTuple(Tag{"+"}, tuple.Int64(1), tuple.Int64(2)),
+		"<_ name=\"+\"><_>1</_><_>2</_></_>\n", tuple.NewTuple(Tag{"+"}, one, two))
+	test(tuple.NewTuple(Tag{"a b"}, tuple.Int64(1)), "<_ name=\"a b\">1</_>\n", tuple.NewTuple(Tag{"a b"}, one))
+	test(tuple.NewTuple(Tag{"1x"}, tuple.NewTuple(Tag{"b"}), tuple.Int64(2)),
+		"<_ name=\"1x\"><b/>2</_>\n", tuple.NewTuple(Tag{"1x"}, tuple.NewTuple(Tag{"b"}), two))
+
+	attributes := tuple.NewTagValueMap()
+	attributes.Add(Tag{"a b"}, one)
+	test(tuple.NewTuple(Tag{"x"}, attributes), "<x>\n  <_ name=\"a b\">1</_>\n</x>\n", tuple.NewTuple(Tag{"x"}, tuple.NewTuple(Tag{"a b"}, one)))
+}
+
+func TestXmlPrintAnonymous(t *testing.T) {
+	var grammar = parsers.NewXmlGrammar()
+
+	test := func(value tuple.Value, expected string, reparsed tuple.Value) {
+		printed := ""
+		grammar.Print(value, func(value string) {
+			printed += value
+		})
+		if printed != expected {
+			t.Errorf("Given '%v' expected '%s' got '%s'", value, expected, printed)
+		}
+		result, err := parsers.ParseString(logger, grammar, printed)
+		if err != nil || ! reflect.DeepEqual(result, reparsed) {
+			t.Errorf("Given '%s' expected '%v' got '%v' %v", printed, reparsed, result, err)
+		}
+	}
+
+	// Text and tuples without a tag at their head are printed within an '_' element
+	test(tuple.Int64(1), "<_>1</_>\n", tuple.String("1"))
+	test(tuple.String("a < b"), "<_>a &lt; b</_>\n", tuple.String("a < b"))
+	test(tuple.NewTuple(), "<_/>\n", tuple.NewTuple())
+	test(tuple.NewTuple(tuple.Int64(1), tuple.Int64(2)), "<_><_>1</_><_>2</_></_>\n", tuple.NewTuple(tuple.String("1"), tuple.String("2")))
+	test(tuple.NewTuple(Tag{"a"}, tuple.NewTuple(tuple.NewTuple(Tag{"b"}))), "<a>\n  <_>\n    <b/>\n  </_>\n</a>\n",
+		tuple.NewTuple(Tag{"a"}, tuple.NewTuple(tuple.NewTuple(Tag{"b"}))))
+
+	// Characters XML cannot hold are quoted
+	test(tuple.String("bell\a"), "<_ quoted=\"true\">\"bell\\a\"</_>\n", tuple.String("bell\a"))
+	test(tuple.NewTuple(Tag{"a"}, tuple.String("x\x00 & y")), "<a><_ quoted=\"true\">\"x\\x00 &amp; y\"</_></a>\n",
+		tuple.NewTuple(Tag{"a"}, tuple.String("x\x00 & y")))
+	test(tuple.NewTuple(Tag{"a\x01"}), "<_ name=\"&quot;a\\x01&quot;\" quoted=\"true\"/>\n", tuple.NewTuple(Tag{"a\x01"}))
+	attributes := tuple.NewTagValueMap()
+	attributes.Add(Tag{"b"}, tuple.String("\x1b"))
+	test(tuple.NewTuple(Tag{"a"}, attributes), "<a>\n  <b><_ quoted=\"true\">\"\\x1b\"</_></b>\n</a>\n",
+		tuple.NewTuple(Tag{"a"}, tuple.NewTuple(Tag{"b"}, tuple.String("\x1b"))))
+}
+
+func TestXmlPrintMap(t *testing.T) {
+	var grammar = parsers.NewXmlGrammar()
+	mapp := tuple.NewTagValueMap()
+	mapp.Add(Tag{"a"}, tuple.NewTuple(one, tuple.String("x")))
+	printed := ""
+	grammar.Print(mapp, func(value string) {
+		printed += value
+	})
+	if printed != "<a>1</a>\n<a>x</a>\n" {
+		t.Errorf("Got '%s'", printed)
+	}
+}
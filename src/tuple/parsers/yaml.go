@@ -0,0 +1,733 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package parsers
+
+import "tuple"
+import "math"
+import "regexp"
+import "strconv"
+import "strings"
+
+/////////////////////////////////////////////////////////////////////////////
+// Yaml Grammar
+/////////////////////////////////////////////////////////////////////////////
+
+// http://www.yamllint.com/
+// https://yaml.org/spec/1.2/spec.html
+type Yaml struct {
+	Style
+}
+
+func (grammar Yaml) Name() string {
+	return "Yaml"
+}
+
+func (grammar Yaml) FileSuffix() string {
+	return ".yaml"
+}
+
+// Parses a stream of YAML documents, each document is passed on to 'next'.
+//
+// Supports block mappings and sequences, flow collections, plain, quoted and block scalars.
+// Anchors, aliases, explicit tags and complex keys are not supported.
+func (grammar Yaml) Parse(context Context, next Next) error {
+	parser := yamlParser{context, nil, false, context.Location()}
+	return parser.parseStream(next)
+}
+
+// Prints a value as a block starting on a new line at the given indentation.
+func (grammar Yaml) printObject(depth string, token Value, out func(value string)) {
+
+	style := grammar.Style
+
+	if IsAtom(token) {
+		out(depth)
+		grammar.printScalar(token, out)
+		out(style.LineBreak)
+		return
+	}
+	if mapp, ok := token.(tuple.Map); ok {
+		mapp.ForallKeyValue(func (key Tag, value Value) {
+			out(depth)
+			Quote(key.Name, out)
+			out(style.KeyValueSeparator)
+			grammar.printNested(depth, value, out)
+		})
+		return
+	}
+	// A tuple is a sequence, a tag at its head is its first item so the tuple reads back as a sequence
+	token.ForallValues(func (value Value) error {
+		out(depth)
+		out("-")
+		grammar.printNested(depth, value, out)
+		return nil
+	})
+}
+
+// Prints a value that follows a key or a '-' on the same line,
+// anything other than a scalar starts on the next line and is indented.
+func (grammar Yaml) printNested(depth string, value Value, out func(value string)) {
+	if IsAtom(value) {
+		out(" ")
+		grammar.printScalar(value, out)
+		out(grammar.Style.LineBreak)
+	} else {
+		out(grammar.Style.LineBreak)
+		grammar.printObject(depth + grammar.Style.Indent, value, out)
+	}
+}
+
+func (grammar Yaml) printScalar(value Value, out func(value string)) {
+	if _, ok := value.(tuple.Map); ok {
+		out(OPEN_BRACE)
+		out(CLOSE_BRACE)
+		return
+	}
+	switch value.(type) {
+	case Tag: Quote(value.(Tag).Name, out)
+	case String, Bool, Int64, Float64, BigInt, Decimal, Null: PrintScalar(grammar.Style, "", value, out)
+	default:
+		out(OPEN_SQUARE_BRACKET)
+		out(CLOSE_SQUARE_BRACKET)
+	}
+}
+
+// Each value is printed as a separate YAML document so a stream of values reads back as the same values.
+func (grammar Yaml) Print(object Value, out func(value string)) {
+	// TODO PrintExpression(grammar, "", object, out)  // TODO Use Printer
+	out(grammar.Style.StartDoc)
+	grammar.printObject("", object, out)
+}
+
+func NewYamlGrammar() Grammar {
+	style := NewStyle("---\n", "...\n", "  ",
+		":", "", OPEN_SQUARE_BRACKET, CLOSE_SQUARE_BRACKET, ":",
+		"", "\n", "true", "false", '#', "- ")
+	style.Null = "~"
+	return Yaml{style}
+}
+
+
+func (parser Yaml) PrintIndent(depth string, out StringFunction) {
+	out(depth)
+}
+
+func (parser Yaml) PrintSuffix(depth string, out StringFunction) {
+	out(string(NEWLINE))
+}
+
+func (parser Yaml) PrintSeparator(depth string, out StringFunction) {}
+
+func (parser Yaml) PrintEmptyTuple(depth string, out StringFunction) {
+	out("[]")
+}
+func (parser Yaml) PrintOpenTuple(depth string, tuple Value, out StringFunction) string {
+	out("- ")
+	return depth + "  "
+}
+
+func (parser Yaml) PrintHeadTag(tag Tag, out StringFunction) {
+	Quote(tag.Name, out)
+	out(": ")
+}
+
+func (parser Yaml) PrintCloseTuple(depth string, tuple Value, out StringFunction) {}
+
+func (parser Yaml) PrintTag(depth string, tag Tag, out StringFunction) {
+	Quote(tag.Name, out)
+	//bout(tag.Name)
+}
+
+func (parser Yaml) PrintScalarPrefix(depth string, out StringFunction) {
+	out ("- ")
+}
+
+func (parser Yaml) PrintNullaryOperator(depth string, tag Tag, out StringFunction) {
+	PrintTuple(&parser, depth, NewTuple(tag), out)
+}
+
+func (parser Yaml) PrintUnaryOperator(depth string, tag Tag, value Value, out StringFunction) {
+	PrintTuple(&parser, depth, NewTuple(tag, value), out)
+}
+
+func (parser Yaml) PrintBinaryOperator(depth string, tag Tag, value1 Value, value2 Value, out StringFunction) {
+	PrintTuple(&parser, depth, NewTuple(tag, value1, value2), out)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Yaml Parser
+//
+// YAML uses indentation rather than brackets for nesting, so unlike the other
+// grammars it does not use the 'Style' lexer but reads a line at a time.
+/////////////////////////////////////////////////////////////////////////////
+
+const YAML_START_DOCUMENT = "---"
+const YAML_END_DOCUMENT = "..."
+
+var integerPattern = regexp.MustCompile(`^[-+]?[0-9]+$`)
+var yamlHexPattern = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+var yamlOctalPattern = regexp.MustCompile(`^0o[0-7]+$`)
+var floatPattern = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+
+type yamlLine struct {
+	text string    // The line as read, without the line break
+	indent int     // The number of leading spaces
+	content string // The line without indentation and comments
+	location Location
+}
+
+func newYamlLine(text string) *yamlLine {
+	indent := len(text) - len(strings.TrimLeft(text, " "))
+	content := strings.TrimSpace(yamlStripComment(text[indent:]))
+	return &yamlLine{text, indent, content, Location{}}
+}
+
+func (line *yamlLine) isMarker(marker string) bool {
+	return line.indent == 0 && (line.content == marker || strings.HasPrefix(line.content, marker + " "))
+}
+
+func (line *yamlLine) isDocumentMarker() bool {
+	return line.isMarker(YAML_START_DOCUMENT) || line.isMarker(YAML_END_DOCUMENT)
+}
+
+type yamlParser struct {
+	context Context
+	lookAhead *yamlLine
+	eof bool
+	current Location // Of the line most recently consumed
+}
+
+// Returns the next line, including blank lines, without consuming it.
+func (parser *yamlParser) peekRaw() *yamlLine {
+	if parser.lookAhead == nil && ! parser.eof {
+		location := parser.context.Location()
+		text, ok := ReadLine(parser.context)
+		if ok {
+			parser.lookAhead = newYamlLine(text)
+			parser.lookAhead.location = location
+		} else {
+			parser.eof = true
+		}
+	}
+	return parser.lookAhead
+}
+
+// Returns the next line with some content, skipping blank lines and comments.
+func (parser *yamlParser) peek() *yamlLine {
+	for {
+		line := parser.peekRaw()
+		if line == nil || line.content != "" {
+			return line
+		}
+		parser.consume()
+	}
+}
+
+func (parser *yamlParser) consume() {
+	if parser.lookAhead != nil {
+		parser.current = parser.lookAhead.location
+	}
+	parser.lookAhead = nil
+}
+
+func (parser *yamlParser) parseStream(next Next) error {
+	context := parser.context
+	for {
+		line := parser.peek()
+		switch {
+		case line == nil:
+			return nil
+		case line.indent == 0 && strings.HasPrefix(line.content, "%"):
+			Verbose(context, "Ignoring YAML directive '%s'", line.content)
+			parser.consume()
+		case line.isMarker(YAML_END_DOCUMENT):
+			parser.consume()
+		case line.isMarker(YAML_START_DOCUMENT):
+			parser.consume()
+			rest := strings.TrimSpace(line.content[len(YAML_START_DOCUMENT):])
+			if rest != "" {
+				parser.lookAhead = &yamlLine{rest, 0, rest, line.location}
+			}
+		default:
+			value := parser.parseBlock(0)
+			for {
+				line := parser.peek()
+				if line == nil || line.isDocumentMarker() {
+					break
+				}
+				ErrorAt(context, line.location, "Unexpected content '%s'", line.content)
+				parser.consume()
+			}
+			err := next(value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Parses a node whose lines are indented by at least 'minIndent' spaces, a missing node is null.
+func (parser *yamlParser) parseBlock(minIndent int) Value {
+	line := parser.peek()
+	if line == nil || line.indent < minIndent || line.isDocumentMarker() {
+		return tuple.NULL
+	}
+	location := line.location
+	var value Value
+	switch {
+	case isYamlSequenceItem(line.content):
+		value = parser.parseSequence(line.indent)
+	case isYamlBlockScalar(line.content):
+		parser.consume()
+		value = parser.parseBlockScalar(line.content, minIndent - 1)
+	case yamlMappingColon(line.content) >= 0:
+		value = parser.parseMapping(line.indent)
+	default:
+		parser.consume()
+		value = parser.parseInline(line.content)
+	}
+	parser.context.Locations().Add(value, location)
+	return value
+}
+
+func (parser *yamlParser) parseSequence(indent int) Value {
+	result := NewTuple()
+	for {
+		line := parser.peek()
+		if line == nil || line.indent < indent || line.isDocumentMarker() {
+			break
+		}
+		if line.indent > indent {
+			ErrorAt(parser.context, line.location, "Unexpected indentation '%s'", line.content)
+			parser.consume()
+			continue
+		}
+		if ! isYamlSequenceItem(line.content) {
+			break
+		}
+		rest := strings.TrimLeft(line.content[1:], " ")
+		if rest == "" {
+			parser.consume()
+		} else {
+			// Compact notation: the item starts on the same line as the '-'
+			// so treat the remainder as if it were on a line of its own.
+			line.indent += len(line.content) - len(rest)
+			line.content = rest
+		}
+		result.Append(parser.parseBlock(indent + 1))
+	}
+	return result
+}
+
+func (parser *yamlParser) parseMapping(indent int) Value {
+	mapp := tuple.NewTagValueMap()
+	for {
+		line := parser.peek()
+		if line == nil || line.indent < indent || line.isDocumentMarker() {
+			break
+		}
+		if line.indent > indent {
+			ErrorAt(parser.context, line.location, "Unexpected indentation '%s'", line.content)
+			parser.consume()
+			continue
+		}
+		colon := yamlMappingColon(line.content)
+		if colon < 0 {
+			break
+		}
+		parser.consume()
+		key := parser.parseKey(strings.TrimSpace(line.content[:colon]))
+		rest := strings.TrimSpace(line.content[colon+1:])
+		var value Value
+		switch {
+		case rest == "":
+			// A sequence is allowed at the same indentation as its key
+			next := parser.peek()
+			if next != nil && next.indent == indent && isYamlSequenceItem(next.content) {
+				value = parser.parseSequence(indent)
+			} else {
+				value = parser.parseBlock(indent + 1)
+			}
+		case isYamlBlockScalar(rest):
+			value = parser.parseBlockScalar(rest, indent)
+		default:
+			value = parser.parseInline(rest)
+		}
+		mapp.Add(key, value)
+	}
+	return mapp
+}
+
+func (parser *yamlParser) parseKey(text string) Tag {
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		flow := yamlFlow{parser.context, text, 0, parser.current}
+		return Tag{flow.readQuoted()}
+	}
+	return Tag{text}
+}
+
+// Parses a flow collection or scalar, flow collections may continue over several lines.
+func (parser *yamlParser) parseInline(text string) Value {
+	location := parser.current
+	if strings.HasPrefix(text, OPEN_SQUARE_BRACKET) || strings.HasPrefix(text, OPEN_BRACE) {
+		for ! yamlBalanced(text) {
+			line := parser.peek()
+			if line == nil || line.isDocumentMarker() {
+				break
+			}
+			parser.consume()
+			text = text + " " + line.content
+		}
+	}
+	flow := yamlFlow{parser.context, text, 0, location}
+	value := flow.parseValue(false)
+	flow.skipSpace()
+	if flow.pos < len(text) {
+		ErrorAt(parser.context, location, "Unexpected '%s'", text[flow.pos:])
+	}
+	return value
+}
+
+// Parses a literal '|' or folded '>' block scalar.
+func (parser *yamlParser) parseBlockScalar(header string, parentIndent int) Value {
+	literal := header[0] == '|'
+	chomp := ' '
+	indent := -1
+	for _, ch := range header[1:] {
+		switch {
+		case ch == '-' || ch == '+': chomp = ch
+		case ch >= '1' && ch <= '9':
+			if parentIndent < 0 {
+				indent = int(ch - '0')
+			} else {
+				indent = parentIndent + int(ch - '0')
+			}
+		case ch == ' ':
+		default:
+			ErrorAt(parser.context, parser.current, "Unexpected '%s' in block scalar header", string(ch))
+		}
+	}
+
+	lines := make([]string, 0)
+	for {
+		line := parser.peekRaw()
+		if line == nil || line.isDocumentMarker() {
+			break
+		}
+		if strings.TrimSpace(line.text) == "" {
+			lines = append(lines, "")
+			parser.consume()
+			continue
+		}
+		if indent < 0 {
+			if line.indent <= parentIndent {
+				break
+			}
+			indent = line.indent
+		}
+		if line.indent < indent {
+			break
+		}
+		lines = append(lines, line.text[indent:])
+		parser.consume()
+	}
+
+	trailing := 0
+	for trailing < len(lines) && lines[len(lines)-1-trailing] == "" {
+		trailing += 1
+	}
+	body := lines[:len(lines)-trailing]
+
+	var builder strings.Builder
+	for k, line := range body {
+		switch {
+		case k == 0:
+		case literal || line == "": builder.WriteString("\n")
+		case body[k-1] != "": builder.WriteString(" ")
+		}
+		builder.WriteString(line)
+	}
+	if len(body) > 0 {
+		switch chomp {
+		case '-':
+		case '+': builder.WriteString(strings.Repeat("\n", trailing + 1))
+		default: builder.WriteString("\n")
+		}
+	}
+	return String(builder.String())
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Flow collections and scalars
+/////////////////////////////////////////////////////////////////////////////
+
+type yamlFlow struct {
+	context Context
+	text string
+	pos int
+	location Location // Of the line the text starts on
+}
+
+func (flow *yamlFlow) skipSpace() {
+	for flow.pos < len(flow.text) && (flow.text[flow.pos] == ' ' || flow.text[flow.pos] == '\t') {
+		flow.pos += 1
+	}
+}
+
+func (flow *yamlFlow) atEnd() bool {
+	return flow.pos >= len(flow.text)
+}
+
+func (flow *yamlFlow) parseValue(inFlow bool) Value {
+	flow.skipSpace()
+	if flow.atEnd() {
+		return tuple.NULL
+	}
+	switch flow.text[flow.pos] {
+	case '[': return flow.parseSequence()
+	case '{': return flow.parseMapping()
+	case '"', '\'': return String(flow.readQuoted())
+	default: return yamlScalar(flow.readPlain(inFlow))
+	}
+}
+
+func (flow *yamlFlow) parseSequence() Value {
+	flow.pos += 1
+	result := NewTuple()
+	for {
+		flow.skipSpace()
+		if flow.atEnd() {
+			ErrorAt(flow.context, flow.location, "Missing close bracket '%s'", CLOSE_SQUARE_BRACKET)
+			return result
+		}
+		if flow.text[flow.pos] == ']' {
+			flow.pos += 1
+			return result
+		}
+		result.Append(flow.parseValue(true))
+		if ! flow.separator(']') {
+			return result
+		}
+	}
+}
+
+func (flow *yamlFlow) parseMapping() Value {
+	flow.pos += 1
+	mapp := tuple.NewTagValueMap()
+	for {
+		flow.skipSpace()
+		if flow.atEnd() {
+			ErrorAt(flow.context, flow.location, "Missing close brace '%s'", CLOSE_BRACE)
+			return mapp
+		}
+		if flow.text[flow.pos] == '}' {
+			flow.pos += 1
+			return mapp
+		}
+		var key string
+		if ch := flow.text[flow.pos]; ch == '"' || ch == '\'' {
+			key = flow.readQuoted()
+		} else {
+			key = flow.readPlain(true)
+		}
+		flow.skipSpace()
+		var value Value = tuple.NULL
+		if ! flow.atEnd() && flow.text[flow.pos] == ':' {
+			flow.pos += 1
+			value = flow.parseValue(true)
+		}
+		mapp.Add(Tag{key}, value)
+		if ! flow.separator('}') {
+			return mapp
+		}
+	}
+}
+
+// Skips a ',' between entries of a flow collection, returns false if neither a ',' nor the close was found.
+func (flow *yamlFlow) separator(close byte) bool {
+	flow.skipSpace()
+	switch {
+	case flow.atEnd(): return true  // Reported as a missing close
+	case flow.text[flow.pos] == ',':
+		flow.pos += 1
+		return true
+	case flow.text[flow.pos] == close:
+		return true
+	default:
+		ErrorAt(flow.context, flow.location, "Expected ',' or '%s' but found '%s'", string(close), flow.text[flow.pos:])
+		flow.pos = len(flow.text)
+		return false
+	}
+}
+
+func (flow *yamlFlow) readPlain(inFlow bool) string {
+	start := flow.pos
+	for ; flow.pos < len(flow.text); flow.pos += 1 {
+		ch := flow.text[flow.pos]
+		if inFlow && strings.IndexByte(",[]{}", ch) >= 0 {
+			break
+		}
+		if ch == ':' {
+			if flow.pos + 1 == len(flow.text) {
+				break
+			}
+			following := flow.text[flow.pos + 1]
+			if following == ' ' || following == '\t' || (inFlow && strings.IndexByte(",[]{}", following) >= 0) {
+				break
+			}
+		}
+	}
+	return strings.TrimSpace(flow.text[start:flow.pos])
+}
+
+func (flow *yamlFlow) readQuoted() string {
+	start := flow.pos
+	end := yamlClosingQuote(flow.text, start)
+	if end < 0 {
+		ErrorAt(flow.context, flow.location, "Missing close quote: '%s'", flow.text[start:start+1])
+		flow.pos = len(flow.text)
+		return flow.text[start+1:]
+	}
+	flow.pos = end + 1
+	quoted := flow.text[start:end+1]
+	if quoted[0] == '\'' {
+		return strings.Replace(quoted[1:len(quoted)-1], "''", "'", -1)
+	}
+	str, err := strconv.Unquote(quoted)
+	if err != nil {
+		ErrorAt(flow.context, flow.location, "Got '%s' err= %s", quoted, err)
+		return quoted[1:len(quoted)-1]
+	}
+	return str
+}
+
+// Resolves a plain scalar using the YAML core schema.
+func yamlScalar(text string) Value {
+	switch text {
+	case "", "~", "null", "Null", "NULL": return tuple.NULL
+	case "true", "True", "TRUE": return Bool(true)
+	case "false", "False", "FALSE": return Bool(false)
+	case ".nan", ".NaN", ".NAN", "NaN": return Float64(math.NaN())
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF", "Inf": return Float64(math.Inf(1))
+	case "-.inf", "-.Inf", "-.INF", "-Inf": return Float64(math.Inf(-1))
+	}
+	switch {
+	case integerPattern.MatchString(text):
+		if value, ok := tuple.IntegerFromString(text, 10); ok {
+			return value
+		}
+	case yamlHexPattern.MatchString(text):
+		if value, err := strconv.ParseInt(text[2:], 16, 64); err == nil {
+			return Int64(value)
+		}
+	case yamlOctalPattern.MatchString(text):
+		if value, err := strconv.ParseInt(text[2:], 8, 64); err == nil {
+			return Int64(value)
+		}
+	case floatPattern.MatchString(text):
+		if value, ok := tuple.FloatFromString(text); ok {
+			return value
+		}
+	}
+	return String(text)
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+func isYamlSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+func isYamlBlockScalar(content string) bool {
+	return strings.HasPrefix(content, "|") || strings.HasPrefix(content, ">")
+}
+
+// Returns the index of the ':' separating a key from its value or -1 if the line is not a mapping entry.
+func yamlMappingColon(content string) int {
+	if content == "" || content[0] == '[' || content[0] == '{' {
+		return -1
+	}
+	start := 0
+	if content[0] == '"' || content[0] == '\'' {
+		end := yamlClosingQuote(content, 0)
+		if end < 0 {
+			return -1
+		}
+		start = end + 1
+	}
+	for k := start; k < len(content); k += 1 {
+		if content[k] == ':' && (k+1 == len(content) || content[k+1] == ' ' || content[k+1] == '\t') {
+			return k
+		}
+	}
+	return -1
+}
+
+// Returns the index of the quote that closes the quoted string starting at 'start' or -1.
+func yamlClosingQuote(text string, start int) int {
+	quote := text[start]
+	for k := start + 1; k < len(text); k += 1 {
+		switch {
+		case quote == '"' && text[k] == '\\':
+			k += 1
+		case quote == '\'' && text[k] == '\'' && k+1 < len(text) && text[k+1] == '\'':
+			k += 1
+		case text[k] == quote:
+			return k
+		}
+	}
+	return -1
+}
+
+// A quote only starts a quoted string at the beginning of a scalar, so an apostrophe such as in "don't" is not a quote.
+func yamlStartsScalar(text string, k int) bool {
+	return k == 0 || strings.IndexByte(" \t:-,[{", text[k-1]) >= 0
+}
+
+func yamlStripComment(text string) string {
+	for k := 0; k < len(text); k += 1 {
+		switch ch := text[k]; {
+		case (ch == '"' || ch == '\'') && yamlStartsScalar(text, k):
+			end := yamlClosingQuote(text, k)
+			if end < 0 {
+				return text
+			}
+			k = end
+		case ch == '#' && (k == 0 || text[k-1] == ' ' || text[k-1] == '\t'):
+			return text[:k]
+		}
+	}
+	return text
+}
+
+// Returns true if all the brackets and braces in a flow collection have been closed.
+func yamlBalanced(text string) bool {
+	depth := 0
+	for k := 0; k < len(text); k += 1 {
+		switch ch := text[k]; {
+		case (ch == '"' || ch == '\'') && yamlStartsScalar(text, k):
+			end := yamlClosingQuote(text, k)
+			if end < 0 {
+				return true
+			}
+			k = end
+		case ch == '[' || ch == '{': depth += 1
+		case ch == ']' || ch == '}': depth -= 1
+		}
+	}
+	return depth <= 0
+}
@@ -0,0 +1,174 @@
+package parsers_test
+
+import (
+	"testing"
+	"tuple"
+	"tuple/parsers"
+	"reflect"
+	"strings"
+)
+
+func TestYamlParse(t *testing.T) {
+	var grammar = parsers.NewYamlGrammar()
+
+	test := func(yaml string, expected tuple.Value) {
+		val, err := parsers.ParseString(logger, grammar, yaml)
+		if err != nil {
+			t.Errorf("Given '%s' expected '%s' got error '%s'", yaml, expected, err)
+		}
+		if ! reflect.DeepEqual(val, expected) {
+			t.Errorf("Given '%s' expected '%s' got '%s'", yaml, expected, val)
+		}
+	}
+
+	t01 := tuple.NewTuple(zero, one)
+
+	test("1", one)
+	test("1.5", tuple.Float64(1.5))
+	test("true", tuple.Bool(true))
+	test("abc", tuple.String("abc"))
+	test("~", tuple.NULL)
+	test("[0, null]", tuple.NewTuple(zero, tuple.NULL))
+	test("\"a\\tb\"", tuple.String("a\tb"))
+	test("'it''s'", tuple.String("it's"))
+	test("[0, 1]", t01)
+	test("[0,\n 1]", t01)
+	test("- 0\n- 1\n", t01)
+	test("- 0 # comment\n\n- 1\n", t01)
+	test("- - 0\n  - 1\n", tuple.NewTuple(t01))
+
+	mmap := tuple.NewTagValueMap()
+	mmap.Add(Tag{"a"}, one)
+	test("a: 1", mmap)
+	test("{a: 1}", mmap)
+	test("{\"a\": 1}", mmap)
+	test("\"a\": 1", mmap)
+	test("---\na: 1\n...\n", mmap)
+	mmap.Add(Tag{"b"}, t01)
+	test("a: 1\nb: [0, 1]\n", mmap)
+	test("a: 1\nb:\n  - 0\n  - 1\n", mmap)
+	test("a: 1\nb:\n- 0\n- 1\n", mmap)
+	test("- a: 1\n  b: [0, 1]\n", tuple.NewTuple(mmap))
+
+	// A key or item without a value is null
+	empty := tuple.NewTagValueMap()
+	empty.Add(Tag{"a"}, tuple.NULL)
+	empty.Add(Tag{"b"}, one)
+	test("a:\nb: 1\n", empty)
+	test("{a, b: 1}", empty)
+	test("{a:, b: 1}", empty)
+	test("-\n- 1\n", tuple.NewTuple(tuple.NULL, one))
+
+	text := tuple.NewTagValueMap()
+	text.Add(Tag{"text"}, tuple.String("line1\nline2\n"))
+	test("text: |\n  line1\n  line2\n", text)
+	text.Add(Tag{"text"}, tuple.String("line1 line2\nline3"))
+	test("text: >-\n  line1\n  line2\n\n  line3\n", text)
+}
+
+func TestYamlDocuments(t *testing.T) {
+	var grammar = parsers.NewYamlGrammar()
+
+	count := 0
+	_, err := parsers.RunParser(grammar, "--- 1\n---\na: 1\n...\n---\n- 1\n", logger, func(value tuple.Value) error {
+		count += 1
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Errorf("Expected 3 documents got %d err=%s", count, err)
+	}
+}
+
+func TestYamlRoundTrip(t *testing.T) {
+	var grammar = parsers.NewYamlGrammar()
+
+	test := func(yaml string) {
+		val, err := parsers.ParseString(logger, grammar, yaml)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", yaml, err)
+		}
+		printed := ""
+		grammar.Print(val, func(value string) {
+			printed += value
+		})
+		reparsed, err := parsers.ParseString(logger, grammar, printed)
+		if err != nil {
+			t.Errorf("Given '%s' printed '%s' got error '%s'", yaml, printed, err)
+		}
+		if ! reflect.DeepEqual(val, reparsed) {
+			t.Errorf("Given '%s' printed '%s' expected '%s' got '%s'", yaml, printed, val, reparsed)
+		}
+	}
+
+	test("1")
+	test("abc")
+	test("\"a\\nb\\tc\"")
+	test("[]")
+	test("{}")
+	test("[0, 1, [2, 3], {a: b}]")
+	test("a: 1\nb:\n  c: [1, 2.5, true]\n  d: \"x\"\ne: []\n")
+	test("- a: 1\n  b: 2\n- - 3\n  - 4\n")
+	test("text: |\n  line1\n  line2\n")
+	test("a: ~\nb: []\n")
+	test("- - 1\n  - - 2\n    - []\n- {a: [3]}\n")
+
+	// A tuple with a tag at its head is printed as a sequence so it is still a tuple when read back
+	lisp, err := parsers.ParseString(logger, NewLispGrammar(), "(abc 1 (+ 2 (g 4)) ())")
+	if err != nil {
+		t.Errorf("Got error '%s'", err)
+	}
+	printed := ""
+	grammar.Print(lisp, func(value string) {
+		printed += value
+	})
+	reparsed, err := parsers.ParseString(logger, grammar, printed)
+	expected := tuple.NewTuple(tuple.String("abc"), one, tuple.NewTuple(tuple.String("+"), tuple.Int64(2), tuple.NewTuple(tuple.String("g"), tuple.Int64(4))), tuple.NewTuple())
+	if err != nil || ! reflect.DeepEqual(reparsed, expected) {
+		t.Errorf("Given '%s' printed '%s' expected '%s' got '%s' %v", lisp, printed, expected, reparsed, err)
+	}
+}
+
+func TestYamlToJson(t *testing.T) {
+	var grammar = parsers.NewYamlGrammar()
+	json := parsers.NewJSONGrammar()
+
+	test := func(yaml string, expected string) {
+		val, err := parsers.ParseString(logger, grammar, yaml)
+		if err != nil {
+			t.Errorf("Given '%s' got error '%s'", yaml, err)
+		}
+		printed := ""
+		json.Print(val, func(value string) {
+			printed += value
+		})
+		if strings.Join(strings.Fields(printed), "") != expected {
+			t.Errorf("Given '%s' expected '%s' got '%s'", yaml, expected, printed)
+		}
+	}
+
+	test("a:\nb: 1\n", `{"a":null,"b":1}`)
+	test("a:\n  b:\n", `{"a":{"b":null}}`)
+	test("- \n- []\n", `[null,[]]`)
+}
+
+func TestYamlErrorLocations(t *testing.T) {
+	var grammar = parsers.NewYamlGrammar()
+
+	test := func(yaml string, line int64) {
+		lines := []int64{}
+		logger := func (location tuple.Location, level string, message string) {
+			if level == "ERROR" {
+				lines = append(lines, location.Line())
+			}
+		}
+		parsers.ParseString(logger, grammar, yaml)
+		if len(lines) != 1 || lines[0] != line {
+			t.Errorf("Given '%s' expected an error on line %d got %v", yaml, line, lines)
+		}
+	}
+
+	test("a: 1\nb: 2\nc: [1, 2\n", 3)
+	test("a: 1\nb:\n    x: 1\n  y: 2\n", 4)
+	test("a: 1\n\nb: {x: 1} z\n", 3)
+	test("- 0\n- 1\n  - 2\n", 3)
+}
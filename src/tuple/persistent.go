@@ -0,0 +1,388 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package tuple
+
+import "math/bits"
+
+/////////////////////////////////////////////////////////////////////////////
+//  Persistent collections
+/////////////////////////////////////////////////////////////////////////////
+
+// Vectors and maps are never changed once made, adding to one makes a new one that shares
+// all but the path to the change with the old, so values can be shared by scopes and goroutines.
+//
+// See:
+// * [Persistent data structure](https://en.wikipedia.org/wiki/Persistent_data_structure)
+// * [Hash array mapped trie](https://en.wikipedia.org/wiki/Hash_array_mapped_trie)
+
+const trieBits = 5
+const trieWidth = 1 << trieBits
+const trieMask = trieWidth - 1
+
+// An implementation of the Array interface as a trie of 32 way nodes. The last elements are
+// kept in a tail outside the trie so appending is usually just copying the tail.
+type Vector struct {
+	count int
+	shift uint
+	root *vectorNode
+	tail []Value
+}
+
+type vectorNode struct {
+	children []*vectorNode  // Of a branch
+	values []Value  // Of a leaf
+}
+
+var emptyVectorNode = &vectorNode{}
+
+func NewVector(values... Value) Vector {
+	vector := Vector{shift: trieBits, root: emptyVectorNode}
+	for len(values) - vector.count > trieWidth {
+		vector.tail = append([]Value{}, values[vector.count:vector.count + trieWidth]...)
+		vector.count += trieWidth
+		vector = vector.pushTail()
+	}
+	vector.tail = append([]Value{}, values[vector.count:]...)
+	vector.count = len(values)
+	return vector
+}
+
+func (vector Vector) Arity() int { return vector.count }
+
+func (vector Vector) Get(index int) Value {
+	if index < 0 || index >= vector.count {
+		return NULL
+	}
+	return vector.leafOf(index)[index & trieMask]
+}
+
+func (vector Vector) GetKeyValue(index int) (Tag, Value) {
+	return IntToTag(index), vector.Get(index)
+}
+
+func (vector Vector) ForallValues(next func(value Value) error) error {
+	for start := 0; start < vector.count; start += trieWidth {
+		for _, value := range vector.leafOf(start) {
+			if err := next(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The elements in a new slice.
+func (vector Vector) Values() []Value {
+	result := make([]Value, 0, vector.count)
+	vector.ForallValues(func (value Value) error {
+		result = append(result, value)
+		return nil
+	})
+	return result
+}
+
+func (vector Vector) tailOffset() int {
+	return vector.count - len(vector.tail)
+}
+
+// The leaf or tail holding the element at an index.
+func (vector Vector) leafOf(index int) []Value {
+	if index >= vector.tailOffset() {
+		return vector.tail
+	}
+	node := vector.root
+	for level := vector.shift; level > 0; level -= trieBits {
+		node = node.children[(index >> level) & trieMask]
+	}
+	return node.values
+}
+
+// A new vector with a value added at the end.
+func (vector Vector) Push(value Value) Vector {
+	AssertNotNil(value)
+	if len(vector.tail) == trieWidth {
+		vector = vector.pushTail()
+	}
+	tail := make([]Value, len(vector.tail), len(vector.tail) + 1)
+	copy(tail, vector.tail)
+	vector.tail = append(tail, value)
+	vector.count += 1
+	return vector
+}
+
+// Moves a full tail into the trie, adding a level when the root is full.
+func (vector Vector) pushTail() Vector {
+	leaf := &vectorNode{values: vector.tail}
+	if (vector.tailOffset() >> trieBits) >= 1 << vector.shift {
+		vector.root = &vectorNode{children: []*vectorNode{vector.root, newVectorPath(vector.shift, leaf)}}
+		vector.shift += trieBits
+	} else {
+		vector.root = vector.pushLeaf(vector.shift, vector.root, leaf)
+	}
+	vector.tail = []Value{}
+	return vector
+}
+
+func (vector Vector) pushLeaf(level uint, parent *vectorNode, leaf *vectorNode) *vectorNode {
+	index := (vector.tailOffset() >> level) & trieMask
+	children := append([]*vectorNode{}, parent.children...)
+	var child *vectorNode
+	switch {
+	case level == trieBits: child = leaf
+	case index < len(children): child = vector.pushLeaf(level - trieBits, children[index], leaf)
+	default: child = newVectorPath(level - trieBits, leaf)
+	}
+	if index < len(children) {
+		children[index] = child
+	} else {
+		children = append(children, child)
+	}
+	return &vectorNode{children: children}
+}
+
+func newVectorPath(level uint, leaf *vectorNode) *vectorNode {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode{children: []*vectorNode{newVectorPath(level - trieBits, leaf)}}
+}
+
+// A new vector with the value at an index replaced, an index out of range is ignored.
+func (vector Vector) Update(index int, value Value) Vector {
+	AssertNotNil(value)
+	if index < 0 || index >= vector.count {
+		return vector
+	}
+	if index >= vector.tailOffset() {
+		vector.tail = append([]Value{}, vector.tail...)
+		vector.tail[index - vector.tailOffset()] = value
+		return vector
+	}
+	vector.root = updateVectorNode(vector.shift, vector.root, index, value)
+	return vector
+}
+
+func updateVectorNode(level uint, node *vectorNode, index int, value Value) *vectorNode {
+	if level == 0 {
+		values := append([]Value{}, node.values...)
+		values[index & trieMask] = value
+		return &vectorNode{values: values}
+	}
+	children := append([]*vectorNode{}, node.children...)
+	k := (index >> level) & trieMask
+	children[k] = updateVectorNode(level - trieBits, children[k], index, value)
+	return &vectorNode{children: children}
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// An implementation of the Map interface as a hash array mapped trie. As for a TagValueMap
+// keys are kept in the order they were first added, each entry knows its position in the keys
+// so a removed key is replaced by NULL there, the keys are compacted once most are removed.
+type HashMap struct {
+	root *hashNode
+	keys Vector
+	count int
+}
+
+// A node has a slot for each bit set in its bitmap, a slot holds an entry or a node one level down.
+// Below the last level the hash is used up and keys with the same hash are kept in a list.
+type hashNode struct {
+	bitmap uint32
+	slots []hashSlot
+}
+
+type hashSlot struct {
+	key Tag
+	value Value
+	index int  // Of the key in the keys
+	node *hashNode
+}
+
+var emptyHashNode = &hashNode{}
+
+func NewHashMap() HashMap {
+	return HashMap{emptyHashNode, NewVector(), 0}
+}
+
+// FNV-1a
+func hashOf(key Tag) uint32 {
+	hash := uint32(2166136261)
+	for k := 0; k < len(key.Name); k += 1 {
+		hash ^= uint32(key.Name[k])
+		hash *= 16777619
+	}
+	return hash
+}
+
+func (mapp HashMap) Arity() int { return mapp.count }
+
+func (mapp HashMap) Get(key Tag) (Value, bool) {
+	hash := hashOf(key)
+	node := mapp.root
+	for shift := uint(0); ; shift += trieBits {
+		if shift >= 32 {
+			for _, slot := range node.slots {
+				if slot.key == key {
+					return slot.value, true
+				}
+			}
+			return nil, false
+		}
+		bit := uint32(1) << ((hash >> shift) & trieMask)
+		if node.bitmap & bit == 0 {
+			return nil, false
+		}
+		slot := node.slots[bits.OnesCount32(node.bitmap & (bit - 1))]
+		if slot.node == nil {
+			if slot.key == key {
+				return slot.value, true
+			}
+			return nil, false
+		}
+		node = slot.node
+	}
+}
+
+func (mapp HashMap) ForallKeyValue(next KeyValueFunction) {
+	mapp.keys.ForallValues(func (key Value) error {
+		if key, ok := key.(Tag); ok {
+			value, _ := mapp.Get(key)
+			next(key, value)
+		}
+		return nil
+	})
+}
+
+func (mapp HashMap) ForallValues(next func(value Value) error) error {
+	return mapp.keys.ForallValues(func (key Value) error {
+		if key, ok := key.(Tag); ok {
+			value, _ := mapp.Get(key)
+			return next(value)
+		}
+		return nil
+	})
+}
+
+// A new map with the value of a key, replacing the value of an existing key keeps its position.
+func (mapp HashMap) Put(key Tag, value Value) HashMap {
+	AssertNotNil(value)
+	root, added := putHashNode(mapp.root, 0, hashOf(key), hashSlot{key: key, value: value, index: mapp.keys.Arity()})
+	mapp.root = root
+	if added {
+		mapp.keys = mapp.keys.Push(key)
+		mapp.count += 1
+	}
+	return mapp
+}
+
+// An entry replacing one with the same key takes its index.
+func putHashNode(node *hashNode, shift uint, hash uint32, entry hashSlot) (*hashNode, bool) {
+	if shift >= 32 {
+		for k, slot := range node.slots {
+			if slot.key == entry.key {
+				entry.index = slot.index
+				return node.withSlot(k, entry), false
+			}
+		}
+		return &hashNode{slots: append(append([]hashSlot{}, node.slots...), entry)}, true
+	}
+	bit := uint32(1) << ((hash >> shift) & trieMask)
+	k := bits.OnesCount32(node.bitmap & (bit - 1))
+	if node.bitmap & bit == 0 {
+		slots := make([]hashSlot, 0, len(node.slots) + 1)
+		slots = append(append(append(slots, node.slots[:k]...), entry), node.slots[k:]...)
+		return &hashNode{node.bitmap | bit, slots}, true
+	}
+	slot := node.slots[k]
+	switch {
+	case slot.node != nil:
+		child, added := putHashNode(slot.node, shift + trieBits, hash, entry)
+		return node.withSlot(k, hashSlot{node: child}), added
+	case slot.key == entry.key:
+		entry.index = slot.index
+		return node.withSlot(k, entry), false
+	}
+	child, _ := putHashNode(emptyHashNode, shift + trieBits, hashOf(slot.key), slot)
+	child, _ = putHashNode(child, shift + trieBits, hash, entry)
+	return node.withSlot(k, hashSlot{node: child}), true
+}
+
+func (node *hashNode) withSlot(k int, slot hashSlot) *hashNode {
+	slots := append([]hashSlot{}, node.slots...)
+	slots[k] = slot
+	return &hashNode{node.bitmap, slots}
+}
+
+// A new map without a key. Its position in the keys is cleared, once more than half of the
+// positions are cleared the map is rebuilt so removing takes amortised logarithmic time.
+func (mapp HashMap) Remove(key Tag) HashMap {
+	root, index, removed := removeHashNode(mapp.root, 0, hashOf(key), key)
+	if ! removed {
+		return mapp
+	}
+	mapp = HashMap{root, mapp.keys.Update(index, NULL), mapp.count - 1}
+	if mapp.keys.Arity() > 2 * mapp.count + trieWidth {
+		compact := NewHashMap()
+		mapp.ForallKeyValue(func (key Tag, value Value) {
+			compact = compact.Put(key, value)
+		})
+		return compact
+	}
+	return mapp
+}
+
+// Also returns the index of the removed key.
+func removeHashNode(node *hashNode, shift uint, hash uint32, key Tag) (*hashNode, int, bool) {
+	if shift >= 32 {
+		for k, slot := range node.slots {
+			if slot.key == key {
+				return &hashNode{slots: append(append([]hashSlot{}, node.slots[:k]...), node.slots[k + 1:]...)}, slot.index, true
+			}
+		}
+		return node, 0, false
+	}
+	bit := uint32(1) << ((hash >> shift) & trieMask)
+	if node.bitmap & bit == 0 {
+		return node, 0, false
+	}
+	k := bits.OnesCount32(node.bitmap & (bit - 1))
+	slot := node.slots[k]
+	index := slot.index
+	if slot.node != nil {
+		child, childIndex, removed := removeHashNode(slot.node, shift + trieBits, hash, key)
+		if ! removed || len(child.slots) > 0 {
+			return node.withSlot(k, hashSlot{node: child}), childIndex, removed
+		}
+		index = childIndex
+	} else if slot.key != key {
+		return node, 0, false
+	}
+	slots := append(append([]hashSlot{}, node.slots[:k]...), node.slots[k + 1:]...)
+	return &hashNode{node.bitmap &^ bit, slots}, index, true
+}
+
+/////////////////////////////////////////////////////////////////////////////
+
+// The elements of a tuple or vector as a tuple, printers and parsers deal in tuples.
+func AsTuple(value Value) (Tuple, bool) {
+	switch value := value.(type) {
+	case Tuple: return value, true
+	case Vector: return NewTuple(value.Values()...), true
+	}
+	return Tuple{}, false
+}
@@ -0,0 +1,144 @@
+package tuple_test
+
+import (
+	"testing"
+	"tuple"
+	"fmt"
+	"sync"
+)
+
+func TestVector(t *testing.T) {
+
+	var array tuple.Array = tuple.NewVector()
+	if array.Arity() != 0 {
+		t.Errorf("Expected an empty vector got %d", array.Arity())
+	}
+
+	// Enough elements for a trie three levels deep
+	count := 40000
+	values := []tuple.Value{}
+	vector := tuple.NewVector()
+	for k := 0; k < count; k += 1 {
+		values = append(values, tuple.Int64(k))
+		vector = vector.Push(tuple.Int64(k))
+	}
+	built := tuple.NewVector(values...)
+	for _, k := range []int{0, 31, 32, 33, 1023, 1024, 1056, 32767, 32768, count - 1} {
+		if vector.Get(k) != tuple.Int64(k) || built.Get(k) != tuple.Int64(k) {
+			t.Errorf("Expected %d got %v and %v", k, vector.Get(k), built.Get(k))
+		}
+	}
+	if vector.Get(count) != tuple.NULL || vector.Get(-1) != tuple.NULL {
+		t.Errorf("Expected no element out of range")
+	}
+	k := 0
+	built.ForallValues(func (value tuple.Value) error {
+		if value != tuple.Int64(k) {
+			t.Errorf("Expected %d got %v", k, value)
+		}
+		k += 1
+		return nil
+	})
+	if k != count || len(vector.Values()) != count {
+		t.Errorf("Expected %d values got %d", count, k)
+	}
+
+	// Old versions are unchanged by updates
+	values[5] = tuple.String("changed")
+	updated := vector.Update(5, tuple.String("five")).Update(count - 1, tuple.String("last"))
+	pushed := updated.Push(tuple.String("more"))
+	if vector.Get(5) != tuple.Int64(5) || built.Get(5) != tuple.Int64(5) || vector.Get(count - 1) != tuple.Int64(count - 1) || vector.Arity() != count {
+		t.Errorf("Expected the original vector to be unchanged")
+	}
+	if updated.Get(5) != tuple.String("five") || updated.Get(count - 1) != tuple.String("last") || pushed.Get(count) != tuple.String("more") {
+		t.Errorf("Expected the updates got %v %v %v", updated.Get(5), updated.Get(count - 1), pushed.Get(count))
+	}
+	small := tuple.NewVector(tuple.Int64(1))
+	aa, bb := small.Push(tuple.Int64(2)), small.Push(tuple.Int64(3))
+	if aa.Get(1) != tuple.Int64(2) || bb.Get(1) != tuple.Int64(3) || small.Arity() != 1 {
+		t.Errorf("Expected vectors pushed to from the same one not to share elements")
+	}
+}
+
+func TestHashMap(t *testing.T) {
+
+	var mapp tuple.Map = tuple.NewHashMap()
+	if mapp.Arity() != 0 {
+		t.Errorf("Expected an empty map got %d", mapp.Arity())
+	}
+
+	count := 5000
+	hashMap := tuple.NewHashMap()
+	for k := 0; k < count; k += 1 {
+		hashMap = hashMap.Put(tuple.Tag{fmt.Sprint("k", k)}, tuple.Int64(k))
+	}
+	replaced := hashMap.Put(tuple.Tag{"k7"}, tuple.String("seven"))
+	removed := replaced.Remove(tuple.Tag{"k3"}).Remove(tuple.Tag{"nosuch"})
+	if hashMap.Arity() != count || replaced.Arity() != count || removed.Arity() != count - 1 {
+		t.Errorf("Expected %d entries got %d %d %d", count, hashMap.Arity(), replaced.Arity(), removed.Arity())
+	}
+	for k := 0; k < count; k += 1 {
+		if value, ok := hashMap.Get(tuple.Tag{fmt.Sprint("k", k)}); ! ok || value != tuple.Int64(k) {
+			t.Errorf("Expected k%d to be %d got %v", k, k, value)
+		}
+	}
+	if value, _ := replaced.Get(tuple.Tag{"k7"}); value != tuple.String("seven") {
+		t.Errorf("Expected the value to be replaced got %v", value)
+	}
+	if _, ok := removed.Get(tuple.Tag{"k3"}); ok {
+		t.Errorf("Expected the key to be removed")
+	}
+	if value, _ := hashMap.Get(tuple.Tag{"k7"}); value != tuple.Int64(7) {
+		t.Errorf("Expected the original map to be unchanged got %v", value)
+	}
+
+	// Keys are in the order first added
+	keys := []string{}
+	removed.ForallKeyValue(func (key tuple.Tag, value tuple.Value) {
+		if len(keys) < 5 {
+			keys = append(keys, key.Name)
+		}
+	})
+	if fmt.Sprint(keys) != "[k0 k1 k2 k4 k5]" {
+		t.Errorf("Expected keys in order got %v", keys)
+	}
+
+	// Removing most keys compacts the map, a key added again goes last
+	for k := 0; k < count - 3; k += 1 {
+		removed = removed.Remove(tuple.Tag{fmt.Sprint("k", k)})
+	}
+	removed = removed.Put(tuple.Tag{"k1"}, tuple.Int64(1)).Put(tuple.Tag{"k4998"}, tuple.Int64(0))
+	keys = []string{}
+	removed.ForallKeyValue(func (key tuple.Tag, value tuple.Value) {
+		keys = append(keys, fmt.Sprint(key.Name, "=", value))
+	})
+	if fmt.Sprint(keys) != "[k4997=4997 k4998=0 k4999=4999 k1=1]" || removed.Arity() != 4 {
+		t.Errorf("Expected the remaining keys in order got %v", keys)
+	}
+	if value, _ := hashMap.Get(tuple.Tag{"k3"}); value != tuple.Int64(3) || hashMap.Arity() != count {
+		t.Errorf("Expected the original map to be unchanged got %v", value)
+	}
+}
+
+func TestSharedBetweenGoroutines(t *testing.T) {
+
+	vector := tuple.NewVector(tuple.Int64(0))
+	var group sync.WaitGroup
+	for k := 0; k < 8; k += 1 {
+		group.Add(1)
+		go func(k int) {
+			defer group.Done()
+			mine := vector
+			for j := 0; j < 1000; j += 1 {
+				mine = mine.Push(tuple.Int64(k))
+			}
+			if mine.Get(1000) != tuple.Int64(k) || mine.Arity() != 1001 {
+				t.Errorf("Expected %d got %v", k, mine.Get(1000))
+			}
+		}(k)
+	}
+	group.Wait()
+	if vector.Arity() != 1 {
+		t.Errorf("Expected the shared vector to be unchanged got %d", vector.Arity())
+	}
+}
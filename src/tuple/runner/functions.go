@@ -31,23 +31,6 @@ func first  t { nth 0 t }
 func second t { nth 1 t }
 func third  t { nth 2 t }
 
-# TODO  Flatten a nested structure
-func flatten a {
-   if (ismap a) {
-   	   for v a {
-               flatten v
-      	   }
-   } {
-     if ((arity a) == 0) {
-     	a
-     } {
-     	   for v a {
-               flatten v
-      	   }
-     }
-  }
-}
-
 #  TODO replace concat and join with a yield statement
 func print_sexp a {
    if (ismap a) {
@@ -97,8 +80,5 @@ func print_yaml a indent {
 
 
 `)
-
-	//func reduce f t { progn c=1 accumulator=first(t) (for v t { accumulator = f(accumulator v))  accumulator}
-
 }
 
@@ -26,20 +26,22 @@ import (
 
 func TestDeclareFunctions(t *testing.T) {
 
-	var safeEvalContext = runner.NewSafeEvalContext(logger)
 	grammar := parsers.NewShellGrammar()
-	runner.AddTranslatedSafeFunctions(safeEvalContext)
-	
-	test := func (formula string) {
-		val,err := runner.ParseAndEval(safeEvalContext, grammar, formula)
-		if val != tuple.Bool(true) {
-			t.Errorf("Expected '%s' to be TRUE, val=%s err=%s", formula, val, err)
+	for _, mode := range modes {
+		safeEvalContext := newSafeEvalContext(mode)
+		runner.AddTranslatedSafeFunctions(safeEvalContext)
+
+		test := func (formula string) {
+			val,err := runner.ParseAndEval(safeEvalContext, grammar, formula)
+			if val != tuple.Bool(true) {
+				t.Errorf("Expected '%s' in mode %d to be TRUE, val=%s err=%s", formula, mode, val, err)
+			}
 		}
-	}
 
-	test("eq 1 (first (1 2 3))")
-	test("eq 2 (second (1 2 3))")
-	test("eq 3 (third (1 2 3))")
+		test("eq 1 (first (1 2 3))")
+		test("eq 2 (second (1 2 3))")
+		test("eq 3 (third (1 2 3))")
+	}
 	// TODO test(`eq (print_sexp (1 2 3 (a:1 b:(abc 2 3 4 (1 () 2 3))))) "(1 2 3 (a.1 b.(abc 2 3 4 (1 () 2 3))))`)
 	// TODO test(`eq (print_sexp (1 2 3 (a:1 b:(abc 2 3 4 (1 () 2 3))))) "(1 2 3 (a:1 b:(abc 2 3 4 (1 () 2 3))))"`)
 	//...
@@ -17,6 +17,7 @@
 package runner
 
 import "tuple"
+import gocontext "context"
 import 	"strings"
 import "tuple/eval"
 import "tuple/parsers"
@@ -31,11 +32,13 @@ import "fmt"
 type Grammars struct {
 	All map[string]Grammar
 	defaultGrammar Grammar
+	locations tuple.Locations
+	cancellation gocontext.Context
 }
 
 // Returns a new empty set of grammars
 func NewGrammars(defaultGrammar Grammar) Grammars{
-	grammars := Grammars{make(map[string]Grammar),defaultGrammar}
+	grammars := Grammars{make(map[string]Grammar),defaultGrammar,tuple.NewLocations(),gocontext.Background()}
 	grammars.Add(defaultGrammar)
 	return grammars
 }
@@ -54,6 +57,16 @@ func  (grammars * Grammars) ForallValues(next func(value Value) error) error {
 	return nil
 }
 
+// Files are parsed recording the location of values in the given table, typically that of the evaluator.
+func (grammars * Grammars) SetLocations(locations tuple.Locations) {
+	grammars.locations = locations
+}
+
+// Parsing files stops when the cancellation is cancelled.
+func (grammars * Grammars) SetCancellation(cancellation gocontext.Context) {
+	grammars.cancellation = cancellation
+}
+
 func (grammars * Grammars) Default() Grammar {
 	return grammars.defaultGrammar
 }
@@ -91,6 +104,8 @@ func (grammars * Grammars)  RunFile(locationLogger LocationLogger, fileName stri
 	}
 	reader := bufio.NewReader(file)
 	context := NewParserContext(fileName, reader, locationLogger)
+	context.SetLocations(grammars.locations)
+	context.SetCancellation(grammars.cancellation)
 	err = grammar.Parse(&context, next)
 	file.Close()
 	return &context, err
@@ -99,9 +114,9 @@ func (grammars * Grammars)  RunFile(locationLogger LocationLogger, fileName stri
 func (grammars * Grammars) RunFiles(locationLogger LocationLogger, args []string, next Next) (int64) {
 	errors := int64(0)
 	if len(args) == 0 {
-		 context, err := RunParserOnStdin(locationLogger, grammars.Default(), next)
+		 context, err := RunParserOnStdin(grammars.cancellation, locationLogger, grammars.Default(), grammars.locations, next)
 		if err != nil {
-			location := tuple.NewLocation("<stdin>", 0, 0, 0)
+			location := errorLocation(err, tuple.NewLocation("<stdin>", 0, 0, 0))
 			locationLogger(location, "ERROR", fmt.Sprintf("%s", err))
 			errors += 1
 		}
@@ -110,17 +125,36 @@ func (grammars * Grammars) RunFiles(locationLogger LocationLogger, args []string
 		for _, fileName := range args {
 			context, err := grammars.RunFile(locationLogger, fileName, next)
 			if err != nil {
-				location := tuple.NewLocation(fileName, 0, 0, 0)
+				location := errorLocation(err, tuple.NewLocation(fileName, 0, 0, 0))
 				locationLogger(location, "ERROR", fmt.Sprintf("%s", err))
 				errors += 1
-				break
+				if isCancelled(err) {
+					break
+				}
+			}
+			if context != nil {
+				errors += context.Errors()
 			}
-			errors += context.Errors()
 		}
 	}
 	return errors
 }
 
+// An error in one file does not stop the following files being run unless the run was cancelled.
+func isCancelled(err error) bool {
+	return err == gocontext.Canceled || err == gocontext.DeadlineExceeded
+}
+
+// Errors raised while evaluating know where the failing expression is.
+func errorLocation(err error, otherwise tuple.Location) tuple.Location {
+	if scriptError, ok := err.(*eval.ScriptError); ok {
+		if location, ok := scriptError.Location(); ok {
+			return location
+		}
+	}
+	return otherwise
+}
+
 /////////////////////////////////////////////////////////////////////////////
 
 func (grammars * Grammars) AddAllKnownGrammars() {
@@ -129,9 +163,13 @@ func (grammars * Grammars) AddAllKnownGrammars() {
 	grammars.Add(parsers.NewInfixExpressionGrammar())
 	grammars.Add(parsers.NewYamlGrammar())
 	grammars.Add(parsers.NewIniGrammar())
+	grammars.Add(parsers.NewTomlGrammar())
 	grammars.Add(parsers.NewPropertyGrammar())
 	grammars.Add(parsers.NewJSONGrammar())
 	grammars.Add(parsers.NewShellGrammar())
+	grammars.Add(parsers.NewCsvGrammar())
+	grammars.Add(parsers.NewTsvGrammar())
+	grammars.Add(parsers.NewXmlGrammar())
 }
 
 
@@ -9,13 +9,23 @@ import (
 	"math"
 	"strings"
 	"reflect"
+	"os"
+	"path/filepath"
 )
 
 var NewTuple = tuple.NewTuple
 type Int64 = tuple.Int64
 type Tag = tuple.Tag
 var logger = tuple.NewVerboseFilterLogger(false, tuple.NewDefaultLocationLogger())
-var safeEvalContext = runner.NewSafeEvalContext(logger)
+
+// The runner's tests are run with each way of evaluating.
+var modes = []eval.Mode{eval.INTERPRET, eval.COMPILE, eval.BYTECODE}
+
+func newSafeEvalContext(mode eval.Mode) eval.EvalContext {
+	context := runner.NewSafeEvalContext(logger)
+	context.GlobalScope().SetMode(mode)
+	return context
+}
 
 
 func testFiles(t *testing.T) {
@@ -79,14 +89,18 @@ func TestGrammars(t *testing.T) {
 
 		test(tuple.Tag{"abcde"}, "abcde")
 		test(tuple.Float64(-1.123), "-1.123")
-		test(tuple.Float64(math.NaN()), "NaN")
-		test(tuple.Float64(math.Inf(1)), "Inf")
+		nan, inf := "NaN", "Inf"
+		if suffix == ".toml" {
+			nan, inf = "nan", "inf"  // As TOML spells them
+		}
+		test(tuple.Float64(math.NaN()), nan)
+		test(tuple.Float64(math.Inf(1)), inf)
 		test(tuple.Int64(123), "123")
 		test(tuple.String("abc"), "abc")
 		test(NewTuple(tuple.Int64(-1234)), "-1234")
 		test(tuple.Bool(false), "false")  //  'false' might not be valid for all grammars
 	})
-	if count != 8 {
+	if count != 12 {
 		t.Errorf("Expected %d got %d", 2, count)
 	}
 }
@@ -97,8 +111,16 @@ func TestGrammarsFunctions(t *testing.T) {
 	grammars := runner.NewGrammars(defaultGrammar)
 	grammars.AddAllKnownGrammars()
 
+	for _, mode := range modes {
+		testGrammarsFunctions(t, &grammars, mode)
+	}
+}
+
+func testGrammarsFunctions(t *testing.T, grammars *runner.Grammars, mode eval.Mode) {
+
 	ifNotFound := eval.NewErrorIfFunctionNotFound()
 	evalContext := eval.NewRunner(ifNotFound, logger)
+	evalContext.SetMode(mode)
 	eval.AddHarmlessFunctions(&evalContext)
 	eval.AddSafeFunctions(&evalContext)
 	grammars.AddSafeGrammarFunctions(&evalContext)
@@ -121,11 +143,11 @@ func TestGrammarsFunctions(t *testing.T) {
 		t.Errorf("Expected 22, got %s", val)
 	}
 	val,_ = runner.ParseAndEval(&evalContext, grammars.Default(), "expr(\"1+2\")")
-	if val == tuple.Int64(3) {
+	if val != tuple.Int64(3) {
 		t.Errorf("Expected 3, got %s", val)
 	}
 	val,_ = runner.ParseAndEval(&evalContext, grammars.Default(), "(expr2 \"l\" \"(+ 1 2)\")")
-	if val == tuple.Int64(3) {
+	if val != tuple.Int64(3) {
 		t.Errorf("Expected 3, got %s", val)
 	}
 	p12 := NewTuple(Tag{"+"}, Int64(1), Int64(2))
@@ -137,7 +159,7 @@ func TestGrammarsFunctions(t *testing.T) {
 	test := func (formula string) {
 		val,err := runner.ParseAndEval(&evalContext, grammars.Default(), formula)
 		if val != tuple.Bool(true) {
-			t.Errorf("Expected '%s' to be TRUE, val=%s err=%s", formula, val, err)
+			t.Errorf("Expected '%s' in mode %d to be TRUE, val=%s err=%s", formula, mode, val, err)
 		}
 	}
 	test(`(== 3  (expr "1+2"))`)
@@ -171,3 +193,35 @@ func TestRunFilesFunctions(t *testing.T) {
 	}
 
 }
+
+func TestRunFilesContinuesAfterErrors(t *testing.T) {
+	directory := t.TempDir()
+	write := func(name string, source string) string {
+		file := filepath.Join(directory, name)
+		if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	files := []string{
+		write("first.wsh", "1/0\n1+1\n"),
+		write("second.unknown", "1\n"),
+		write("third.wsh", "nosuch 3\n2+2\n"),
+	}
+	logger := func (location tuple.Location, level string, message string) {}
+	for _, mode := range modes {
+		context := runner.NewSafeEvalContext(logger)
+		context.GlobalScope().SetMode(mode)
+		grammars := runner.NewGrammars(parsers.NewShellGrammar())
+		grammars.AddAllKnownGrammars()
+		output := ""
+		pipeline := runner.SimplePipeline(context, true, "", parsers.NewShellGrammar(), func (value string) { output += value })
+		errors := grammars.RunFiles(logger, files, pipeline)
+		if errors != 3 {
+			t.Errorf("Expected 3 errors in mode %d got %d", mode, errors)
+		}
+		if strings.Join(strings.Fields(output), " ") != "2 4" {
+			t.Errorf("Expected the values after each error to be evaluated in mode %d got '%s'", mode, output)
+		}
+	}
+}
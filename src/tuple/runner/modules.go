@@ -0,0 +1,164 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package runner
+
+import "tuple"
+import "tuple/eval"
+import "errors"
+import "fmt"
+import "os"
+import "path/filepath"
+import "sort"
+import "strings"
+
+/////////////////////////////////////////////////////////////////////////////
+// Modules
+/////////////////////////////////////////////////////////////////////////////
+
+// A script can import another as a module, it is evaluated once into a scope of its own and the
+// functions it declares are then available as fields of the module: member lib f(x)
+//
+//   import "lib.wsh"          # Binds lib, returning the name as 'func' does
+//   import "lib" util         # Binds util, the suffix is found from the grammars
+//   m = (require "lib.wsh")   # Only returns the module
+//
+// A module is found relative to the file importing it then in each directory of the search path.
+type Modules struct {
+	grammars * Grammars
+	path []string
+	loaded map[string]tuple.TagValueMap  // By file
+	loading []string  // Files being imported, the latest last
+}
+
+func NewModules(grammars * Grammars, path []string) *Modules {
+	return &Modules{grammars, path, map[string]tuple.TagValueMap{}, []string{}}
+}
+
+// The directories searched for modules.
+func (modules * Modules) Path() []string {
+	return modules.path
+}
+
+func (modules * Modules) SetPath(path []string) {
+	modules.path = path
+}
+
+// Finds the file of a module imported from a file, without a suffix any grammar's is tried.
+func (modules * Modules) Resolve(name string, from string) (string, error) {
+	dirs := []string{""}
+	if ! filepath.IsAbs(name) {
+		dirs = []string{"."}
+		if from != "" && ! strings.HasPrefix(from, "<") {
+			dirs = []string{filepath.Dir(from)}
+		}
+		dirs = append(dirs, modules.path...)
+	}
+	suffixes := []string{""}
+	if filepath.Ext(name) == "" {
+		suffixes = []string{}
+		for suffix, _ := range modules.grammars.All {
+			suffixes = append(suffixes, suffix)
+		}
+		sort.Strings(suffixes)
+	}
+	for _, dir := range dirs {
+		for _, suffix := range suffixes {
+			file := filepath.Join(dir, name + suffix)
+			if info, err := os.Stat(file); err == nil && ! info.IsDir() {
+				return filepath.Abs(file)
+			}
+		}
+	}
+	message := fmt.Sprintf("Module '%s' not found in %s", name, strings.Join(dirs, ", "))
+	return "", eval.NewScriptError("import", message)
+}
+
+// Evaluates the module's file unless it has been, returning the functions it declares.
+func (modules * Modules) Load(context eval.EvalContext, file string) (tuple.TagValueMap, error) {
+	if module, ok := modules.loaded[file]; ok {
+		return module, nil
+	}
+	for k, loading := range modules.loading {
+		if loading == file {
+			cycle := append(modules.loading[k:], file)
+			message := fmt.Sprintf("Import cycle: %s", strings.Join(cycle, " -> "))
+			return tuple.NewTagValueMap(), eval.NewScriptError("import", message)
+		}
+	}
+	modules.loading = append(modules.loading, file)
+	defer func() { modules.loading = modules.loading[:len(modules.loading) - 1] }()
+
+	global, ok := context.GlobalScope().(eval.EvalContext)
+	if ! ok {
+		return tuple.NewTagValueMap(), errors.New("Modules cannot be imported by this evaluator")
+	}
+	scope := global.NewLocalScope()
+	// After an error the rest is parsed but not evaluated, the error is returned rather than logged
+	var evalErr error
+	parsed, err := modules.grammars.RunFile(context.GlobalScope().LocationLogger(), file, func(value Value) error {
+		if evalErr == nil {
+			_, evalErr = eval.Eval(scope, value)
+		}
+		return nil
+	})
+	switch {
+	case evalErr != nil:
+		return tuple.NewTagValueMap(), evalErr
+	case err != nil:
+		return tuple.NewTagValueMap(), err
+	case parsed.Errors() > 0:
+		message := fmt.Sprintf("Module '%s' has %d errors", file, parsed.Errors())
+		return tuple.NewTagValueMap(), eval.NewScriptError("import", message)
+	}
+	module := tuple.NewTagValueMap()
+	if declared, ok := scope.(*eval.RunnerLocalScope); ok {
+		module = declared.Functions()
+	}
+	modules.loaded[file] = module
+	return module, nil
+}
+
+// Finds then loads a module imported where the expression being evaluated came from.
+func (modules * Modules) Require(context eval.EvalContext, name string) (tuple.TagValueMap, error) {
+	file, err := modules.Resolve(name, context.GlobalScope().Location().SourceName())
+	if err != nil {
+		return tuple.NewTagValueMap(), err
+	}
+	return modules.Load(context, file)
+}
+
+func (modules * Modules) AddModuleFunctions(table eval.LocalScope) {
+
+	importAs := func(context eval.EvalContext, name string, as string) (Value, error) {
+		module, err := modules.Require(context, name)
+		if err != nil {
+			return tuple.EMPTY, err
+		}
+		context.Add(as, func () Value { return module })
+		return Tag{as}, nil
+	}
+	table.Add("import", func(context eval.EvalContext, name String) (Value, error) {
+		base := filepath.Base(string(name))
+		return importAs(context, string(name), strings.TrimSuffix(base, filepath.Ext(base)))
+	})
+	table.Add("import", func(context eval.EvalContext, name String, as Tag) (Value, error) {
+		return importAs(context, string(name), as.Name)
+	})
+	table.Add("require", func(context eval.EvalContext, name String) (Value, error) {
+		return modules.Require(context, string(name))
+	})
+}
@@ -0,0 +1,90 @@
+/*
+    This file is part of WOZG.
+
+    WOZG is free software: you can redistribute it and/or modify
+    it under the terms of the GNU General Public License as published by
+    the Free Software Foundation, either version 3 of the License, or
+    (at your option) any later version.
+
+    WOZG is distributed in the hope that it will be useful,
+    but WITHOUT ANY WARRANTY; without even the implied warranty of
+    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+    GNU General Public License for more details.
+
+    You should have received a copy of the GNU General Public License
+    along with WOZG.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package runner_test
+
+import (
+	"testing"
+	"tuple"
+	"tuple/parsers"
+	"tuple/runner"
+	"tuple/eval"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func TestModules(t *testing.T) {
+
+	dir := t.TempDir()
+	write := func (name string, source string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("geometry.wsh", "set loads (loads+1)\nfunc square x { x*x }\nfunc area w h { w*h }\n")
+	write("twice.l", "(func twice x (* 2 x))\n")
+	write("shapes.wsh", "import \"geometry\"\nfunc cube x { x*(member geometry square(x)) }\n")
+	write("a.wsh", "import \"b\"\n")
+	write("b.wsh", "import \"a\"\n")
+
+	for _, mode := range modes {
+		testModules(t, dir, mode)
+	}
+}
+
+func testModules(t *testing.T, dir string, mode eval.Mode) {
+	context := runner.NewSafeEvalContext(logger)
+	context.GlobalScope().SetMode(mode)
+	context.Add("=", eval.AssignLocal)
+	grammars := runner.NewGrammars(parsers.NewShellGrammar())
+	grammars.AddAllKnownGrammars()
+	grammars.SetLocations(context.GlobalScope().Locations())
+	modules := runner.NewModules(&grammars, []string{dir})
+	modules.AddModuleFunctions(context)
+
+	grammar := parsers.NewShellGrammar()
+	test := func (formula string, expected tuple.Value) {
+		val, err := runner.ParseAndEval(context, grammar, formula)
+		if err != nil || val != expected {
+			t.Errorf("Expected '%s' in mode %d to be '%v' got '%v' %v", formula, mode, expected, val, err)
+		}
+	}
+
+	test("loads = 0", Int64(0))
+	test("import \"geometry\"", Tag{"geometry"})
+	test("(member geometry square(4)) + (member geometry area(2, 3))", Int64(22))
+	test("import \"twice\" t", Tag{"t"})
+	test("member t twice(5)", Int64(10))
+
+	// Evaluated once however often it is imported, modules can import others found relative to them
+	test("import \"shapes\"", Tag{"shapes"})
+	test("member shapes cube(3)", Int64(27))
+	test("arity (require \"geometry.wsh\")", Int64(2))
+	test("loads", Int64(1))
+
+	for _, formula := range []string{"import \"a\"", "import \"nosuch\"", "member geometry nosuch(1)"} {
+		_, err := runner.ParseAndEval(context, grammar, formula)
+		scriptError, ok := err.(*eval.ScriptError)
+		if ! ok {
+			t.Errorf("Expected '%s' to fail got %v", formula, err)
+			continue
+		}
+		if formula == "import \"a\"" && (scriptError.Kind() != "import" || ! strings.Contains(err.Error(), "cycle")) {
+			t.Errorf("Expected an import cycle got %s %s", scriptError.Kind(), err)
+		}
+	}
+}
@@ -74,7 +74,7 @@ func (query Query) filter(logger Logger, depth int, value Value, next Next) {
 		return
 	}
 
-	if tuple, ok := value.(Tuple); ok {
+	if tuple, ok := tuple.AsTuple(value); ok {
 		Verbose(logger, "QUERY depth=%d, tuple arity=%d", depth, value.Arity())
 		if tuple.Arity() == 0 {
 			if query.matchLeaf(logger, depth, "") {
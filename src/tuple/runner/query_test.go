@@ -59,19 +59,23 @@ func TestQuery(t *testing.T) {
 
 
 func TestExprQuery(t *testing.T) {
-	test := func (t *testing.T, formula string) {
-
+	for _, mode := range modes {
+		safeEvalContext := newSafeEvalContext(mode)
 		runner.AddSafeQueryFunctions(safeEvalContext)
-		var grammar = parsers.NewInfixExpressionGrammar()
-		val,err := runner.ParseAndEval(safeEvalContext, grammar, formula)
-		if err != nil || ! bool(val.(tuple.Bool)) {
-			t.Errorf("Expected success but got '%s' formula='%s' err=%s", val, formula, err)
+		test := func (t *testing.T, formula string) {
+
+			var grammar = parsers.NewInfixExpressionGrammar()
+			val,err := runner.ParseAndEval(safeEvalContext, grammar, formula)
+			if err != nil || val != tuple.Bool(true) {
+				t.Errorf("Expected success in mode %d but got '%s' formula='%s' err=%s", mode, val, formula, err)
+			}
 		}
+		test(t, "eq (list {c:1 d:\"w\"}) (query \"os.b\" { os: { a:1 b: {c:1 d:\"w\"}}})")
+		test(t, "eq (list \"w\") (query \"os.b.d\" { os: { a:1 b: {c:1 d:\"w\"}}})")
+		test(t, "eq (list 1) (query \"os.*.c\" { os: { a:1 b: {c:1 d:\"w\"}}})")
+		test(t, "eq (list 1) (query \"*.b.c\" { os: { a:1 b: {c:1 d:\"w\"}}})")
+		test(t, "eq (list 1 2) (query \"*\" (list 1 2))")
 	}
-	test(t, "eq (list {c:1 d:\"w\"}) (query \"os.b\" { os: { a:1 b: {c:1 d:\"w\"}}})")
-	test(t, "eq (list \"w\") (query \"os.b.d\" { os: { a:1 b: {c:1 d:\"w\"}}})")
-	test(t, "eq (list 1) (query \"os.*.c\" { os: { a:1 b: {c:1 d:\"w\"}}})")
-	test(t, "eq (list 1) (query \"*.b.c\" { os: { a:1 b: {c:1 d:\"w\"}}})")
 
 	// query "a.b.c" ("a" ("b" ("c" 1 2 3) ("c" 4 5 6)) ("d" (8 9 0)))  
 }
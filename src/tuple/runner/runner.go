@@ -17,11 +17,13 @@
 package runner
 
 import "tuple"
+import gocontext "context"
 import "fmt"
 import "bufio"
 import "os"
 import "errors"
 import "flag"
+import "os/signal"
 import "tuple/eval"
 import "tuple/parsers"
 
@@ -53,9 +55,11 @@ func promptOnEOL(context Context) {
 	}
 }
 
-func RunParserOnStdin(logger LocationLogger, inputGrammar Grammar, next Next) (Context, error) {
+func RunParserOnStdin(cancellation gocontext.Context, logger LocationLogger, inputGrammar Grammar, locations tuple.Locations, next Next) (Context, error) {
 	reader := bufio.NewReader(os.Stdin)
 	context := parsers.NewParserContext2(STDIN, reader, logger, promptOnEOL)
+	context.SetLocations(locations)
+	context.SetCancellation(cancellation)
 	context.EOL() // prompt
 	err := inputGrammar.Parse(&context, next)
 	return &context, err
@@ -71,6 +75,14 @@ func NewSafeEvalContext(logger LocationLogger) eval.EvalContext {
 	return &runner
 }
 
+// A safe evaluator for formulas from end users, evaluation stops with an eval.BudgetError
+// when one of the limits is exceeded.
+func NewLimitedEvalContext(logger LocationLogger, limits eval.Limits) eval.EvalContext {
+	context := NewSafeEvalContext(logger)
+	context.GlobalScope().SetLimits(limits)
+	return context
+}
+
 func NewHarmlessEvalContext(logger LocationLogger) eval.EvalContext {
 	ifNotFound := eval.NewErrorIfFunctionNotFound()
 	runner := eval.NewRunner(ifNotFound, logger)
@@ -80,16 +92,20 @@ func NewHarmlessEvalContext(logger LocationLogger) eval.EvalContext {
 
 /////////////////////////////////////////////////////////////////////////////
 
-func LocationForValue(value Value) tuple.Location {
-	// TODO get the location associate with a Value
-	return tuple.NewLocation("<eval>", 0, 0, 0) // TODO
+// Returns where a value was parsed, values created during evaluation have the location of the current expression.
+func LocationForValue(context eval.EvalContext, value Value) tuple.Location {
+	global := context.GlobalScope()
+	if location, ok := global.Locations().Find(value); ok {
+		return location
+	}
+	return global.Location()
 }
 
 /////////////////////////////////////////////////////////////////////////////
 
 func ParseAndEval(context eval.EvalContext, grammar Grammar, expression string) (Value, error) {
 
-	var result Value = tuple.NAN  // TODO ought to be EMPTY
+	var result Value = tuple.NULL
 	pipeline := func(value Value) error {
 		evaluated, err := eval.Eval(context, value)
 		if err != nil {
@@ -98,7 +114,8 @@ func ParseAndEval(context eval.EvalContext, grammar Grammar, expression string)
 		result = evaluated
 		return nil
 	}
-	ctx, err := parsers.RunParser(grammar, expression, context.GlobalScope().LocationLogger(), pipeline)
+	global := context.GlobalScope()
+	ctx, err := parsers.RunParserWithCancellation(global.Cancellation(), grammar, expression, global.LocationLogger(), global.Locations(), pipeline)
 	if ctx.Errors() > 0 {
 		return nil, errors.New("Errors during parse")
 	}
@@ -110,8 +127,12 @@ func PrintString(value string) {
 }
 
 //  Set up the translator pipeline.
+//  It stops with an error once the evaluator's cancellation is cancelled, values before are output.
 func SimplePipeline (context eval.EvalContext, runEval bool, queryPattern string, outputGrammar Grammar, out func(value string)) Next {
 
+	if streamPrinter, ok := outputGrammar.(parsers.StreamPrinter); ok {
+		outputGrammar = streamPrinter.NewStream()
+	}
 	prettyPrint := func(tuple Value) error {
 		outputGrammar.Print(tuple, out)
 		return nil
@@ -136,7 +157,51 @@ func SimplePipeline (context eval.EvalContext, runEval bool, queryPattern string
 			return nil
 		}
 	}
-	return pipeline
+	cancellable := pipeline
+	return func(value Value) error {
+		if err := context.GlobalScope().Cancellation().Err(); err != nil {
+			return err
+		}
+		return cancellable(value)
+	}
+}
+
+// A context cancelled by the first Ctrl-C. Ctrl-C is then no longer caught, so a second one
+// stops the process as usual even while it waits for input or a command.
+func InterruptContext() (gocontext.Context, func()) {
+	cancellation, stop := signal.NotifyContext(gocontext.Background(), os.Interrupt)
+	go func() {
+		<-cancellation.Done()
+		stop()
+	}()
+	return cancellation, stop
+}
+
+// Defines a -mode flag choosing how scripts are evaluated, compiled by default.
+// An unknown mode is reported as flag errors are, with the usage.
+func ModeFlag(usage string) *eval.Mode {
+	mode := eval.COMPILE
+	flag.Var(&modeFlag{"compile", &mode}, "mode", usage)
+	return &mode
+}
+
+type modeFlag struct {
+	name string
+	mode *eval.Mode
+}
+
+func (value *modeFlag) String() string {
+	return value.name
+}
+
+func (value *modeFlag) Set(name string) error {
+	mode, ok := eval.ModeOf(name)
+	if ! ok {
+		return errors.New("expected interpret, compile or bytecode")
+	}
+	value.name = name
+	*value.mode = mode
+	return nil
 }
 
 func GetRemainingNonFlagOsArgs() []string {
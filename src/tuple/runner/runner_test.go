@@ -5,14 +5,23 @@ import (
 	"tuple"
 	"tuple/parsers"
 	"tuple/runner"
+	"tuple/eval"
 	"math"
+	"time"
+	"strings"
+	gocontext "context"
+	"os"
+	"path/filepath"
+	"flag"
 )
 
 func TestEval1(t *testing.T) {
 	var grammar = parsers.NewInfixExpressionGrammar()
-	val,_ := runner.ParseAndEval(safeEvalContext, grammar, "1+1")
-	if val != tuple.Float64(2) {
-		t.Errorf("1+1=%s", val)
+	for _, mode := range modes {
+		val,_ := runner.ParseAndEval(newSafeEvalContext(mode), grammar, "1+1")
+		if val != tuple.Int64(2) {
+			t.Errorf("In mode %d 1+1=%s", mode, val)
+		}
 	}
 }
 
@@ -34,16 +43,175 @@ func TestEvalToInt64(t *testing.T) {
 		"cos(PI)" : -1,
 		"acos(cos(PI))" : math.Pi,
 	}
-	for k, v := range tests {
-		val,_ := runner.ParseAndEval(safeEvalContext, grammar, k)
-		if val != tuple.Float64(v) {
-			t.Errorf("%s=%d   %s", k, int64(v), val)
+	for _, mode := range modes {
+		context := newSafeEvalContext(mode)
+		for k, v := range tests {
+			val,_ := runner.ParseAndEval(context, grammar, k)
+			if val != tuple.Float64(v) && val != tuple.Int64(v) {
+				t.Errorf("In mode %d %s=%d   %s", mode, k, int64(v), val)
+			}
 		}
 	}
 }
 
 func TestSimplePipeline(t *testing.T) {
-	
-	runner.SimplePipeline(safeEvalContext, true, "*", parsers.NewLispGrammar(), func (_ string) {})
-	// TODO
+
+	for _, mode := range modes {
+		test := func (runEval bool, query string, source string, expected string) {
+			output := ""
+			pipeline := runner.SimplePipeline(newSafeEvalContext(mode), runEval, query, parsers.NewLispGrammar(), func (value string) {
+				output += value
+			})
+			parsers.RunParser(parsers.NewLispGrammar(), source, logger, pipeline)
+			if got := strings.Join(strings.Fields(output), " "); got != expected {
+				t.Errorf("Given '%s' in mode %d expected '%s' got '%s'", source, mode, expected, got)
+			}
+		}
+		test(true, "", "(+ 1 2)\n(* 2 3)\n", "3 6")
+		test(false, "", "(+ 1 2)\n", "( + 1 2 )")
+		test(true, "", "(func double x (* 2 x))\n(double 4)\n(double 5)\n", "double 8 10")
+		test(true, "", "(if (< 1 2) \"yes\" \"no\")", "\"yes\"")
+		test(true, "*", "(list 1 2)\n", "( 1 2 )")
+	}
+}
+
+func TestLocationOfEvalErrors(t *testing.T) {
+	for _, mode := range modes {
+		testLocationOfEvalErrors(t, mode)
+	}
+}
+
+func testLocationOfEvalErrors(t *testing.T, mode eval.Mode) {
+	logger := func (location tuple.Location, level string, message string) {}
+	context := runner.NewSafeEvalContext(logger)
+	context.GlobalScope().SetMode(mode)
+	_, err := runner.ParseAndEval(context, parsers.NewLispGrammar(), "(+ 1\n\n  (nosuch 2))")
+	scriptError, ok := err.(*eval.ScriptError)
+	if ! ok {
+		t.Fatalf("Expected a script error in mode %d got '%v'", mode, err)
+	}
+	if location, ok := scriptError.Location(); ! ok || location.Line() != 3 || scriptError.Kind() != "notfound" {
+		t.Errorf("Expected a 'notfound' error on line 3 in mode %d got %s '%s'", mode, scriptError.Kind(), location)
+	}
+
+	var value tuple.Value
+	parsers.RunParserWithLocations(parsers.NewLispGrammar(), "\n(a (b c))", logger, context.GlobalScope().Locations(), func (parsed tuple.Value) error {
+		value = parsed
+		return nil
+	})
+	if location := runner.LocationForValue(context, value); location.Line() != 2 {
+		t.Errorf("Expected '%s' on line 2 got %d", value, location.Line())
+	}
+
+	// Errors evaluating the values of a script are reported on the line of the value
+	// rather than the next line, which has been read by the time the value is evaluated
+	test := func(source string, line int64) {
+		lines := []int64{}
+		logger := func (location tuple.Location, level string, message string) {
+			if level == "ERROR" {
+				lines = append(lines, location.Line())
+			}
+		}
+		file := filepath.Join(t.TempDir(), "script.wsh")
+		if err := os.WriteFile(file, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+		context := runner.NewSafeEvalContext(logger)
+		context.GlobalScope().SetMode(mode)
+		grammars := runner.NewGrammars(parsers.NewShellGrammar())
+		grammars.SetLocations(context.GlobalScope().Locations())
+		grammars.RunFiles(logger, []string{file}, runner.SimplePipeline(context, true, "", parsers.NewShellGrammar(), func (_ string) {}))
+		if len(lines) != 1 || lines[0] != line {
+			t.Errorf("Given '%s' in mode %d expected an error on line %d got %v", source, mode, line, lines)
+		}
+	}
+	test("nosuch 1\n", 1)
+	test("1\n\n(1 / 0)\n2\n", 3)
+	test("1\n\n  1 + (1 / 0)\n2\n", 3)
+	test("1\n\n{\n  nosuch 2\n}\n", 4)
+}
+
+func TestCancellation(t *testing.T) {
+	logger := func (location tuple.Location, level string, message string) {}
+
+	// Values parsed before cancelling are passed on
+	cancellation, cancel := gocontext.WithCancel(gocontext.Background())
+	values := []tuple.Value{}
+	_, err := parsers.RunParserWithCancellation(cancellation, parsers.NewLispGrammar(), "1 2 3 4 5 6", logger, tuple.NewLocations(), func (value tuple.Value) error {
+		values = append(values, value)
+		cancel()
+		return nil
+	})
+	if err != gocontext.Canceled || len(values) != 1 {
+		t.Errorf("Expected the parse to be cancelled after one value got %v %v", values, err)
+	}
+
+	for _, mode := range modes {
+		testEvaluationCancellation(t, mode)
+	}
+}
+
+func testEvaluationCancellation(t *testing.T, mode eval.Mode) {
+	logger := func (location tuple.Location, level string, message string) {}
+
+	// Evaluation is cancelled even within 'try'
+	context := runner.NewSafeEvalContext(logger)
+	context.GlobalScope().SetMode(mode)
+	cancellation, cancel := gocontext.WithCancel(gocontext.Background())
+	context.GlobalScope().SetCancellation(cancellation)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := runner.ParseAndEval(context, parsers.NewShellGrammar(), "try (while true { 1 }) (catch e 1)")
+	if err != gocontext.Canceled {
+		t.Errorf("Expected the evaluation in mode %d to be cancelled got %v", mode, err)
+	}
+
+	// The pipeline outputs the values evaluated before cancelling
+	context = runner.NewSafeEvalContext(logger)
+	context.GlobalScope().SetMode(mode)
+	cancellation, cancel = gocontext.WithCancel(gocontext.Background())
+	context.GlobalScope().SetCancellation(cancellation)
+	output := ""
+	pipeline := runner.SimplePipeline(context, true, "", parsers.NewShellGrammar(), func (value string) {
+		output += value
+		cancel()
+	})
+	_, err = parsers.RunParserWithCancellation(cancellation, parsers.NewShellGrammar(), "1+2\n3+4", logger, tuple.NewLocations(), pipeline)
+	if err != gocontext.Canceled || strings.TrimSpace(output) != "3" {
+		t.Errorf("Expected '3' before cancelling in mode %d got '%s' %v", mode, output, err)
+	}
+}
+
+// The examples evaluated by walking the parsed values each time and by compiling them first.
+func BenchmarkFibonnacci(b *testing.B) {
+	logger := func (location tuple.Location, level string, message string) {}
+	source, err := os.ReadFile("../../../examples/fibonnacci.wsh")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, mode := range []eval.Mode{eval.INTERPRET, eval.COMPILE, eval.BYTECODE} {
+		name := map[eval.Mode]string{eval.INTERPRET: "interpret", eval.COMPILE: "compile", eval.BYTECODE: "bytecode"}[mode]
+		b.Run(name, func (b *testing.B) {
+			for k := 0; k < b.N; k += 1 {
+				context := runner.NewSafeEvalContext(logger)
+				context.Add("=", eval.AssignLocal)
+				context.GlobalScope().SetMode(mode)
+				if _, err := runner.ParseAndEval(context, parsers.NewShellGrammar(), string(source)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestModeFlag(t *testing.T) {
+	mode := runner.ModeFlag("How scripts are evaluated.")
+	if *mode != eval.COMPILE {
+		t.Errorf("Expected compile by default got %d", *mode)
+	}
+	if err := flag.Set("mode", "bytecode"); err != nil || *mode != eval.BYTECODE {
+		t.Errorf("Expected bytecode got %d %v", *mode, err)
+	}
+	if err := flag.Set("mode", "nosuch"); err == nil || *mode != eval.BYTECODE {
+		t.Errorf("Expected an unknown mode to be an error got %d %v", *mode, err)
+	}
 }
@@ -20,6 +20,7 @@ func main () {
 	var ast = flag.Bool("ast", false, "If set then returns the AST else runs the 'eval' interpretter.")
 	var queryPattern = flag.String("query", "", "Select parts of the AST matching a query pattern.")
 	var version = flag.Bool("version", false, "Print version of this software.")
+	var mode = runner.ModeFlag("How expressions are evaluated: interpret, compile or bytecode.")
 	flag.Parse()
 	
 	if *version {
@@ -38,6 +39,7 @@ func main () {
 	//
 	logger := tuple.NewVerboseFilterLogger(*verbose, tuple.NewDefaultLocationLogger())
 	runner1 := runner.NewSafeEvalContext(logger)
+	runner1.GlobalScope().SetMode(*mode)
 	
 	grammars := runner.NewGrammars(parsers.NewInfixExpressionGrammar())
 	pipeline := runner.SimplePipeline (runner1, !*ast, *queryPattern, grammars.Default(), runner.PrintString)
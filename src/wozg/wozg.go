@@ -22,6 +22,7 @@ import (
 	"tuple/eval"
 	"tuple"
 	"os"
+	"path/filepath"
 	"fmt"
 	"flag"
 	"strings"
@@ -44,7 +45,10 @@ func main() {
 	var queryPattern = flag.String("query", "", "Select parts of the AST matching a query pattern.")
 	var version = flag.Bool("version", false, "Print version of this software.")
 	var command = flag.Bool("command", false, "Execute command lines arguments rather than files.")
+	var modulePath = flag.String("path", os.Getenv("WSH_PATH"), "Directories searched for imported modules.")
 	var listGrammars = flag.Bool("list-grammars", false, "List supported grammars.")
+	var header = flag.Bool("header", true, "The first line of CSV and TSV input names the columns.")
+	var mode = runner.ModeFlag("How 'eval' evaluates: interpret, compile or bytecode.")
 
 
 	flag.Parse()
@@ -60,6 +64,8 @@ func main() {
 
 	grammars := runner.NewGrammars(parsers.NewLispGrammar())
 	grammars.AddAllKnownGrammars()
+	grammars.Add(parsers.NewCsvGrammarWithHeader(*header))
+	grammars.Add(parsers.NewTsvGrammarWithHeader(*header))
 	// To list all grammars: wozg -eval -command grammars
 	if *listGrammars {
 		grammars.Forall(func (grammar tuple.Grammar) {
@@ -79,6 +85,13 @@ func main() {
 
 	finder := eval.NewErrorIfFunctionNotFound()
 	runner1 := eval.NewRunner(finder, logger)
+	grammars.SetLocations(runner1.Locations())
+	// Ctrl-C stops parsing and evaluation, what has been output so far is kept
+	cancellation, stop := runner.InterruptContext()
+	defer stop()
+	grammars.SetCancellation(cancellation)
+	runner1.SetCancellation(cancellation)
+	runner1.SetMode(*mode)
 
 	//
 	//  Set up the translator pipeline.
@@ -87,6 +100,7 @@ func main() {
 		eval.AddSafeFunctions(&runner1)
 		grammars.AddSafeGrammarFunctions(&runner1)
 		runner.AddSafeQueryFunctions(&runner1)
+		runner.NewModules(&grammars, filepath.SplitList(*modulePath)).AddModuleFunctions(&runner1)
 	}
 
 	//
@@ -104,7 +118,7 @@ func main() {
 		//
 		//  Set up the translator pipeline.
 		//
-		context , err := parsers.RunParser(inputGrammar, expression, logger, pipeline)
+		context , err := parsers.RunParserWithCancellation(cancellation, inputGrammar, expression, logger, runner1.Locations(), pipeline)
 		if err != nil || context.Errors() > 0 {
 			os.Exit(1)
 		}
@@ -21,6 +21,7 @@ import "tuple/eval"
 import "tuple/runner"
 import "tuple/parsers"
 import "os"
+import "path/filepath"
 import "fmt"
 import "flag"
 
@@ -35,6 +36,9 @@ func main () {
 	var ast = flag.Bool("ast", false, "If set then returns the AST else runs the 'eval' interpretter.")
 	var queryPattern = flag.String("query", "", "Select parts of the AST matching a query pattern.")
 	var version = flag.Bool("version", false, "Print version of this software.")
+	var recursion = flag.Int64("recursion", eval.DefaultRecursion, "The deepest nesting of function calls.")
+	var modulePath = flag.String("path", os.Getenv("WSH_PATH"), "Directories searched for imported modules.")
+	var mode = runner.ModeFlag("How scripts are evaluated: interpret, compile or bytecode.")
 	flag.Parse()
 	
 	if *version {
@@ -46,16 +50,25 @@ func main () {
 	//  Set up the translator pipeline.
 	//
 	logger := tuple.NewVerboseFilterLogger(*verbose, tuple.NewDefaultLocationLogger())
+	// Ctrl-C stops parsing and evaluation, what has been output so far is kept
+	cancellation, stop := runner.InterruptContext()
+	defer stop()
 	ifNotFound := eval.NewExecIfNotFound()
 
 	grammars := runner.NewGrammars(parsers.NewShellGrammar())
 	grammars.AddAllKnownGrammars()
 	runner1 := eval.NewRunner(ifNotFound, logger)
+	grammars.SetLocations(runner1.Locations())
+	grammars.SetCancellation(cancellation)
+	runner1.SetCancellation(cancellation)
+	runner1.SetLimits(eval.Limits{Recursion: *recursion})
+	runner1.SetMode(*mode)
 
 	eval.AddSafeFunctions(&runner1)
 	runner.AddSafeQueryFunctions(&runner1)
 	runner.AddTranslatedSafeFunctions(&runner1)
 	grammars.AddSafeGrammarFunctions(&runner1)
+	runner.NewModules(&grammars, filepath.SplitList(*modulePath)).AddModuleFunctions(&runner1)
 
 	eval.AddLessSafeFunctions(&runner1, &runner1)
 	runner1.Add("|", eval.Pipe)